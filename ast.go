@@ -2,14 +2,55 @@ package expronaut
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"math"
+	"math/big"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
 )
 
+// UndefinedVariableError is returned when an expression references a variable
+// that is not defined.
+type UndefinedVariableError struct {
+	Name string
+}
+
+func (e *UndefinedVariableError) Error() string {
+	return fmt.Sprintf("variable %s not defined", e.Name)
+}
+
+// UnknownFunctionError is returned when an expression calls a function that
+// is not registered on the engine. It matches ErrUnknownFunction.
+type UnknownFunctionError struct {
+	Name string
+}
+
+func (e *UnknownFunctionError) Error() string {
+	return fmt.Sprintf("%v: %s", ErrUnknownFunction, e.Name)
+}
+
+func (e *UnknownFunctionError) Is(target error) bool {
+	return target == ErrUnknownFunction
+}
+
 var (
-	// ContextKey is used to store the variables in the context.
+	// ContextKey is the context key under which a map[string]any with the
+	// variables is used when the context has no Resolver.
+	//
+	// Deprecated: use SetVariables or WithResolver, which use a private key
+	// that cannot collide with the context keys of other packages.
+	// SetVariables still stores the map under ContextKey as well, for
+	// functions that read it from the context, but will stop doing so in a
+	// future release.
 	ContextKey = "_exp"
+
+	errLogicalOperand   = errors.New("operands for logical operation must be boolean")
+	errConditionOperand = errors.New("condition of conditional expression must be boolean")
 )
 
 // ASTNode is the interface for all nodes in the AST.
@@ -19,8 +60,78 @@ type ASTNode interface {
 	String() string
 }
 
+// nodeSpan records the part of the source a node was parsed from, it is
+// embedded in every node.
+type nodeSpan struct {
+	span Span
+}
+
+// Span returns the part of the source the node was parsed from.
+func (n *nodeSpan) Span() Span { return n.span }
+
+// Pos returns the position of the first character of the node in the source.
+func (n *nodeSpan) Pos() Position { return n.span.Start }
+
+func (n *nodeSpan) setSpan(span Span) { n.span = span }
+
+// spanOf returns the span of the node, the zero Span for nodes that do not
+// record one.
+func spanOf(node ASTNode) Span {
+	if n, ok := node.(interface{ Span() Span }); ok {
+		return n.Span()
+	}
+
+	return Span{}
+}
+
+// inspect traverses the tree in depth-first order, calling f for every node.
+// The children of a node are skipped when f returns false.
+func inspect(node ASTNode, f func(ASTNode) bool) {
+	if node == nil || !f(node) {
+		return
+	}
+
+	var children []ASTNode
+	switch n := node.(type) {
+	case *BinaryOperationNode:
+		children = []ASTNode{n.Left, n.Right}
+	case *UnaryOperationNode:
+		children = []ASTNode{n.Operand}
+	case *LogicalOperationNode:
+		children = []ASTNode{n.Left, n.Right}
+	case *RegexMatchNode:
+		children = []ASTNode{n.Subject, n.Pattern}
+	case *ConditionalNode:
+		children = []ASTNode{n.Condition, n.Consequent, n.Alternative}
+	case *NullCoalesceNode:
+		children = []ASTNode{n.Left, n.Right}
+	case *OptionalChainNode:
+		children = []ASTNode{n.Object}
+	case *FunctionCallNode:
+		children = n.Arguments
+	case *ArrayNode:
+		children = n.Elements
+	case *LambdaNode:
+		children = []ASTNode{n.Body}
+	case *MapNode:
+		children = n.Values
+	case *IndexNode:
+		children = []ASTNode{n.Object, n.Index}
+	case *SliceNode:
+		children = []ASTNode{n.Object, n.Start, n.End}
+	case *ErrorNode:
+		children = n.Nodes
+	}
+
+	for _, child := range children {
+		inspect(child, f)
+	}
+}
+
 // IntLiteralNode represents an int literal in the AST.
 type IntLiteralNode struct {
+	nodeSpan
+
 	Value int
 }
 
@@ -38,6 +149,8 @@ func (n *IntLiteralNode) GoTemplate() string { return fmt.Sprintf("%d", n.Value)
 
 // FloatLiteralNode represents a numeric literal in the AST.
 type FloatLiteralNode struct {
+	nodeSpan
+
 	Value float64
 }
 
@@ -53,8 +166,33 @@ func (n *FloatLiteralNode) String() string {
 // GoTemplate returns the Go template representation of the number literal.
 func (n *FloatLiteralNode) GoTemplate() string { return fmt.Sprintf("%f", n.Value) }
 
+// DurationLiteralNode represents a duration literal such as 5m, 2h30m or 7d
+// in the AST.
+type DurationLiteralNode struct {
+	nodeSpan
+
+	Value time.Duration
+}
+
+// Evaluate computes the value of the duration literal.
+func (n *DurationLiteralNode) Evaluate(ctx context.Context) (any, error) {
+	return n.Value, nil
+}
+
+func (n *DurationLiteralNode) String() string {
+	return formatDuration(n.Value)
+}
+
+// GoTemplate returns the Go template representation of the duration literal,
+// its number of nanoseconds.
+func (n *DurationLiteralNode) GoTemplate() string {
+	return strconv.FormatInt(int64(n.Value), 10)
+}
+
 // BinaryOperationNode represents a binary operation (e.g., addition, subtraction) in the AST.
 type BinaryOperationNode struct {
+	nodeSpan
+
 	Left     ASTNode   // The left operand
 	Operator TokenType // The operator
 	Right    ASTNode   // The right operand
@@ -71,7 +209,46 @@ func (n *BinaryOperationNode) Evaluate(ctx context.Context) (any, error) {
 		return nil, err
 	}
 
-	switch n.Operator {
+	result, err := evalBinaryOperation(ctx, n.Operator, leftEval, rightEval)
+	if err != nil {
+		return nil, locate(err, n.span)
+	}
+
+	return result, nil
+}
+
+// evalBinaryOperation applies the binary operator to the already evaluated operands.
+func evalBinaryOperation(ctx context.Context, operator TokenType, leftEval, rightEval any) (any, error) {
+	normalize := normalizeOperand
+	switch operator {
+	case TokenTypeEqual, TokenTypeNotEqual,
+		TokenTypeLessThan, TokenTypeLessThanOrEqual,
+		TokenTypeGreaterThan, TokenTypeGreaterThanOrEqual,
+		TokenTypeIn, TokenTypeNotIn:
+		normalize = normalizeComparand
+	}
+
+	leftEval, err := normalize(ctx, leftEval)
+	if err != nil {
+		return nil, err
+	}
+
+	rightEval, err = normalize(ctx, rightEval)
+	if err != nil {
+		return nil, err
+	}
+
+	if leftEval == nil || rightEval == nil {
+		// null only equals null
+		switch operator {
+		case TokenTypeEqual:
+			return leftEval == nil && rightEval == nil, nil
+		case TokenTypeNotEqual:
+			return leftEval != nil || rightEval != nil, nil
+		}
+	}
+
+	switch operator {
 	case TokenTypePlus:
 		return BuiltinFunctions.Add(ctx, leftEval, rightEval)
 	case TokenTypeMinus:
@@ -86,48 +263,90 @@ func (n *BinaryOperationNode) Evaluate(ctx context.Context) (any, error) {
 		return BuiltinFunctions.Mod(ctx, leftEval, rightEval)
 	case TokenTypeExponent:
 		return BuiltinFunctions.Exp(ctx, leftEval, rightEval)
+	case TokenTypeIn, TokenTypeNotIn:
+		found, err := contains(rightEval, leftEval)
+		if err != nil {
+			return nil, err
+		}
+		return found == (operator == TokenTypeIn), nil
 	case TokenTypeEqual, TokenTypeNotEqual,
 		TokenTypeLessThan, TokenTypeLessThanOrEqual,
 		TokenTypeGreaterThan, TokenTypeGreaterThanOrEqual:
 
+		if usesDecimal(ctx, leftEval, rightEval) {
+			left, okLeft := toDecimal(leftEval)
+			right, okRight := toDecimal(rightEval)
+			if okLeft && okRight {
+				return applyDecimalComparison(left, right, operator), nil
+			}
+		}
+
+		if left, right, ok := bigOperands(leftEval, rightEval); ok {
+			return applyBigIntComparison(left, right, operator), nil
+		}
+
 		if left, ok := leftEval.(string); ok {
 			if right, ok := rightEval.(string); ok {
-				return applyStringComparison(left, right, n.Operator), nil
+				return applyStringComparison(left, right, operator), nil
 			}
 		} else if left, ok := leftEval.(float64); ok {
 			if right, ok := rightEval.(float64); ok {
-				return applyFloatComparison(left, right, n.Operator), nil
+				return applyFloatComparison(left, right, operator), nil
 			} else if right, ok := rightEval.(int); ok {
-				return applyFloatComparison(left, float64(right), n.Operator), nil
+				return applyFloatComparison(left, float64(right), operator), nil
+			} else if right, ok := rightEval.(*big.Int); ok {
+				return applyFloatComparison(left, bigIntFloat(right), operator), nil
+			}
+		} else if left, ok := leftEval.(*big.Int); ok {
+			if right, ok := rightEval.(float64); ok {
+				return applyFloatComparison(bigIntFloat(left), right, operator), nil
 			}
 		} else if left, ok := leftEval.(int); ok {
 			if right, ok := rightEval.(int); ok {
-				return applyIntComparison(left, right, n.Operator), nil
+				return applyIntComparison(left, right, operator), nil
 			} else if right, ok := rightEval.(float64); ok {
-				return applyFloatComparison(float64(left), right, n.Operator), nil
+				return applyFloatComparison(float64(left), right, operator), nil
 			}
 		} else if left, ok := leftEval.(time.Time); ok {
 			if right, ok := rightEval.(time.Time); ok {
-				return applyTimeComparison(left, right, n.Operator), nil
+				return applyTimeComparison(left, right, operator), nil
+			}
+		} else if left, ok := leftEval.(time.Duration); ok {
+			if right, ok := rightEval.(time.Duration); ok {
+				return applyIntComparison(int(left), int(right), operator), nil
+			}
+		} else if left, ok := leftEval.(bool); ok {
+			if right, ok := rightEval.(bool); ok && (operator == TokenTypeEqual || operator == TokenTypeNotEqual) {
+				return (left == right) == (operator == TokenTypeEqual), nil
+			}
+		} else if left, ok := leftEval.(map[string]any); ok {
+			if right, ok := rightEval.(map[string]any); ok && (operator == TokenTypeEqual || operator == TokenTypeNotEqual) {
+				return equalMaps(left, right) == (operator == TokenTypeEqual), nil
+			}
+		} else if left, ok := arrayElements(leftEval); ok {
+			if right, ok := arrayElements(rightEval); ok && (operator == TokenTypeEqual || operator == TokenTypeNotEqual) {
+				return equalArrays(left, right) == (operator == TokenTypeEqual), nil
 			}
 		}
-	case TokenTypeLeftShift:
+	case TokenTypeLeftShift, TokenTypeRightShift:
 		if left, ok := leftEval.(int); ok {
 			if right, ok := rightEval.(int); ok {
-				return left << right, nil
+				result, err := shiftInt(operator, left, right)
+				if errors.Is(err, ErrIntegerOverflow) && bigIntMode(ctx) {
+					return bigIntShift(operator, big.NewInt(int64(left)), right)
+				}
+				return result, err
 			}
-		}
-	case TokenTypeRightShift:
-		if left, ok := leftEval.(int); ok {
+		} else if left, ok := leftEval.(*big.Int); ok {
 			if right, ok := rightEval.(int); ok {
-				return left >> right, nil
+				return bigIntShift(operator, left, right)
 			}
 		}
 	default:
-		return nil, fmt.Errorf("unknown or unsupported operator: %v", n.Operator)
+		return nil, fmt.Errorf("unknown or unsupported operator: %v", operator)
 	}
 
-	return nil, fmt.Errorf(fmt.Sprintf("type mismatch or operation not applicable (%T(%v), %s, %T(%v))", leftEval, leftEval, n.Operator, rightEval, rightEval))
+	return nil, fmt.Errorf(fmt.Sprintf("type mismatch or operation not applicable (%T(%v), %s, %T(%v))", leftEval, leftEval, operator, rightEval, rightEval))
 }
 
 func (n *BinaryOperationNode) String() string {
@@ -136,6 +355,7 @@ func (n *BinaryOperationNode) String() string {
 }
 
 // GoTemplate returns the Go template representation of the binary operation.
+// Membership is written with the has helper (as known from sprig).
 func (n *BinaryOperationNode) GoTemplate() string {
 	var (
 		er = n.Right.GoTemplate()
@@ -150,11 +370,209 @@ func (n *BinaryOperationNode) GoTemplate() string {
 		el = fmt.Sprintf("(%s)", el)
 	}
 
+	if n.Operator == TokenTypeNotIn {
+		return fmt.Sprintf("not (%s %s %s)", TokenGoTemplate(TokenTypeIn), el, er)
+	}
+
+	// a time plus or minus a duration literal calls the Add method of the time
+	if d, ok := n.Right.(*DurationLiteralNode); ok && (n.Operator == TokenTypePlus || n.Operator == TokenTypeMinus) {
+		if n.Operator == TokenTypeMinus {
+			d = &DurationLiteralNode{Value: -d.Value}
+		}
+		return fmt.Sprintf("%s.Add %s", templateOperand(n.Left), d.GoTemplate())
+	}
+
+	if d, ok := n.Left.(*DurationLiteralNode); ok && n.Operator == TokenTypePlus {
+		return fmt.Sprintf("%s.Add %s", templateOperand(n.Right), d.GoTemplate())
+	}
+
 	return fmt.Sprintf("%s %s %s", TokenGoTemplate(n.Operator), el, er)
 }
 
+// UnaryOperationNode represents a prefix operation (e.g., logical not, negation) in the AST.
+type UnaryOperationNode struct {
+	nodeSpan
+
+	Operator TokenType // The operator
+	Operand  ASTNode   // The operand
+}
+
+// Evaluate computes the value of the unary operation.
+func (n *UnaryOperationNode) Evaluate(ctx context.Context) (any, error) {
+	operand, err := n.Operand.Evaluate(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := evalUnaryOperation(ctx, n.Operator, operand)
+	if err != nil {
+		return nil, locate(err, n.span)
+	}
+
+	return result, nil
+}
+
+// evalUnaryOperation applies the unary operator to the already evaluated operand.
+func evalUnaryOperation(ctx context.Context, operator TokenType, operand any) (any, error) {
+	operand, err := normalizeOperand(ctx, operand)
+	if err != nil {
+		return nil, err
+	}
+
+	switch operator {
+	case TokenTypeNot:
+		if b, ok := operand.(bool); ok {
+			return !b, nil
+		}
+
+		return nil, fmt.Errorf("operand for logical not must be boolean, got %T(%v)", operand, operand)
+	case TokenTypeMinus:
+		switch v := operand.(type) {
+		case int:
+			if v == math.MinInt {
+				if bigIntMode(ctx) {
+					return new(big.Int).Neg(big.NewInt(int64(v))), nil
+				}
+				return nil, fmt.Errorf("%w: -(%d)", ErrIntegerOverflow, v)
+			}
+			return -v, nil
+		case float64:
+			return -v, nil
+		case Decimal:
+			return v.Neg(), nil
+		case *big.Int:
+			return demoteBigInt(new(big.Int).Neg(v)), nil
+		case time.Duration:
+			if v == math.MinInt64 {
+				return nil, fmt.Errorf("%w: -(%s)", ErrIntegerOverflow, v)
+			}
+			return -v, nil
+		}
+	case TokenTypePlus:
+		switch v := operand.(type) {
+		case int, float64, Decimal, *big.Int, time.Duration:
+			return v, nil
+		}
+	case TokenTypeBitwiseNot:
+		switch v := operand.(type) {
+		case int:
+			return ^v, nil
+		case *big.Int:
+			return demoteBigInt(new(big.Int).Not(v)), nil
+		}
+	default:
+		return nil, fmt.Errorf("unknown or unsupported unary operator: %v", operator)
+	}
+
+	return nil, fmt.Errorf("type mismatch or operation not applicable (%s, %T(%v))", operator, operand, operand)
+}
+
+func (n *UnaryOperationNode) String() string {
+	return fmt.Sprintf("(%s %s)", n.Operator, n.Operand.String())
+}
+
+// GoTemplate returns the Go template representation of the unary operation.
+func (n *UnaryOperationNode) GoTemplate() string {
+	operand := n.Operand.GoTemplate()
+
+	switch n.Operand.(type) {
+	case *BinaryOperationNode, *LogicalOperationNode, *UnaryOperationNode, *FunctionCallNode:
+		operand = fmt.Sprintf("(%s)", operand)
+	}
+
+	switch n.Operator {
+	case TokenTypePlus:
+		return n.Operand.GoTemplate()
+	case TokenTypeMinus:
+		return fmt.Sprintf("sub 0 %s", operand)
+	default:
+		return fmt.Sprintf("%s %s", TokenGoTemplate(n.Operator), operand)
+	}
+}
+
+// RegexMatchNode represents a regular expression match (=~ or !~) in the AST.
+type RegexMatchNode struct {
+	nodeSpan
+
+	Subject  ASTNode   // The string to match
+	Operator TokenType // TokenTypeMatch or TokenTypeNotMatch
+	Pattern  ASTNode   // The regular expression
+
+	regexp *regexp.Regexp // The compiled pattern when it is a literal
+}
+
+// Evaluate computes the value of the regular expression match.
+func (n *RegexMatchNode) Evaluate(ctx context.Context) (any, error) {
+	subject, err := n.Subject.Evaluate(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	re := n.regexp
+	if re == nil {
+		pattern, err := n.Pattern.Evaluate(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		re, err = compileRegexp(pattern)
+		if err != nil {
+			return nil, locate(err, spanOf(n.Pattern))
+		}
+	}
+
+	result, err := matchRegexp(re, n.Operator, subject)
+	if err != nil {
+		return nil, locate(err, n.span)
+	}
+
+	return result, nil
+}
+
+// compileRegexp compiles a pattern evaluated at runtime.
+func compileRegexp(pattern any) (*regexp.Regexp, error) {
+	s, ok := pattern.(string)
+	if !ok {
+		return nil, fmt.Errorf("regular expression must be a string, got %T(%v)", pattern, pattern)
+	}
+
+	re, err := regexp.Compile(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid regular expression %q: %v", s, err)
+	}
+
+	return re, nil
+}
+
+// matchRegexp matches the subject against the regular expression.
+func matchRegexp(re *regexp.Regexp, operator TokenType, subject any) (any, error) {
+	s, ok := subject.(string)
+	if !ok {
+		return nil, fmt.Errorf("type mismatch or operation not applicable (%T(%v), %s, %s)", subject, subject, operator, re)
+	}
+
+	return re.MatchString(s) == (operator == TokenTypeMatch), nil
+}
+
+func (n *RegexMatchNode) String() string {
+	return fmt.Sprintf("(%s %s %s)", n.Subject.String(), n.Operator, n.Pattern.String())
+}
+
+// GoTemplate returns the Go template representation of the regular expression
+// match, using the regexMatch helper (as known from sprig).
+func (n *RegexMatchNode) GoTemplate() string {
+	match := fmt.Sprintf("%s %s %s", TokenGoTemplate(TokenTypeMatch), n.Pattern.GoTemplate(), n.Subject.GoTemplate())
+	if n.Operator == TokenTypeNotMatch {
+		return fmt.Sprintf("not (%s)", match)
+	}
+
+	return match
+}
+
 // StringLiteralNode represents a string literal in the AST.
 type StringLiteralNode struct {
+	nodeSpan
+
 	Value string
 }
 
@@ -172,47 +590,56 @@ func (n *StringLiteralNode) String() string {
 
 // VariableNode represents a variable in the AST.
 type VariableNode struct {
+	nodeSpan
+
 	Name string
 }
 
 // Evaluate computes the value of the variable.
-func (n *VariableNode) Evaluate(ctx context.Context) (any, error) {
-	// Assuming env is a map passed to Evaluate containing variable values.
-	value, exists := n.lookup(ctx, n.Name)
+func (n *VariableNode) Evaluate(ctx context.Context) (result any, err error) {
+	defer func() {
+		if getterErr := recoverGetter(recover()); getterErr != nil {
+			result, err = nil, locate(getterErr, n.span)
+		}
+	}()
+
+	value, exists := resolveVariable(ctx, strings.Split(n.Name, "."))
 	if !exists {
-		return nil, fmt.Errorf("variable %s not defined", n.Name)
+		return nil, locate(&UndefinedVariableError{Name: n.Name}, n.span)
 	}
 	return value, nil
 }
 
-// GoTemplate returns the Go template representation of the variable.
-func (n *VariableNode) lookup(ctx context.Context, name string) (any, bool) {
-	vars, ok := ctx.Value(ContextKey).(map[string]any)
-	if !ok {
-		return nil, false
-	}
-
-	// Split the name into parts
-	parts := strings.Split(name, ".")
-	if len(parts) == 1 {
-		return vars[parts[0]], true
-	}
-
-	// Traverse the parts to find the value
+// lookupPath traverses the variables following the parts of a dotted variable
+// name. A variable is defined when every part of the path exists, even when
+// its value is null.
+func lookupPath(vars map[string]any, parts []string) (any, bool) {
 	value, exists := vars[parts[0]]
 	if !exists {
 		return nil, false
 	}
 
+	return lookupFields(value, parts[1:])
+}
+
+// lookupFields traverses the value following the given field names. Next to
+// map[string]any it walks structs, pointers, typed maps and slices as
+// described by fieldValue.
+func lookupFields(value any, fields []string) (any, bool) {
+	var exists bool
+
 	// do a recursive lookup
-	for _, part := range parts[1:] {
+	for _, field := range fields {
 		switch v := value.(type) {
 		case map[string]any:
-			value, exists = v[part]
-			if !exists {
-				return nil, false
-			}
+			value, exists = v[field]
+		case nil:
+			return nil, false
 		default:
+			value, exists = fieldValue(v, field)
+		}
+
+		if !exists {
 			return nil, false
 		}
 	}
@@ -230,7 +657,14 @@ func (n *VariableNode) GoTemplate() string {
 }
 
 // LogicalOperationNode represents a logical operation (e.g., AND, OR) in the AST.
+//
+// Logical operations short-circuit: the right operand of && is only evaluated
+// when the left operand is true, and the right operand of || is only evaluated
+// when the left operand is false. This makes guards such as
+// `user.age != 0 && 100 / user.age > 2` safe to write.
 type LogicalOperationNode struct {
+	nodeSpan
+
 	Left     ASTNode
 	Operator TokenType
 	Right    ASTNode
@@ -242,25 +676,36 @@ func (n *LogicalOperationNode) Evaluate(ctx context.Context) (any, error) {
 	if err != nil {
 		return nil, err
 	}
-	rightEval, err := n.Right.Evaluate(ctx)
-	if err != nil {
-		return nil, err
-	}
 
-	leftBool, okLeft := leftEval.(bool)
-	rightBool, okRight := rightEval.(bool)
-	if !okLeft || !okRight {
-		return nil, fmt.Errorf("operands for logical operation must be boolean")
+	leftBool, ok := leftEval.(bool)
+	if !ok {
+		return nil, locate(errLogicalOperand, n.span)
 	}
 
 	switch n.Operator {
 	case TokenTypeAnd:
-		return leftBool && rightBool, nil
+		if !leftBool {
+			return false, nil
+		}
 	case TokenTypeOr:
-		return leftBool || rightBool, nil
+		if leftBool {
+			return true, nil
+		}
 	default:
 		return nil, fmt.Errorf("unknown logical operator: %v", n.Operator)
 	}
+
+	rightEval, err := n.Right.Evaluate(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	rightBool, ok := rightEval.(bool)
+	if !ok {
+		return nil, locate(errLogicalOperand, n.span)
+	}
+
+	return rightBool, nil
 }
 
 func (n *LogicalOperationNode) String() string {
@@ -273,8 +718,173 @@ func (n *LogicalOperationNode) GoTemplate() string {
 	return fmt.Sprintf("%s ( %s ) ( %s )", TokenGoTemplate(n.Operator), n.Left.GoTemplate(), n.Right.GoTemplate())
 }
 
+// ConditionalNode represents a conditional expression (cond ? a : b) in the AST.
+// Only the branch chosen by the condition is evaluated.
+type ConditionalNode struct {
+	nodeSpan
+
+	Condition   ASTNode
+	Consequent  ASTNode
+	Alternative ASTNode
+}
+
+// Evaluate computes the value of the conditional expression.
+func (n *ConditionalNode) Evaluate(ctx context.Context) (any, error) {
+	condition, err := n.Condition.Evaluate(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	b, ok := condition.(bool)
+	if !ok {
+		return nil, locate(errConditionOperand, n.span)
+	}
+
+	if b {
+		return n.Consequent.Evaluate(ctx)
+	}
+
+	return n.Alternative.Evaluate(ctx)
+}
+
+func (n *ConditionalNode) String() string {
+	return fmt.Sprintf("(%s ? %s : %s)", n.Condition.String(), n.Consequent.String(), n.Alternative.String())
+}
+
+// GoTemplate returns the Go template representation of the conditional
+// expression, using the ternary helper (as known from sprig): ternary a b cond.
+func (n *ConditionalNode) GoTemplate() string {
+	return fmt.Sprintf("ternary ( %s ) ( %s ) ( %s )", n.Consequent.GoTemplate(), n.Alternative.GoTemplate(), n.Condition.GoTemplate())
+}
+
+// NullLiteralNode represents the null literal in the AST.
+type NullLiteralNode struct {
+	nodeSpan
+}
+
+// Evaluate computes the value of the null literal.
+func (n *NullLiteralNode) Evaluate(ctx context.Context) (any, error) {
+	return nil, nil
+}
+
+func (n *NullLiteralNode) String() string {
+	return "null"
+}
+
+// GoTemplate returns the Go template representation of the null literal.
+func (n *NullLiteralNode) GoTemplate() string {
+	return "nil"
+}
+
+// NullCoalesceNode represents the null-coalescing operation (a ?? b) in the AST.
+// It evaluates to the left operand unless that is null or an undefined
+// variable, in which case the right operand is evaluated.
+type NullCoalesceNode struct {
+	nodeSpan
+
+	Left  ASTNode
+	Right ASTNode
+}
+
+// Evaluate computes the value of the null-coalescing operation.
+func (n *NullCoalesceNode) Evaluate(ctx context.Context) (any, error) {
+	leftEval, err := evaluateOptional(ctx, n.Left)
+	if err != nil {
+		return nil, err
+	}
+
+	if leftEval != nil {
+		return leftEval, nil
+	}
+
+	return n.Right.Evaluate(ctx)
+}
+
+func (n *NullCoalesceNode) String() string {
+	return fmt.Sprintf("(%s ?? %s)", n.Left.String(), n.Right.String())
+}
+
+// GoTemplate returns the Go template representation of the null-coalescing
+// operation, using the coalesce helper (as known from sprig).
+func (n *NullCoalesceNode) GoTemplate() string {
+	return fmt.Sprintf("coalesce ( %s ) ( %s )", n.Left.GoTemplate(), n.Right.GoTemplate())
+}
+
+// OptionalChainNode represents optional navigation (a?.b.c) in the AST. It
+// evaluates to null instead of failing when the object is null or undefined,
+// or when the path does not exist.
+type OptionalChainNode struct {
+	nodeSpan
+
+	Object ASTNode
+	Path   []string
+}
+
+// Evaluate computes the value of the optional navigation.
+func (n *OptionalChainNode) Evaluate(ctx context.Context) (result any, err error) {
+	defer func() {
+		if getterErr := recoverGetter(recover()); getterErr != nil {
+			result, err = nil, locate(getterErr, n.span)
+		}
+	}()
+
+	object, err := evaluateOptional(ctx, n.Object)
+	if err != nil {
+		return nil, err
+	}
+
+	return lookupOptional(object, n.Path), nil
+}
+
+// lookupOptional traverses the object following the path, returning null when
+// the object is null or the path does not exist.
+func lookupOptional(object any, path []string) any {
+	if object == nil {
+		return nil
+	}
+
+	value, exists := lookupFields(object, path)
+	if !exists {
+		return nil
+	}
+
+	return value
+}
+
+func (n *OptionalChainNode) String() string {
+	return fmt.Sprintf("%s?.%s", n.Object.String(), strings.Join(n.Path, "."))
+}
+
+// GoTemplate returns the Go template representation of the optional
+// navigation. Go templates already yield no value for missing map keys.
+func (n *OptionalChainNode) GoTemplate() string {
+	switch n.Object.(type) {
+	case *VariableNode, *OptionalChainNode:
+		return fmt.Sprintf("%s.%s", n.Object.GoTemplate(), strings.Join(n.Path, "."))
+	default:
+		return fmt.Sprintf("(%s).%s", n.Object.GoTemplate(), strings.Join(n.Path, "."))
+	}
+}
+
+// evaluateOptional evaluates the node, treating an undefined variable as null.
+func evaluateOptional(ctx context.Context, node ASTNode) (any, error) {
+	value, err := node.Evaluate(ctx)
+	if err != nil {
+		var undefined *UndefinedVariableError
+		if _, ok := node.(*VariableNode); ok && errors.As(err, &undefined) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	return value, nil
+}
+
 // BooleanLiteralNode represents a boolean literal in the AST.
 type BooleanLiteralNode struct {
+	nodeSpan
+
 	Value bool
 }
 
@@ -296,6 +906,8 @@ func (n *BooleanLiteralNode) GoTemplate() string {
 }
 
 type FunctionCallNode struct {
+	nodeSpan
+
 	FunctionName string
 	Arguments    []ASTNode
 }
@@ -310,12 +922,31 @@ func (n *FunctionCallNode) Evaluate(ctx context.Context) (any, error) {
 		args[i] = val
 	}
 
-	f, ok := BuiltinFunctions[n.FunctionName]
-	if ok {
-		return f(ctx, args...)
+	result, err := callFunction(ctx, n.FunctionName, nil, args)
+	if err != nil {
+		return nil, locate(err, n.span)
 	}
 
-	return nil, fmt.Errorf("unknown function: %s", n.FunctionName)
+	return result, nil
+}
+
+// callFunction calls the function with the already evaluated arguments. When fn
+// is nil the function is looked up by name in the engine evaluating the
+// expression.
+func callFunction(ctx context.Context, name string, fn bifFunc, args []any) (any, error) {
+	if fn == nil {
+		fn, _ = engineFrom(ctx).function(name)
+	}
+
+	if fn == nil {
+		return nil, &UnknownFunctionError{Name: name}
+	}
+
+	if err := normalizeArgs(ctx, args); err != nil {
+		return nil, err
+	}
+
+	return fn(ctx, args...)
 }
 
 func (n *FunctionCallNode) String() string {
@@ -345,7 +976,20 @@ const (
 	arrayTypeAny    arrayType = "any"
 )
 
+// arrayTypes lists the known array types.
+var arrayTypes = []arrayType{arrayTypeAny, arrayTypeInt, arrayTypeFloat, arrayTypeString, arrayTypeTime}
+
+// valid reports whether the array type is one of the known array types.
+func (t arrayType) valid() bool {
+	return slices.Contains(arrayTypes, t)
+}
+
+// ArrayNode represents an array literal in the AST. A typed array literal,
+// int[...], float[...], string[...] or time[...], evaluates to a slice of that
+// type; any[...] and [...] evaluate to []any.
 type ArrayNode struct {
+	nodeSpan
+
 	Elements []ASTNode
 	Type     arrayType
 }
@@ -360,9 +1004,66 @@ func (n *ArrayNode) Evaluate(ctx context.Context) (any, error) {
 		elements = append(elements, val)
 	}
 
+	result, err := typedArray(n.Type, elements)
+	if err != nil {
+		return nil, locate(err, n.span)
+	}
+
+	return result, nil
+}
+
+// typedArray converts the elements to a slice of the array type. Ints are
+// coerced to floats in a float array, any other element of the wrong type is
+// an error.
+func typedArray(t arrayType, elements []any) (any, error) {
+	switch t {
+	case arrayTypeInt:
+		return convertArray(t, elements, func(v any) (int, bool) {
+			n, _ := normalizeNumber(v)
+			i, ok := n.(int)
+			return i, ok
+		})
+	case arrayTypeFloat:
+		return convertArray(t, elements, func(v any) (float64, bool) {
+			n, _ := normalizeNumber(v)
+			switch f := n.(type) {
+			case float64:
+				return f, true
+			case int:
+				return float64(f), true
+			}
+			return 0, false
+		})
+	case arrayTypeString:
+		return convertArray(t, elements, func(v any) (string, bool) {
+			s, ok := v.(string)
+			return s, ok
+		})
+	case arrayTypeTime:
+		return convertArray(t, elements, func(v any) (time.Time, bool) {
+			tm, ok := v.(time.Time)
+			return tm, ok
+		})
+	}
+
 	return elements, nil
 }
 
+// convertArray converts every element with convert, or reports the first
+// element that cannot be converted.
+func convertArray[T any](t arrayType, elements []any, convert func(any) (T, bool)) ([]T, error) {
+	typed := make([]T, len(elements))
+	for i, v := range elements {
+		value, ok := convert(v)
+		if !ok {
+			return nil, fmt.Errorf("element %d of %s array must be %s, got %T(%v)", i, t, t, v, v)
+		}
+		typed[i] = value
+	}
+
+	return typed, nil
+}
+
 func (n *ArrayNode) String() string {
 	var elements []string
 	for _, element := range n.Elements {
@@ -381,6 +1082,477 @@ func (n *ArrayNode) GoTemplate() string {
 	return fmt.Sprintf("[%s]", strings.Join(elements, ", "))
 }
 
+// LambdaNode represents a lambda expression ((x, i) => x * i) in the AST. It
+// evaluates to a *Lambda closing over the context it is evaluated in.
+type LambdaNode struct {
+	nodeSpan
+
+	Params []string
+	Body   ASTNode
+}
+
+// Evaluate creates the closure.
+func (n *LambdaNode) Evaluate(ctx context.Context) (any, error) {
+	return &Lambda{params: n.Params, body: n.Body, ctx: ctx}, nil
+}
+
+func (n *LambdaNode) String() string {
+	return fmt.Sprintf("(%s) => %s", strings.Join(n.Params, ", "), n.Body.String())
+}
+
+// GoTemplate returns the lambda with its body as Go template. Go templates have
+// no lambdas, so the result is not a valid template on its own.
+func (n *LambdaNode) GoTemplate() string {
+	return fmt.Sprintf("(%s) => %s", strings.Join(n.Params, ", "), n.Body.GoTemplate())
+}
+
+// MapNode represents a map literal ({ "key": value }) in the AST. The keys are
+// kept in the order they were written.
+type MapNode struct {
+	nodeSpan
+
+	Keys   []string
+	Values []ASTNode
+}
+
+// Evaluate computes the map, evaluating the values in order.
+func (n *MapNode) Evaluate(ctx context.Context) (any, error) {
+	result := make(map[string]any, len(n.Keys))
+	for i, key := range n.Keys {
+		val, err := n.Values[i].Evaluate(ctx)
+		if err != nil {
+			return nil, err
+		}
+		result[key] = val
+	}
+
+	return result, nil
+}
+
+func (n *MapNode) String() string {
+	entries := make([]string, len(n.Keys))
+	for i, key := range n.Keys {
+		entries[i] = fmt.Sprintf("%q: %s", key, n.Values[i].String())
+	}
+
+	return fmt.Sprintf("{%s}", strings.Join(entries, ", "))
+}
+
+// GoTemplate returns the Go template representation of the map, a dict call.
+func (n *MapNode) GoTemplate() string {
+	var sb strings.Builder
+	sb.WriteString("dict")
+	for i, key := range n.Keys {
+		fmt.Fprintf(&sb, " %q %s", key, templateOperand(n.Values[i]))
+	}
+
+	return sb.String()
+}
+
+// IndexNode represents an index expression (a[i]) in the AST. Arrays and
+// strings are indexed by position, negative positions count from the end, and
+// maps are indexed by key.
+type IndexNode struct {
+	nodeSpan
+
+	Object ASTNode
+	Index  ASTNode
+}
+
+// Evaluate computes the value of the index expression.
+func (n *IndexNode) Evaluate(ctx context.Context) (any, error) {
+	object, err := n.Object.Evaluate(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	index, err := n.Index.Evaluate(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := indexValue(object, index)
+	if err != nil {
+		return nil, locate(err, n.span)
+	}
+
+	return result, nil
+}
+
+func (n *IndexNode) String() string {
+	return fmt.Sprintf("%s[%s]", n.Object.String(), n.Index.String())
+}
+
+// GoTemplate returns the Go template representation of the index expression.
+func (n *IndexNode) GoTemplate() string {
+	return fmt.Sprintf("index %s %s", templateOperand(n.Object), templateOperand(n.Index))
+}
+
+// SliceNode represents a slice expression (a[i:j]) in the AST. Both bounds are
+// optional and follow the semantics of the slice function.
+type SliceNode struct {
+	nodeSpan
+
+	Object ASTNode
+	Start  ASTNode // nil when omitted
+	End    ASTNode // nil when omitted
+}
+
+// Evaluate computes the value of the slice expression.
+func (n *SliceNode) Evaluate(ctx context.Context) (any, error) {
+	object, err := n.Object.Evaluate(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var start, end any
+	if n.Start != nil {
+		if start, err = n.Start.Evaluate(ctx); err != nil {
+			return nil, err
+		}
+	}
+	if n.End != nil {
+		if end, err = n.End.Evaluate(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	result, err := sliceValue(object, start, end)
+	if err != nil {
+		return nil, locate(err, n.span)
+	}
+
+	return result, nil
+}
+
+func (n *SliceNode) String() string {
+	var start, end string
+	if n.Start != nil {
+		start = n.Start.String()
+	}
+	if n.End != nil {
+		end = n.End.String()
+	}
+
+	return fmt.Sprintf("%s[%s:%s]", n.Object.String(), start, end)
+}
+
+// GoTemplate returns the Go template representation of the slice expression.
+func (n *SliceNode) GoTemplate() string {
+	start := "0"
+	if n.Start != nil {
+		start = templateOperand(n.Start)
+	}
+
+	if n.End == nil {
+		return fmt.Sprintf("slice %s %s", templateOperand(n.Object), start)
+	}
+
+	return fmt.Sprintf("slice %s %s %s", templateOperand(n.Object), start, templateOperand(n.End))
+}
+
+// ErrorNode is the placeholder for a part of the expression that could not be
+// parsed. Parse returns a tree with error nodes next to the diagnostics, so
+// that tools can still work with the parts that did parse. Nodes holds those
+// parts when the error node stands for a sequence the parser could not join
+// into one expression.
+type ErrorNode struct {
+	nodeSpan
+
+	Nodes []ASTNode
+}
+
+// Evaluate always fails, an expression with a syntax error has no value.
+func (n *ErrorNode) Evaluate(ctx context.Context) (any, error) {
+	return nil, locate(ErrSyntax, n.span)
+}
+
+func (n *ErrorNode) String() string {
+	if len(n.Nodes) == 0 {
+		return "<error>"
+	}
+
+	parts := make([]string, len(n.Nodes))
+	for i, node := range n.Nodes {
+		parts[i] = node.String()
+	}
+
+	return fmt.Sprintf("<error>(%s)", strings.Join(parts, ", "))
+}
+
+// GoTemplate returns an empty string, an error node has no Go template
+// representation.
+func (n *ErrorNode) GoTemplate() string {
+	return ""
+}
+
+// templateOperand returns the Go template representation of the node, wrapped
+// in parentheses when it is not a single operand.
+func templateOperand(node ASTNode) string {
+	switch node.(type) {
+	case *IntLiteralNode, *FloatLiteralNode, *DurationLiteralNode, *StringLiteralNode, *BooleanLiteralNode, *NullLiteralNode, *VariableNode, *OptionalChainNode:
+		return node.GoTemplate()
+	default:
+		return fmt.Sprintf("(%s)", node.GoTemplate())
+	}
+}
+
+// indexValue returns the element of the object at the index.
+func indexValue(object, index any) (result any, err error) {
+	defer func() {
+		if getterErr := recoverGetter(recover()); getterErr != nil {
+			result, err = nil, getterErr
+		}
+	}()
+
+	switch o := object.(type) {
+	case map[string]any:
+		key, ok := index.(string)
+		if !ok {
+			return nil, fmt.Errorf("map index must be a string, got %T(%v)", index, index)
+		}
+
+		value, found := o[key]
+		if !found {
+			return nil, fmt.Errorf("key %q not found", key)
+		}
+		return value, nil
+	case string:
+		runes := []rune(o)
+		i, err := elementIndex(index, len(runes))
+		if err != nil {
+			return nil, err
+		}
+		return string(runes[i]), nil
+	case []any:
+		i, err := elementIndex(index, len(o))
+		if err != nil {
+			return nil, err
+		}
+		return o[i], nil
+	}
+
+	rv := reflect.ValueOf(object)
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		i, err := elementIndex(index, rv.Len())
+		if err != nil {
+			return nil, err
+		}
+		return rv.Index(i).Interface(), nil
+	case reflect.Map:
+		key := reflect.ValueOf(index)
+		if !key.IsValid() || !key.Type().AssignableTo(rv.Type().Key()) {
+			return nil, fmt.Errorf("map index must be a %s, got %T(%v)", rv.Type().Key(), index, index)
+		}
+
+		value := rv.MapIndex(key)
+		if !value.IsValid() {
+			return nil, fmt.Errorf("key %v not found", index)
+		}
+		return value.Interface(), nil
+	case reflect.Struct, reflect.Pointer:
+		name, ok := index.(string)
+		if !ok {
+			return nil, fmt.Errorf("field name must be a string, got %T(%v)", index, index)
+		}
+
+		value, found := fieldValue(object, name)
+		if !found {
+			return nil, fmt.Errorf("field %q not found", name)
+		}
+		return value, nil
+	}
+
+	return nil, fmt.Errorf("type mismatch or operation not applicable (%T(%v)[%T(%v)])", object, object, index, index)
+}
+
+// elementIndex validates the index for a collection of the given length and
+// resolves negative indexes, which count from the end.
+func elementIndex(index any, length int) (int, error) {
+	n, _ := normalizeNumber(index)
+	i, ok := n.(int)
+	if !ok {
+		return 0, fmt.Errorf("index must be an integer, got %T(%v)", index, index)
+	}
+
+	if i < 0 {
+		i += length
+	}
+
+	if i < 0 || i >= length {
+		return 0, fmt.Errorf("index %v out of range [0:%d]", index, length)
+	}
+
+	return i, nil
+}
+
+// sliceBounds resolves the optional, possibly negative, bounds of a slice of a
+// collection with the given length. Bounds beyond the collection are clamped.
+func sliceBounds(start, end any, length int) (int, int, error) {
+	bound := func(v any, def int) (int, error) {
+		if v == nil {
+			return def, nil
+		}
+
+		n, _ := normalizeNumber(v)
+		i, ok := n.(int)
+		if !ok {
+			return 0, fmt.Errorf("slice bounds must be integers, got %T(%v)", v, v)
+		}
+
+		if i < 0 {
+			i += length
+		}
+
+		return max(0, min(i, length)), nil
+	}
+
+	low, err := bound(start, 0)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	high, err := bound(end, length)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if high < low {
+		high = low
+	}
+
+	return low, high, nil
+}
+
+// sliceValue returns the part of the array or string between start and end.
+// A nil bound means the start or the end of the object.
+func sliceValue(object, start, end any) (any, error) {
+	switch o := object.(type) {
+	case string:
+		runes := []rune(o)
+		low, high, err := sliceBounds(start, end, len(runes))
+		if err != nil {
+			return nil, err
+		}
+		return string(runes[low:high]), nil
+	case []any:
+		low, high, err := sliceBounds(start, end, len(o))
+		if err != nil {
+			return nil, err
+		}
+		return o[low:high], nil
+	}
+
+	rv := reflect.ValueOf(object)
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		low, high, err := sliceBounds(start, end, rv.Len())
+		if err != nil {
+			return nil, err
+		}
+
+		if rv.Kind() == reflect.Array && !rv.CanAddr() {
+			copied := reflect.New(rv.Type()).Elem()
+			copied.Set(rv)
+			rv = copied
+		}
+		return rv.Slice(low, high).Interface(), nil
+	}
+
+	return nil, fmt.Errorf("type mismatch or operation not applicable (%T(%v)[%v:%v])", object, object, start, end)
+}
+
+// contains reports whether the collection contains the value. Arrays and
+// slices are searched for an equal element, strings for a substring and maps
+// for a key.
+func contains(collection, value any) (bool, error) {
+	switch c := collection.(type) {
+	case []any:
+		for _, element := range c {
+			if equalValues(element, value) {
+				return true, nil
+			}
+		}
+		return false, nil
+	case string:
+		s, ok := value.(string)
+		if !ok {
+			return false, fmt.Errorf("in operator expects a string to search in a string, got %T(%v)", value, value)
+		}
+		return strings.Contains(c, s), nil
+	case map[string]any:
+		key, ok := value.(string)
+		if !ok {
+			return false, fmt.Errorf("in operator expects a string key to search in a map, got %T(%v)", value, value)
+		}
+		_, found := c[key]
+		return found, nil
+	}
+
+	rv := reflect.ValueOf(collection)
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < rv.Len(); i++ {
+			if equalValues(rv.Index(i).Interface(), value) {
+				return true, nil
+			}
+		}
+		return false, nil
+	case reflect.Map:
+		key := reflect.ValueOf(value)
+		if !key.IsValid() || !key.Type().AssignableTo(rv.Type().Key()) {
+			return false, fmt.Errorf("in operator expects a %s key to search in a map, got %T(%v)", rv.Type().Key(), value, value)
+		}
+		return rv.MapIndex(key).IsValid(), nil
+	}
+
+	return false, fmt.Errorf("type mismatch or operation not applicable (%T(%v), %s, %T(%v))", value, value, TokenTypeIn, collection, collection)
+}
+
+// equalValues reports whether the values are equal following the semantics
+// of the == operator. Values that cannot be compared are not equal.
+func equalValues(left, right any) bool {
+	result, err := evalBinaryOperation(context.Background(), TokenTypeEqual, left, right)
+	if err != nil {
+		return false
+	}
+
+	equal, _ := result.(bool)
+	return equal
+}
+
+// equalMaps reports whether both maps have the same keys with equal values.
+func equalMaps(left, right map[string]any) bool {
+	if len(left) != len(right) {
+		return false
+	}
+
+	for key, l := range left {
+		r, ok := right[key]
+		if !ok || !equalValues(l, r) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// equalArrays reports whether both arrays have equal elements in the same order.
+func equalArrays(left, right []any) bool {
+	if len(left) != len(right) {
+		return false
+	}
+
+	for i := range left {
+		if !equalValues(left[i], right[i]) {
+			return false
+		}
+	}
+
+	return true
+}
+
 // applyStringComparison applies the comparison operator to the two strings.
 func applyStringComparison(left, right string, op TokenType) bool {
 	switch op {
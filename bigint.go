@@ -0,0 +1,199 @@
+package expronaut
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+)
+
+// MaxBigIntBits limits the size of the integers created in big integer mode,
+// so that an expression such as 2 ** 1000000000 fails instead of exhausting
+// the memory.
+var MaxBigIntBits = 1 << 20
+
+// bigIntKey is the context key of the big integer mode.
+type bigIntKey struct{}
+
+// WithBigInt returns a context in which expressions are evaluated in big
+// integer mode: integer arithmetic, shifts and negation that would overflow
+// an int result in a *big.Int instead of an error, and an int raised to a
+// non-negative int is an exact integer instead of a float64. Results that fit
+// in an int are still an int.
+func WithBigInt(ctx context.Context) context.Context {
+	return context.WithValue(ctx, bigIntKey{}, true)
+}
+
+// bigIntMode reports whether the context is in big integer mode.
+func bigIntMode(ctx context.Context) bool {
+	if ctx == nil {
+		return false
+	}
+
+	enabled, _ := ctx.Value(bigIntKey{}).(bool)
+	return enabled
+}
+
+// normalizeOperand normalizes the number like normalizeNumber. In big integer
+// mode an integer that does not fit in an int becomes a *big.Int instead of
+// an ErrIntegerOverflow.
+func normalizeOperand(ctx context.Context, v any) (any, error) {
+	n, err := normalizeNumber(v)
+	if errors.Is(err, ErrIntegerOverflow) && bigIntMode(ctx) {
+		if b, ok := toBigInt(v); ok {
+			return b, nil
+		}
+	}
+
+	return n, err
+}
+
+// normalizeComparand normalizes an operand of a comparison like
+// normalizeOperand, but an integer that does not fit in an int becomes a
+// *big.Int in any mode, since comparing it does not lose its value.
+func normalizeComparand(ctx context.Context, v any) (any, error) {
+	n, err := normalizeNumber(v)
+	if errors.Is(err, ErrIntegerOverflow) {
+		if b, ok := toBigInt(v); ok {
+			return b, nil
+		}
+	}
+
+	return n, err
+}
+
+// toBigInt converts an integer of any type to a *big.Int.
+func toBigInt(v any) (*big.Int, bool) {
+	switch n := v.(type) {
+	case *big.Int:
+		return n, n != nil
+	case int:
+		return big.NewInt(int64(n)), true
+	case int64:
+		return big.NewInt(n), true
+	case uint:
+		return new(big.Int).SetUint64(uint64(n)), true
+	case uint32:
+		return new(big.Int).SetUint64(uint64(n)), true
+	case uint64:
+		return new(big.Int).SetUint64(n), true
+	case json.Number:
+		return new(big.Int).SetString(string(n), 10)
+	}
+
+	return nil, false
+}
+
+// bigOperands returns the operands as *big.Int when at least one of them is
+// a *big.Int and the other one is an integer.
+func bigOperands(left, right any) (*big.Int, *big.Int, bool) {
+	_, l := left.(*big.Int)
+	_, r := right.(*big.Int)
+	if !l && !r {
+		return nil, nil, false
+	}
+
+	a, okA := toBigInt(left)
+	b, okB := toBigInt(right)
+
+	return a, b, okA && okB
+}
+
+// demoteBigInt returns the integer as an int when it fits.
+func demoteBigInt(n *big.Int) any {
+	if n.IsInt64() && n.Int64() >= math.MinInt && n.Int64() <= math.MaxInt {
+		return int(n.Int64())
+	}
+
+	return n
+}
+
+// bigIntFloat returns the float64 nearest to the integer.
+func bigIntFloat(n *big.Int) float64 {
+	f, _ := new(big.Float).SetInt(n).Float64()
+	return f
+}
+
+// bigIntArithmetic applies an arithmetic operator to two big integers. A
+// negative exponent results in a float64, like it does for ints.
+func bigIntArithmetic(op TokenType, a, b *big.Int) (any, error) {
+	z := new(big.Int)
+
+	switch op {
+	case TokenTypePlus:
+		z.Add(a, b)
+	case TokenTypeMinus:
+		z.Sub(a, b)
+	case TokenTypeMultiply:
+		z.Mul(a, b)
+	case TokenTypeDivide, TokenTypeDivideInteger:
+		if b.Sign() == 0 {
+			return nil, fmt.Errorf("integer division by zero")
+		}
+		z.Quo(a, b)
+	case TokenTypeModulo:
+		if b.Sign() == 0 {
+			return nil, fmt.Errorf("integer modulo by zero")
+		}
+		z.Rem(a, b)
+	case TokenTypeExponent:
+		if b.Sign() < 0 {
+			return math.Pow(bigIntFloat(a), bigIntFloat(b)), nil
+		}
+
+		// the result has at least (bits of a - 1) * b bits
+		if a.CmpAbs(big.NewInt(1)) > 0 && (!b.IsInt64() || b.Int64() > int64(MaxBigIntBits) || int64(a.BitLen()-1)*b.Int64() > int64(MaxBigIntBits)) {
+			return nil, fmt.Errorf("%w: %s ^ %s exceeds %d bits", ErrIntegerOverflow, a, b, MaxBigIntBits)
+		}
+		z.Exp(a, b, nil)
+	default:
+		return nil, fmt.Errorf("unknown or unsupported operator: %v", op)
+	}
+
+	if z.BitLen() > MaxBigIntBits {
+		return nil, fmt.Errorf("%w: result of %s exceeds %d bits", ErrIntegerOverflow, op, MaxBigIntBits)
+	}
+
+	return demoteBigInt(z), nil
+}
+
+// bigIntShift returns a shifted left (op <<) or right (op >>) by n bits.
+func bigIntShift(op TokenType, a *big.Int, n int) (any, error) {
+	if n < 0 {
+		return nil, fmt.Errorf("negative shift count %d", n)
+	}
+
+	if op == TokenTypeRightShift {
+		return demoteBigInt(new(big.Int).Rsh(a, uint(n))), nil
+	}
+
+	if a.Sign() != 0 && (n > MaxBigIntBits || a.BitLen()+n > MaxBigIntBits) {
+		return nil, fmt.Errorf("%w: %s << %d exceeds %d bits", ErrIntegerOverflow, a, n, MaxBigIntBits)
+	}
+
+	return demoteBigInt(new(big.Int).Lsh(a, uint(n))), nil
+}
+
+// applyBigIntComparison compares two big integers.
+func applyBigIntComparison(left, right *big.Int, op TokenType) bool {
+	cmp := left.Cmp(right)
+
+	switch op {
+	case TokenTypeEqual:
+		return cmp == 0
+	case TokenTypeNotEqual:
+		return cmp != 0
+	case TokenTypeLessThan:
+		return cmp < 0
+	case TokenTypeLessThanOrEqual:
+		return cmp <= 0
+	case TokenTypeGreaterThan:
+		return cmp > 0
+	case TokenTypeGreaterThanOrEqual:
+		return cmp >= 0
+	}
+
+	return false
+}
@@ -0,0 +1,151 @@
+package expronaut
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strings"
+	"testing"
+)
+
+func TestBigIntMode(t *testing.T) {
+	huge, _ := new(big.Int).SetString("123456789012345678901234567890", 10)
+
+	ctx := WithBigInt(SetVariables(context.TODO(), map[string]any{
+		"max":   math.MaxInt,
+		"min":   math.MinInt,
+		"u64":   uint64(math.MaxUint64),
+		"huge":  huge,
+		"small": big.NewInt(42),
+	}))
+
+	inputs := map[string]string{
+		`max + 1`:         "*big.Int 9223372036854775808",
+		`min - 1`:         "*big.Int -9223372036854775809",
+		`max * max`:       "*big.Int 85070591730234615847396907784232501249",
+		`(max + 1) - 1`:   "int 9223372036854775807",
+		`-min`:            "*big.Int 9223372036854775808",
+		`min / -1`:        "*big.Int 9223372036854775808",
+		`1 << 64`:         "*big.Int 18446744073709551616",
+		`(1 << 64) >> 60`: "int 16",
+		`2 ** 100`:        "*big.Int 1267650600228229401496703205376",
+		`pow(2, 100)`:     "*big.Int 1267650600228229401496703205376",
+		`exp(3, 4)`:       "int 81",
+		`2 ^ -1`:          "float64 0.5",
+		`u64 + 1`:         "*big.Int 18446744073709551616",
+		`u64 > max`:       "bool true",
+		`huge % 1000`:     "int 890",
+		`huge // bigint("10000000000000000000000000")`: "int 12345",
+		`huge * 2 == huge + huge`:                      "bool true",
+		`huge > 1.5`:                                   "bool true",
+		`huge / 1e20`:                                  "float64 1.2345678901234567e+09",
+		`-huge`:                                        "*big.Int -123456789012345678901234567890",
+		`abs(-huge)`:                                   "*big.Int 123456789012345678901234567890",
+		`small + 1`:                                    "int 43",
+		`bigint("98765432109876543210") + 1`:           "*big.Int 98765432109876543211",
+		`bigint("12")`:                                 "int 12",
+		`max + 1 == bigint("9223372036854775808")`: "bool true",
+	}
+
+	for input, expected := range inputs {
+		program, err := Compile(input)
+		if err != nil {
+			t.Errorf("%s: %v", input, err)
+			continue
+		}
+
+		for _, run := range []func() (any, error){
+			func() (any, error) { return program.Run(ctx, nil) },
+			func() (any, error) { return program.Tree().Evaluate(ctx) },
+		} {
+			out, err := run()
+			if err != nil {
+				t.Errorf("%s: %v", input, err)
+				continue
+			}
+
+			if got := fmt.Sprintf("%T %v", out, out); got != expected {
+				t.Errorf("%s: expected %s, got %s", input, expected, got)
+			}
+		}
+	}
+}
+
+func TestBigIntWithoutMode(t *testing.T) {
+	huge, _ := new(big.Int).SetString("123456789012345678901234567890", 10)
+
+	ctx := SetVariables(context.TODO(), map[string]any{"huge": huge})
+
+	inputs := map[string]string{
+		`huge + 1`:              "*big.Int 123456789012345678901234567891",
+		`huge > 0`:              "bool true",
+		`2 ** 10`:               "float64 1024",
+		`bigint("10") * 2`:      "int 20",
+		`bigint(1e3)`:           "int 1000",
+		`bigint(decimal("42"))`: "int 42",
+		`bigint(" 123456789012345678901234567890 ") == huge`: "bool true",
+	}
+
+	for input, expected := range inputs {
+		out, err := Evaluate(ctx, input)
+		if err != nil {
+			t.Errorf("%s: %v", input, err)
+			continue
+		}
+
+		if got := fmt.Sprintf("%T %v", out, out); got != expected {
+			t.Errorf("%s: expected %s, got %s", input, expected, got)
+		}
+	}
+
+	if _, err := Evaluate(context.TODO(), `9223372036854775807 + 1`); !errors.Is(err, ErrIntegerOverflow) {
+		t.Errorf("expected ErrIntegerOverflow without big integer mode, got %v", err)
+	}
+}
+
+func TestBigIntErrors(t *testing.T) {
+	ctx := WithBigInt(context.TODO())
+
+	inputs := map[string]string{
+		`bigint("12a")`:          "invalid integer",
+		`bigint(1.5)`:            "expects an integer",
+		`bigint(true)`:           "bigint expects argument 1 (x) of type number or string, got bool",
+		`bigint("1" + "0") // 0`: "integer division by zero",
+		`(1 << 64) % 0`:          "integer modulo by zero",
+		`(1 << 64) << -1`:        "negative shift count",
+		`2 ** 10000000`:          "exceeds",
+		`1 << 10000000`:          "exceeds",
+		`(1 << 64) * "a"`:        "type mismatch",
+	}
+
+	for input, expected := range inputs {
+		_, err := Evaluate(ctx, input)
+		if err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("%s: expected error containing %q, got %v", input, expected, err)
+		}
+	}
+}
+
+func TestNumberLiteralErrors(t *testing.T) {
+	inputs := map[string]string{
+		`99999999999999999999`:     "integer literal 99999999999999999999 does not fit in an int",
+		`1 + 99999999999999999999`: "integer literal 99999999999999999999 does not fit in an int",
+		`1e`:                       "invalid number literal 1e",
+		`1e400`:                    "number literal 1e400 is out of range",
+		`1e400 > 1`:                "number literal 1e400 is out of range",
+		`-1.5e999`:                 "number literal 1.5e999 is out of range",
+	}
+
+	for input, expected := range inputs {
+		_, err := Compile(input)
+		if err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("%s: expected error containing %q, got %v", input, expected, err)
+		}
+	}
+
+	if _, err := Compile(`99999999999999999999`); !errors.Is(err, ErrIntegerOverflow) {
+		t.Errorf("expected ErrIntegerOverflow, got %v", err)
+	}
+}
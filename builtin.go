@@ -8,26 +8,46 @@ import (
 	"fmt"
 	"github.com/donseba/expronaut/llm"
 	"io"
+	"maps"
 	"math"
+	"math/big"
 	"math/rand"
 	"os"
-	"sort"
+	"reflect"
+	"slices"
+	"strings"
 	"time"
 )
 
 type bifFunc func(context.Context, ...any) (any, error)
 type bif map[string]bifFunc
 
+// BuiltinFunctions are the functions of the default engine.
+//
+// Deprecated: modifying the map directly races with evaluation, use
+// RegisterFunction or an Engine instead.
 var BuiltinFunctions = bif{}
 
+// RegisterFunction adds a function to the default engine.
 func RegisterFunction(name string, function bifFunc) {
-	BuiltinFunctions[name] = function
+	defaultEngine.RegisterFunction(name, function)
+}
+
+// DefineFunction adds a function with a signature to the default engine, see
+// Engine.DefineFunction.
+func DefineFunction(name string, signature Signature, function bifFunc) {
+	defaultEngine.DefineFunction(name, signature, function)
 }
 
 func init() {
-	BuiltinFunctions = bif{}
+	BuiltinFunctions = builtins()
+	defaultEngine = newEngine(BuiltinFunctions, maps.Clone(builtinSignatures))
+}
 
-	b := BuiltinFunctions
+// builtins returns a new set of the builtin functions, bound to their
+// signatures.
+func builtins() bif {
+	b := bif{}
 
 	// mathematical functions
 	b["add"] = b.Add       // add two numbers
@@ -57,6 +77,7 @@ func init() {
 	b["abs"] = b.Abs       // absolute value of a number
 	b["double"] = b.Double // double a number
 	b["root"] = b.Root     // nth root of a number
+	b["bigint"] = b.BigInt // convert an integer or string to an arbitrary-precision integer
 
 	b["hypot"] = b.Hypot     // hypotenuse of a right-angled triangle
 	b["deg2rad"] = b.Deg2Rad // convert degrees to radians
@@ -90,6 +111,8 @@ func init() {
 	b["datetime"] = b.DateTime // parse a string into a date and time
 	b["diffdate"] = b.DiffDate // difference between two dates
 	b["difftime"] = b.DiffTime // difference between two times
+	b["duration"] = b.Duration // parse a string into a duration
+	b["now"] = b.Now           // current date and time
 
 	// utility functions
 	b["len"] = b.Len // length of a string or array
@@ -104,12 +127,106 @@ func init() {
 	b["variance"] = b.Variance // variance of two or more numbers
 
 	// monetary functions
-	b["pv"] = b.Pv // present value of an investment at a specified rate of return
-	b["fv"] = b.Fv // future value of an investment at a specified rate of return
+	b["pv"] = b.Pv           // present value of an investment at a specified rate of return
+	b["fv"] = b.Fv           // future value of an investment at a specified rate of return
+	b["decimal"] = b.Decimal // convert a number or string to an exact decimal
 
 	// AI functions
 	b["ai"] = b.Ai           // call an AI provider to generate a response
 	b["predict"] = b.Predict // predict the value of a time series
+
+	for name, signature := range builtinSignatures {
+		b[name] = signature.bind(name, b[name])
+	}
+
+	return b
+}
+
+// builtinSignatures are the signatures of the builtin functions. The
+// arithmetic functions accept the same operands as their operators.
+var builtinSignatures = map[string]Signature{
+	// mathematical functions
+	"add":     {Params: []Param{{Name: "a"}, {Name: "b"}}, Description: "add two numbers"},
+	"sub":     {Params: []Param{{Name: "a"}, {Name: "b"}}, Description: "subtract two numbers"},
+	"mul":     {Params: []Param{{Name: "a"}, {Name: "b"}}, Description: "multiply two numbers"},
+	"div":     {Params: []Param{{Name: "a"}, {Name: "b"}}, Description: "divide two numbers"},
+	"divint":  {Params: []Param{{Name: "a"}, {Name: "b"}}, Description: "divide two numbers and round down to an integer"},
+	"mod":     {Params: []Param{{Name: "a"}, {Name: "b"}}, Description: "modulo of two numbers"},
+	"exp":     {Params: []Param{{Name: "x"}, {Name: "y"}}, Description: "raise a number to the power of another number"},
+	"sqrt":    {Params: []Param{{Name: "x", Type: TypeNumber}}, Result: TypeNumber, Description: "square root of a number"},
+	"pow":     {Params: []Param{{Name: "x", Type: TypeNumber}, {Name: "y", Type: TypeNumber}}, Result: TypeNumber, Description: "raise a number to the power of another number"},
+	"log":     {Params: []Param{{Name: "x", Type: TypeNumber}, {Name: "base", Type: TypeNumber}}, Result: TypeNumber, Description: "logarithm of a number"},
+	"log10":   {Params: []Param{{Name: "x", Type: TypeNumber}}, Result: TypeNumber, Description: "base 10 logarithm of a number"},
+	"log2":    {Params: []Param{{Name: "x", Type: TypeNumber}}, Result: TypeNumber, Description: "base 2 logarithm of a number"},
+	"sin":     {Params: []Param{{Name: "x", Type: TypeNumber}}, Result: TypeNumber, Description: "sine of an angle in radians"},
+	"cos":     {Params: []Param{{Name: "x", Type: TypeNumber}}, Result: TypeNumber, Description: "cosine of an angle in radians"},
+	"tan":     {Params: []Param{{Name: "x", Type: TypeNumber}}, Result: TypeNumber, Description: "tangent of an angle in radians"},
+	"asin":    {Params: []Param{{Name: "x", Type: TypeNumber}}, Result: TypeNumber, Description: "arc sine of a value"},
+	"acos":    {Params: []Param{{Name: "x", Type: TypeNumber}}, Result: TypeNumber, Description: "arc cosine of a value"},
+	"atan":    {Params: []Param{{Name: "x", Type: TypeNumber}}, Result: TypeNumber, Description: "arc tangent of a value"},
+	"sinh":    {Params: []Param{{Name: "x", Type: TypeNumber}}, Result: TypeNumber, Description: "hyperbolic sine of a number"},
+	"cosh":    {Params: []Param{{Name: "x", Type: TypeNumber}}, Result: TypeNumber, Description: "hyperbolic cosine of a number"},
+	"tanh":    {Params: []Param{{Name: "x", Type: TypeNumber}}, Result: TypeNumber, Description: "hyperbolic tangent of a number"},
+	"ceil":    {Params: []Param{{Name: "x", Type: TypeNumber}}, Result: TypeNumber, Description: "round a number up to the nearest integer"},
+	"floor":   {Params: []Param{{Name: "x", Type: TypeNumber}}, Result: TypeNumber, Description: "round a number down to the nearest integer"},
+	"round":   {Params: []Param{{Name: "x", Type: TypeNumber}, {Name: "places", Type: TypeInt, Optional: true}, {Name: "mode", Type: TypeString, Optional: true}}, Result: TypeNumber, Description: "round a number to the nearest integer or to a number of decimal places"},
+	"abs":     {Params: []Param{{Name: "x", Type: TypeNumber}}, Result: TypeNumber, Description: "absolute value of a number"},
+	"double":  {Params: []Param{{Name: "x", Type: TypeNumber}}, Result: TypeNumber, Description: "double a number"},
+	"root":    {Params: []Param{{Name: "x", Type: TypeNumber}, {Name: "n", Type: TypeNumber}}, Result: TypeNumber, Description: "nth root of a number"},
+	"bigint":  {Params: []Param{{Name: "x", Type: TypeNumber | TypeString}}, Result: TypeInt, Description: "convert an integer or string to an arbitrary-precision integer"},
+	"hypot":   {Params: []Param{{Name: "a", Type: TypeNumber}, {Name: "b", Type: TypeNumber}}, Result: TypeNumber, Description: "hypotenuse of a right-angled triangle"},
+	"deg2rad": {Params: []Param{{Name: "x", Type: TypeNumber}}, Result: TypeNumber, Description: "convert degrees to radians"},
+	"rad2deg": {Params: []Param{{Name: "x", Type: TypeNumber}}, Result: TypeNumber, Description: "convert radians to degrees"},
+
+	// statistical functions
+	"mean":     {Params: []Param{{Name: "values", Type: TypeNumber | TypeArray, Variadic: true}}, Result: TypeNumber, Description: "mean of one or more numbers"},
+	"median":   {Params: []Param{{Name: "values", Type: TypeNumber | TypeArray, Variadic: true}}, Result: TypeNumber, Description: "median of one or more numbers"},
+	"stddev":   {Params: []Param{{Name: "values", Type: TypeNumber | TypeArray, Variadic: true}}, Result: TypeNumber, Description: "standard deviation of one or more numbers"},
+	"max":      {Params: []Param{{Name: "values", Type: TypeNumber | TypeArray, Variadic: true}}, Result: TypeNumber, Description: "maximum of one or more numbers"},
+	"min":      {Params: []Param{{Name: "values", Type: TypeNumber | TypeArray, Variadic: true}}, Result: TypeNumber, Description: "minimum of one or more numbers"},
+	"mode":     {Params: []Param{{Name: "values", Type: TypeNumber | TypeArray, Variadic: true}}, Result: TypeNumber, Description: "mode of one or more numbers"},
+	"variance": {Params: []Param{{Name: "values", Type: TypeNumber | TypeArray, Variadic: true}}, Result: TypeNumber, Description: "sample variance of two or more numbers"},
+
+	// array functions
+	"filter":  {Params: []Param{{Name: "array", Type: TypeArray}, {Name: "predicate", Type: TypeFunction | TypeString}}, Result: TypeArray, Description: "filter an array based on a condition"},
+	"map":     {Params: []Param{{Name: "array", Type: TypeArray}, {Name: "fn", Type: TypeFunction | TypeString}}, Result: TypeArray, Description: "apply a function to each element of an array"},
+	"reduce":  {Params: []Param{{Name: "array", Type: TypeArray}, {Name: "fn", Type: TypeFunction | TypeString}, {Name: "initial", Optional: true}}, Description: "reduce an array to a single value"},
+	"sum":     {Params: []Param{{Name: "values", Type: TypeNumber | TypeArray, Variadic: true}}, Result: TypeNumber, Description: "sum of one or more numbers"},
+	"shuffle": {Params: []Param{{Name: "array", Type: TypeArray}}, Result: TypeArray, Description: "shuffle an array"},
+	"concat":  {Params: []Param{{Name: "a", Type: TypeString}, {Name: "b", Type: TypeString, Variadic: true}}, Result: TypeString, Description: "concatenate two or more strings"},
+	"reverse": {Params: []Param{{Name: "value", Type: TypeString | TypeArray}}, Result: TypeString | TypeArray, Description: "reverse a string or an array"},
+	"sort":    {Params: []Param{{Name: "array", Type: TypeArray}}, Result: TypeArray, Description: "sort an array"},
+	"unique":  {Params: []Param{{Name: "array", Type: TypeArray}}, Result: TypeArray, Description: "remove duplicate elements from an array"},
+	"slice":   {Params: []Param{{Name: "value", Type: TypeArray | TypeString}, {Name: "start", Type: TypeInt}, {Name: "end", Type: TypeInt, Optional: true}}, Result: TypeArray | TypeString, Description: "slice an array or a string"},
+
+	// random functions
+	"rand": {Params: []Param{{Name: "type", Type: TypeString}, {Name: "n", Type: TypeInt, Optional: true}}, Result: TypeNumber, Description: "generate a random int or float64, below n when it is given"},
+
+	// date and time functions
+	"date":     {Params: []Param{{Name: "value", Type: TypeString}}, Result: TypeTime, Description: "parse a string into a date"},
+	"time":     {Params: []Param{{Name: "value", Type: TypeString}}, Result: TypeTime, Description: "parse a string into a time"},
+	"datetime": {Params: []Param{{Name: "value", Type: TypeString}}, Result: TypeTime, Description: "parse a string into a date and time"},
+	"diffdate": {Params: []Param{{Name: "a", Type: TypeTime}, {Name: "b", Type: TypeTime}}, Result: TypeDuration, Description: "difference between two dates"},
+	"difftime": {Params: []Param{{Name: "a", Type: TypeTime}, {Name: "b", Type: TypeTime}}, Result: TypeDuration, Description: "difference between two times"},
+	"duration": {Params: []Param{{Name: "value", Type: TypeString | TypeDuration}}, Result: TypeDuration, Description: "parse a string into a duration"},
+	"now":      {Result: TypeTime, Description: "current date and time"},
+
+	// utility functions
+	"len": {Params: []Param{{Name: "value", Type: TypeString | TypeArray}}, Result: TypeInt, Description: "length of a string or array"},
+	"env": {Params: []Param{{Name: "name", Type: TypeString}}, Result: TypeString, Description: "get an environment variable"},
+
+	// hashing functions
+	"sha256": {Params: []Param{{Name: "value", Type: TypeString | TypeNumber}}, Result: TypeString, Description: "SHA-256 hash"},
+	"sha512": {Params: []Param{{Name: "value", Type: TypeString | TypeNumber}}, Result: TypeString, Description: "SHA-512 hash"},
+
+	// monetary functions
+	"pv":      {Params: []Param{{Name: "value", Type: TypeNumber}, {Name: "rate", Type: TypeNumber}, {Name: "periods", Type: TypeNumber}}, Result: TypeNumber, Description: "present value of an investment at a specified rate of return"},
+	"fv":      {Params: []Param{{Name: "value", Type: TypeNumber}, {Name: "rate", Type: TypeNumber}, {Name: "periods", Type: TypeNumber}}, Result: TypeNumber, Description: "future value of an investment at a specified rate of return"},
+	"decimal": {Params: []Param{{Name: "value", Type: TypeNumber | TypeString}}, Result: TypeDecimal, Description: "convert a number or string to an exact decimal"},
+
+	// AI functions
+	"ai":      {Params: []Param{{Name: "provider", Type: TypeString}, {Name: "prompt", Variadic: true}}, Description: "call an AI provider to generate a response"},
+	"predict": {Params: []Param{{Name: "provider", Type: TypeString}, {Name: "series"}}, Description: "predict the value of a time series"},
 }
 
 // Abs Calculates the absolute value of a number.
@@ -123,6 +240,8 @@ func (bif bif) Abs(ctx context.Context, args ...any) (any, error) {
 		return int(math.Abs(float64(arg))), nil
 	case float64:
 		return math.Abs(arg), nil
+	case *big.Int:
+		return new(big.Int).Abs(arg), nil
 	default:
 		return nil, fmt.Errorf("abs function expects a number argument")
 	}
@@ -150,28 +269,13 @@ func (bif bif) Add(ctx context.Context, args ...any) (any, error) {
 		return nil, fmt.Errorf("add function expects exactly two arguments got %d", len(args))
 	}
 
-	switch a := args[0].(type) {
-	case int:
-		switch b := args[1].(type) {
-		case int:
-			return a + b, nil
-		case float64:
-			return float64(a) + b, nil
-		}
-	case float64:
-		switch b := args[1].(type) {
-		case int:
-			return a + float64(b), nil
-		case float64:
-			return a + b, nil
-		}
-	case string:
-		switch b := args[1].(type) {
-		case string:
+	if a, ok := args[0].(string); ok {
+		if b, ok := args[1].(string); ok {
 			return a + b, nil
 		}
 	}
-	return nil, nil
+
+	return arithmetic(ctx, TokenTypePlus, args[0], args[1])
 }
 
 // Ai Calls an AI provider to generate a response.
@@ -190,7 +294,7 @@ func (bif bif) Ai(ctx context.Context, args ...any) (any, error) {
 		return llm.ChatGPT(args[1:])
 	}
 
-	return nil, nil
+	return nil, fmt.Errorf("ai function does not support the provider %s", llmProvider)
 }
 
 // Asin Computes the arc sine of a value; returns the angle in radians.
@@ -225,6 +329,38 @@ func (bif bif) Atan(ctx context.Context, args ...any) (any, error) {
 	}
 }
 
+// BigInt Converts an integer, or a string of digits, to an arbitrary-precision
+// integer. Integers that fit in an int are returned as an int.
+func (bif bif) BigInt(ctx context.Context, args ...any) (any, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("bigint function expects a single argument")
+	}
+
+	switch arg := args[0].(type) {
+	case int, *big.Int:
+		return arg, nil
+	case string:
+		n, ok := new(big.Int).SetString(strings.TrimSpace(arg), 10)
+		if !ok {
+			return nil, fmt.Errorf("invalid integer %q", arg)
+		}
+		return demoteBigInt(n), nil
+	case float64:
+		if math.IsInf(arg, 0) || arg != math.Trunc(arg) {
+			return nil, fmt.Errorf("bigint function expects an integer, got %v", arg)
+		}
+		n, _ := big.NewFloat(arg).Int(nil)
+		return demoteBigInt(n), nil
+	case Decimal:
+		if !arg.IsInteger() {
+			return nil, fmt.Errorf("bigint function expects an integer, got %v", arg)
+		}
+		return demoteBigInt(new(big.Int).Set(arg.Rat().Num())), nil
+	}
+
+	return nil, fmt.Errorf("bigint function expects an integer or string argument")
+}
+
 // Ceil Rounds a number up to the nearest integer.
 func (bif bif) Ceil(ctx context.Context, args ...any) (any, error) {
 	if len(args) != 1 {
@@ -235,7 +371,7 @@ func (bif bif) Ceil(ctx context.Context, args ...any) (any, error) {
 	case int:
 		return arg, nil
 	case float64:
-		return int(math.Ceil(arg)), nil
+		return floatToInt(math.Ceil(arg))
 	default:
 		return nil, fmt.Errorf("ceil function expects a number argument")
 	}
@@ -330,6 +466,26 @@ func (bif bif) DateTime(ctx context.Context, args ...any) (any, error) {
 	return t, nil
 }
 
+// Decimal Converts a number or a string to an exact decimal.
+func (bif bif) Decimal(ctx context.Context, args ...any) (any, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("decimal function expects a single argument")
+	}
+
+	switch arg := args[0].(type) {
+	case string:
+		return ParseDecimal(strings.TrimSpace(arg))
+	case float64:
+		return NewDecimalFromFloat(arg)
+	}
+
+	if d, ok := toDecimal(args[0]); ok {
+		return d, nil
+	}
+
+	return nil, fmt.Errorf("decimal function expects a number or string argument")
+}
+
 // Deg2Rad Converts degrees to radians.
 func (bif bif) Deg2Rad(ctx context.Context, args ...any) (any, error) {
 	if len(args) != 1 {
@@ -352,23 +508,7 @@ func (bif bif) Div(ctx context.Context, args ...any) (any, error) {
 		return nil, fmt.Errorf("div function expects exactly two arguments")
 	}
 
-	switch a := args[0].(type) {
-	case int:
-		switch b := args[1].(type) {
-		case int:
-			return a / b, nil
-		case float64:
-			return float64(a) / b, nil
-		}
-	case float64:
-		switch b := args[1].(type) {
-		case int:
-			return a / float64(b), nil
-		case float64:
-			return a / b, nil
-		}
-	}
-	return nil, nil
+	return arithmetic(ctx, TokenTypeDivide, args[0], args[1])
 }
 
 // DiffDate Calculates the difference between two dates.
@@ -389,7 +529,7 @@ func (bif bif) DiffDate(ctx context.Context, args ...any) (any, error) {
 		}
 	}
 
-	return nil, nil
+	return nil, fmt.Errorf("diffdate function expects two time arguments")
 }
 
 // DivInt Divides two numbers and returns an integer.
@@ -398,23 +538,7 @@ func (bif bif) DivInt(ctx context.Context, args ...any) (any, error) {
 		return nil, fmt.Errorf("div function expects exactly two arguments")
 	}
 
-	switch a := args[0].(type) {
-	case int:
-		switch b := args[1].(type) {
-		case int:
-			return a / b, nil
-		case float64:
-			return int(a) / int(b), nil
-		}
-	case float64:
-		switch b := args[1].(type) {
-		case int:
-			return int(a) / int(b), nil
-		case float64:
-			return int(a) / int(b), nil
-		}
-	}
-	return nil, nil
+	return arithmetic(ctx, TokenTypeDivideInteger, args[0], args[1])
 }
 
 // DiffTime Calculates the difference between two times.
@@ -434,13 +558,13 @@ func (bif bif) DiffTime(ctx context.Context, args ...any) (any, error) {
 		}
 	}
 
-	return nil, nil
+	return nil, fmt.Errorf("difftime function expects two time arguments")
 }
 
 // Double Doubles a number.
 func (bif bif) Double(ctx context.Context, args ...any) (any, error) {
 	if len(args) != 1 {
-		return nil, fmt.Errorf("double function expects exactly two arguments")
+		return nil, fmt.Errorf("double function expects a single argument")
 	}
 
 	switch a := args[0].(type) {
@@ -450,7 +574,28 @@ func (bif bif) Double(ctx context.Context, args ...any) (any, error) {
 		return a * 2, nil
 	}
 
-	return nil, nil
+	return nil, fmt.Errorf("double function expects a number argument")
+}
+
+// Duration Parses a string such as "1h30m" or "7d" into a duration.
+func (bif bif) Duration(ctx context.Context, args ...any) (any, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("duration function expects a single argument")
+	}
+
+	switch arg := args[0].(type) {
+	case time.Duration:
+		return arg, nil
+	case string:
+		arg = strings.TrimSpace(arg)
+		if strings.HasPrefix(arg, "-") {
+			d, err := parseDuration(arg[1:])
+			return -d, err
+		}
+		return parseDuration(arg)
+	}
+
+	return nil, fmt.Errorf("duration function expects a string argument")
 }
 
 // Env Retrieves an environment variable.
@@ -473,55 +618,42 @@ func (bif bif) Exp(ctx context.Context, args ...any) (any, error) {
 		return nil, fmt.Errorf("exp function expects exactly two arguments")
 	}
 
-	switch a := args[0].(type) {
-	case int:
-		switch b := args[1].(type) {
-		case int:
-			return math.Pow(float64(a), float64(b)), nil
-		case float64:
-			return math.Pow(float64(a), b), nil
-		}
-	case float64:
-		switch b := args[1].(type) {
-		case int:
-			return math.Pow(a, float64(b)), nil
-		case float64:
-			return math.Pow(a, b), nil
-		}
-	}
-
-	return nil, nil
+	return arithmetic(ctx, TokenTypeExponent, args[0], args[1])
 }
 
 // Filter Filters an array based on a condition.
 func (bif bif) Filter(ctx context.Context, args ...any) (any, error) {
 	if len(args) != 2 {
-		return nil, fmt.Errorf("filter function expects exactly two arguments: an array and an expression")
+		return nil, fmt.Errorf("filter function expects exactly two arguments: an array and a lambda")
 	}
 
-	array, ok := args[0].([]any)
+	array, ok := arrayElements(args[0])
 	if !ok {
 		return nil, fmt.Errorf("first argument to filter must be an array")
 	}
 
-	expr, ok := args[1].(string)
-	if !ok {
-		return nil, fmt.Errorf("second argument to filter must be a string expression")
+	predicate, err := elementFunc(ctx, "filter", args[1], func(element any, index int) map[string]any {
+		return map[string]any{"x": element}
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	var filteredArray []any
-	for _, element := range array {
-		// Prepare the context for the expression evaluation
-		ctx = SetVariables(ctx, map[string]any{"x": element})
-
-		// Evaluate the expression in the context of the current element
-		result, err := Evaluate(ctx, expr)
+	for i, element := range array {
+		result, err := predicate(element, i)
 		if err != nil {
-			return nil, fmt.Errorf("error evaluating expression '%s': %v", expr, err)
+			return nil, err
 		}
 
-		// Check if the result is true and include the element in the filtered array
-		if include, ok := result.(bool); ok && include {
+		// Check if the result is true and include the element in the filtered array,
+		// the string form leaves elements out for a result that is not a boolean
+		include, ok := result.(bool)
+		if _, legacy := args[1].(string); !ok && !legacy {
+			return nil, fmt.Errorf("filter function must return a boolean, got %T(%v)", result, result)
+		}
+
+		if include {
 			filteredArray = append(filteredArray, element)
 		}
 	}
@@ -539,7 +671,7 @@ func (bif bif) Floor(ctx context.Context, args ...any) (any, error) {
 	case int:
 		return arg, nil
 	case float64:
-		return int(math.Floor(arg)), nil
+		return floatToInt(math.Floor(arg))
 	default:
 		return nil, fmt.Errorf("floor function expects a number argument")
 	}
@@ -551,44 +683,23 @@ func (bif bif) Fv(ctx context.Context, args ...any) (any, error) {
 		return nil, fmt.Errorf("fv function expects exactly three arguments: present value, interest rate, and number of periods")
 	}
 
-	var (
-		pv   float64
-		rate float64
-		n    float64
-	)
-
-	switch a := args[0].(type) {
-	case int:
-		pv = float64(a)
-	case float64:
-		pv = a
-	default:
+	if !isNumber(args[0]) {
 		return nil, fmt.Errorf("first argument (present value) must be a number")
 	}
-
-	switch a := args[1].(type) {
-	case int:
-		rate = float64(a)
-	case float64:
-		rate = a
-	default:
+	if !isNumber(args[1]) {
 		return nil, fmt.Errorf("second argument (interest rate) must be a number")
 	}
-
-	switch a := args[2].(type) {
-	case int:
-		n = float64(a)
-	case float64:
-		n = a
-	default:
+	if !isNumber(args[2]) {
 		return nil, fmt.Errorf("third argument (number of periods) must be a number")
 	}
 
-	// Calculate the future value
-	fvr := math.Pow(1+rate, n)
-	fv := pv * fvr
+	// Calculate (1 + rate)^n and multiply the present value by it
+	growth, err := compoundGrowth(ctx, args[1], args[2])
+	if err != nil {
+		return nil, err
+	}
 
-	return fv, nil
+	return arithmetic(ctx, TokenTypeMultiply, args[0], growth)
 }
 
 // Hypot Calculates the hypotenuse of a right-angled triangle.
@@ -614,7 +725,7 @@ func (bif bif) Hypot(ctx context.Context, args ...any) (any, error) {
 		}
 	}
 
-	return nil, nil
+	return nil, fmt.Errorf("hypot function expects number arguments")
 }
 
 // Len Returns the length of a string or array.
@@ -623,14 +734,15 @@ func (bif bif) Len(ctx context.Context, args ...any) (any, error) {
 		return nil, fmt.Errorf("len function expects a single argument")
 	}
 
-	switch arg := args[0].(type) {
-	case string:
+	if arg, ok := args[0].(string); ok {
 		return len(arg), nil
-	case []any:
-		return len(arg), nil
-	default:
-		return nil, fmt.Errorf("len function expects a string or array argument")
 	}
+
+	if elements, ok := arrayElements(args[0]); ok {
+		return len(elements), nil
+	}
+
+	return nil, fmt.Errorf("len function expects a string or array argument")
 }
 
 // Log Calculates the logarithm of a number.
@@ -656,7 +768,7 @@ func (bif bif) Log(ctx context.Context, args ...any) (any, error) {
 		}
 	}
 
-	return nil, nil
+	return nil, fmt.Errorf("log function expects number arguments")
 }
 
 // Log10 Calculates the base 10 logarithm of a number.
@@ -694,31 +806,26 @@ func (bif bif) Log2(ctx context.Context, args ...any) (any, error) {
 // Map Applies a function to each element of an array.
 func (bif bif) Map(ctx context.Context, args ...any) (any, error) {
 	if len(args) != 2 {
-		return nil, fmt.Errorf("map function expects exactly two arguments: an array and an expression")
+		return nil, fmt.Errorf("map function expects exactly two arguments: an array and a lambda")
 	}
 
-	array, ok := args[0].([]any)
+	array, ok := arrayElements(args[0])
 	if !ok {
 		return nil, fmt.Errorf("first argument to map must be an array")
 	}
 
-	expr, ok := args[1].(string)
-	if !ok {
-		return nil, fmt.Errorf("second argument to map must be a string expression")
+	transform, err := elementFunc(ctx, "map", args[1], func(element any, index int) map[string]any {
+		return map[string]any{"_i": index, "_x": element}
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	var mappedArray []any
 	for i, element := range array {
-		// Prepare the context for the expression evaluation
-		ctx = SetVariables(ctx, map[string]any{"_i": i, "_x": element})
-
-		//// would it be logical to also pass the next element in the array?
-		//ctx = SetVariables(ctx, map[string]any{"_y": element})
-
-		// Evaluate the expression in the context of the current element
-		transformedElement, err := Evaluate(ctx, expr)
+		transformedElement, err := transform(element, i)
 		if err != nil {
-			return nil, fmt.Errorf("error evaluating expression '%s': %v", expr, err)
+			return nil, err
 		}
 
 		// Add the result of the transformation to the mapped array
@@ -730,6 +837,8 @@ func (bif bif) Map(ctx context.Context, args ...any) (any, error) {
 
 // Max Returns the maximum of two or more numbers.
 func (bif bif) Max(ctx context.Context, args ...any) (any, error) {
+	args = flattenArrays(args)
+
 	if len(args) < 1 {
 		return nil, fmt.Errorf("max function expects at least one argument")
 	}
@@ -760,6 +869,8 @@ func (bif bif) Max(ctx context.Context, args ...any) (any, error) {
 
 // Mean Calculates the mean of two or more numbers.
 func (bif bif) Mean(ctx context.Context, args ...any) (any, error) {
+	args = flattenArrays(args)
+
 	if len(args) < 1 {
 		return nil, fmt.Errorf("mean function expects at least one argument")
 	}
@@ -781,6 +892,8 @@ func (bif bif) Mean(ctx context.Context, args ...any) (any, error) {
 
 // Median Calculates the median of two or more numbers.
 func (bif bif) Median(ctx context.Context, args ...any) (any, error) {
+	args = flattenArrays(args)
+
 	var median = func(a []float64) (float64, error) {
 		if len(a) == 0 {
 			return 0, nil
@@ -818,6 +931,8 @@ func (bif bif) Median(ctx context.Context, args ...any) (any, error) {
 
 // Min Returns the minimum of two or more numbers.
 func (bif bif) Min(ctx context.Context, args ...any) (any, error) {
+	args = flattenArrays(args)
+
 	if len(args) < 1 {
 		return nil, fmt.Errorf("min function expects at least one argument")
 	}
@@ -876,28 +991,13 @@ func (bif bif) Mod(ctx context.Context, args ...any) (any, error) {
 		return nil, fmt.Errorf("mod function expects exactly two arguments")
 	}
 
-	switch a := args[0].(type) {
-	case int:
-		switch b := args[1].(type) {
-		case int:
-			return a % b, nil
-		case float64:
-			return a % int(b), nil
-		}
-	case float64:
-		switch b := args[1].(type) {
-		case int:
-			return int(a) % b, nil
-		case float64:
-			return int(a) % int(b), nil
-		}
-	}
-
-	return nil, nil
+	return arithmetic(ctx, TokenTypeModulo, args[0], args[1])
 }
 
 // Mode Returns the mode of two or more numbers.
 func (bif bif) Mode(ctx context.Context, args ...any) (any, error) {
+	args = flattenArrays(args)
+
 	if len(args) < 1 {
 		return nil, fmt.Errorf("mode function expects at least one argument")
 	}
@@ -945,24 +1045,16 @@ func (bif bif) Mul(ctx context.Context, args ...any) (any, error) {
 		return nil, fmt.Errorf("mul function expects exactly two arguments")
 	}
 
-	switch a := args[0].(type) {
-	case int:
-		switch b := args[1].(type) {
-		case int:
-			return a * b, nil
-		case float64:
-			return float64(a) * b, nil
-		}
-	case float64:
-		switch b := args[1].(type) {
-		case int:
-			return a * float64(b), nil
-		case float64:
-			return a * b, nil
-		}
+	return arithmetic(ctx, TokenTypeMultiply, args[0], args[1])
+}
+
+// Now Returns the current date and time.
+func (bif bif) Now(ctx context.Context, args ...any) (any, error) {
+	if len(args) != 0 {
+		return nil, fmt.Errorf("now function expects no arguments")
 	}
 
-	return nil, nil
+	return time.Now(), nil
 }
 
 // Pow Raises a number to the power of another number.
@@ -971,24 +1063,7 @@ func (bif bif) Pow(ctx context.Context, args ...any) (any, error) {
 		return nil, fmt.Errorf("pow function expects exactly two arguments")
 	}
 
-	switch a := args[0].(type) {
-	case int:
-		switch b := args[1].(type) {
-		case int:
-			return math.Pow(float64(a), float64(b)), nil
-		case float64:
-			return math.Pow(float64(a), b), nil
-		}
-	case float64:
-		switch b := args[1].(type) {
-		case int:
-			return math.Pow(a, float64(b)), nil
-		case float64:
-			return math.Pow(a, b), nil
-		}
-	}
-
-	return nil, nil
+	return arithmetic(ctx, TokenTypeExponent, args[0], args[1])
 }
 
 // Predict Predicts the next word in a sentence.
@@ -1017,53 +1092,19 @@ func (bif bif) Pv(ctx context.Context, args ...any) (any, error) {
 		return nil, fmt.Errorf("pv function expects exactly three arguments")
 	}
 
-	// fv float64, r float64, n float64
-	var (
-		fv float64
-		n  float64
-		r  float64
-	)
-
-	switch a := args[0].(type) {
-	case int:
-		fv = float64(a)
-	case float64:
-		fv = a
-	default:
-		return nil, fmt.Errorf("pv function expects a number argument")
-	}
-
-	switch a := args[1].(type) {
-	case int:
-		r = float64(a)
-	case float64:
-		r = a
-	default:
-		return nil, fmt.Errorf("pv function expects a number argument")
-	}
-
-	switch a := args[2].(type) {
-	case int:
-		n = float64(a)
-	case float64:
-		n = a
-	default:
-		return nil, fmt.Errorf("pv function expects a number argument")
-	}
-
-	// Calculate (1 + r)^n using the Pow method
-	denominator, err := bif.Pow(ctx, 1+r, n)
-	if err != nil {
-		return 0, err
+	for _, arg := range args {
+		if !isNumber(arg) {
+			return nil, fmt.Errorf("pv function expects a number argument")
+		}
 	}
 
 	// Divide FV by (1 + r)^n
-	pv, err := bif.Div(ctx, fv, denominator)
+	growth, err := compoundGrowth(ctx, args[1], args[2])
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
 
-	return pv, nil
+	return arithmetic(ctx, TokenTypeDivide, args[0], growth)
 }
 
 // Rad2Deg Converts radians to degrees.
@@ -1117,33 +1158,30 @@ func (bif bif) Rand(ctx context.Context, args ...any) (any, error) {
 		}
 	}
 
-	return nil, nil
+	return nil, fmt.Errorf("rand function expects int or float64 as the type, got %s", rtype)
 }
 
 // Reduce Reduces an array to a single value.
 func (bif bif) Reduce(ctx context.Context, args ...any) (any, error) {
 	if len(args) < 2 || len(args) > 3 {
-		return nil, fmt.Errorf("reduce function expects two or three arguments: an array, a function, and an optional initial value")
+		return nil, fmt.Errorf("reduce function expects two or three arguments: an array, a lambda, and an optional initial value")
 	}
 
-	array, ok := args[0].([]any)
-	if !ok || len(array) == 0 {
+	array, ok := arrayElements(args[0])
+	if !ok || (len(array) == 0 && len(args) == 2) {
 		return nil, fmt.Errorf("first argument to reduce must be a non-empty array")
 	}
 
-	var fun bifFunc
-	switch arg := args[1].(type) {
-	case string:
-		fun, ok = bif[arg]
-		if !ok {
-			return nil, fmt.Errorf("function %s not supported", arg)
+	fun, ok := callable(ctx, args[1], 2)
+	if name, isName := args[1].(string); isName {
+		builtin, found := engineFrom(ctx).function(name)
+		if !found {
+			return nil, fmt.Errorf("function %s not supported", name)
 		}
-	case bifFunc:
-		fun = arg
-	case func(context.Context, ...any) (any, error):
-		fun = arg
-	default:
-		return nil, fmt.Errorf("second argument should be a function identifier or a function")
+		fun, ok = callable(ctx, builtin, 2)
+	}
+	if !ok {
+		return nil, fmt.Errorf("second argument should be a lambda, a function identifier or a function")
 	}
 
 	var accumulator any
@@ -1157,10 +1195,9 @@ func (bif bif) Reduce(ctx context.Context, args ...any) (any, error) {
 		startIdx = 1 // Start reducing from the second element
 	}
 
-	for _, element := range array[startIdx:] {
+	for i, element := range array[startIdx:] {
 		var err error
-		in := accumulator
-		accumulator, err = fun(ctx, in, element)
+		accumulator, err = fun(accumulator, element, startIdx+i)
 		if err != nil {
 			return nil, err
 		}
@@ -1182,14 +1219,18 @@ func (bif bif) Reverse(ctx context.Context, args ...any) (any, error) {
 			runes[i], runes[j] = runes[j], runes[i]
 		}
 		return string(runes), nil
-	case []any:
-		for i, j := 0, len(arg)-1; i < j; i, j = i+1, j-1 {
-			arg[i], arg[j] = arg[j], arg[i]
-		}
-		return arg, nil
-	default:
+	}
+
+	array, ok := arrayElements(args[0])
+	if !ok {
 		return nil, fmt.Errorf("reverse function expects a string or array argument")
 	}
+
+	reversed := make([]any, len(array))
+	for i, v := range array {
+		reversed[len(array)-1-i] = v
+	}
+	return reversed, nil
 }
 
 // Root Calculates the nth root of a number.
@@ -1215,20 +1256,62 @@ func (bif bif) Root(ctx context.Context, args ...any) (any, error) {
 		}
 	}
 
-	return nil, nil
+	return nil, fmt.Errorf("root function expects number arguments")
 }
 
 // Round Rounds a number to the nearest integer.
 func (bif bif) Round(ctx context.Context, args ...any) (any, error) {
-	if len(args) != 1 {
-		return nil, fmt.Errorf("round function expects a single argument")
+	if len(args) < 1 || len(args) > 3 {
+		return nil, fmt.Errorf("round function expects one to three arguments: a number, the number of decimal places and the rounding mode")
+	}
+
+	places := 0
+	if len(args) > 1 {
+		p, ok := args[1].(int)
+		if !ok || p < 0 {
+			return nil, fmt.Errorf("round function expects a non-negative int as the number of decimal places")
+		}
+		if p > MaxDecimalDigits {
+			return nil, fmt.Errorf("%w: round function expects at most %d decimal places, got %d", ErrDecimalOverflow, MaxDecimalDigits, p)
+		}
+		places = p
+	}
+
+	mode := RoundHalfUp
+	if len(args) > 2 {
+		m, _ := args[2].(string)
+		mode = RoundingMode(m)
+		if !mode.valid() {
+			return nil, fmt.Errorf("round function expects a rounding mode (half_up, half_even, half_down, up, down, ceiling, floor), got %v", args[2])
+		}
 	}
 
 	switch arg := args[0].(type) {
 	case int:
+		if decimalMode(ctx) && len(args) > 1 {
+			return NewDecimalFromInt(arg).Round(int32(places), mode), nil
+		}
 		return arg, nil
 	case float64:
-		return int(math.Round(arg)), nil
+		if len(args) == 1 && !decimalMode(ctx) {
+			return floatToInt(math.Round(arg))
+		}
+
+		d, err := NewDecimalFromFloat(arg)
+		if err != nil {
+			return nil, err
+		}
+
+		rounded := d.Round(int32(places), mode)
+		if decimalMode(ctx) {
+			return rounded, nil
+		}
+		if len(args) == 1 {
+			return floatToInt(rounded.Float64())
+		}
+		return rounded.Float64(), nil
+	case Decimal:
+		return arg.Round(int32(places), mode), nil
 	default:
 		return nil, fmt.Errorf("round function expects a number argument")
 	}
@@ -1288,17 +1371,17 @@ func (bif bif) Shuffle(ctx context.Context, args ...any) (any, error) {
 		return nil, fmt.Errorf("shuffle function expects a single argument")
 	}
 
-	switch arg := args[0].(type) {
-	case []any:
-		shuffled := make([]any, len(arg))
-		perm := rand.Perm(len(arg))
-		for i, v := range perm {
-			shuffled[v] = arg[i]
-		}
-		return shuffled, nil
-	default:
+	array, ok := arrayElements(args[0])
+	if !ok {
 		return nil, fmt.Errorf("shuffle function expects an array argument")
 	}
+
+	shuffled := make([]any, len(array))
+	perm := rand.Perm(len(array))
+	for i, v := range perm {
+		shuffled[v] = array[i]
+	}
+	return shuffled, nil
 }
 
 // Sin Calculates the sine of an angle in radians.
@@ -1333,28 +1416,26 @@ func (bif bif) Sinh(ctx context.Context, args ...any) (any, error) {
 	}
 }
 
-// Slice Returns a portion of an array.
+// Slice Returns a portion of an array or string. Negative indexes count from
+// the end and bounds beyond the array are clamped.
 func (bif bif) Slice(ctx context.Context, args ...any) (any, error) {
-	if len(args) != 3 {
-		return nil, fmt.Errorf("slice function expects exactly three arguments")
+	if len(args) < 2 || len(args) > 3 {
+		return nil, fmt.Errorf("slice function expects two or three arguments")
 	}
 
-	switch arg := args[0].(type) {
-	case []any:
-		start, ok := args[1].(int)
-		if !ok {
-			return nil, fmt.Errorf("slice function expects an int as the second argument")
-		}
+	if _, ok := args[1].(int); !ok {
+		return nil, fmt.Errorf("slice function expects an int as the second argument")
+	}
 
-		end, ok := args[2].(int)
-		if !ok {
+	var end any
+	if len(args) == 3 {
+		if _, ok := args[2].(int); !ok {
 			return nil, fmt.Errorf("slice function expects an int as the third argument")
 		}
-
-		return arg[start:end], nil
-	default:
-		return nil, fmt.Errorf("slice function expects an array argument")
+		end = args[2]
 	}
+
+	return sliceValue(args[0], args[1], end)
 }
 
 // Sort Sorts an array.
@@ -1364,43 +1445,80 @@ func (bif bif) Sort(ctx context.Context, args ...any) (any, error) {
 	}
 
 	switch arg := args[0].(type) {
-	case []any:
-		sorted := make([]any, len(arg))
-		copy(sorted, arg)
+	case []int:
+		sorted := slices.Clone(arg)
+		slices.Sort(sorted)
+		return sorted, nil
+	case []float64:
+		sorted := slices.Clone(arg)
+		slices.Sort(sorted)
+		return sorted, nil
+	case []string:
+		sorted := slices.Clone(arg)
+		slices.Sort(sorted)
+		return sorted, nil
+	case []time.Time:
+		sorted := slices.Clone(arg)
+		slices.SortFunc(sorted, time.Time.Compare)
+		return sorted, nil
+	}
+
+	array, ok := arrayElements(args[0])
+	if !ok {
+		return nil, fmt.Errorf("sort function expects an array argument")
+	}
+
+	if len(array) == 0 {
+		return array, nil
+	}
 
-		switch sorted[0].(type) {
+	// an array of mixed elements is sorted as the type of its first element,
+	// ints are promoted to floats when the array also contains floats
+	elementType := arrayTypeAny
+	normalized := make([]any, len(array))
+	for i, v := range array {
+		v, err := normalizeNumber(v)
+		if err != nil {
+			return nil, err
+		}
+		normalized[i] = v
+
+		var t arrayType
+		switch v.(type) {
 		case int:
-			ints := make([]int, len(sorted))
-			for i, v := range sorted {
-				ints[i] = v.(int)
-			}
-			sort.Ints(ints)
-			return ints, nil
+			t = arrayTypeInt
 		case float64:
-			floats := make([]float64, len(sorted))
-			for i, v := range sorted {
-				floats[i] = v.(float64)
-			}
-			sort.Float64s(floats)
-			return floats, nil
+			t = arrayTypeFloat
 		case string:
-			strings := make([]string, len(sorted))
-			for i, v := range sorted {
-				strings[i] = v.(string)
-			}
+			t = arrayTypeString
+		case time.Time:
+			t = arrayTypeTime
+		default:
+			return nil, fmt.Errorf("sort function expects an array of numbers, strings or times, got %T", v)
+		}
 
-			sort.Strings(strings)
-			return strings, nil
+		switch {
+		case elementType == arrayTypeAny || elementType == t:
+			elementType = t
+		case elementType == arrayTypeInt && t == arrayTypeFloat, elementType == arrayTypeFloat && t == arrayTypeInt:
+			elementType = arrayTypeFloat
+		default:
+			return nil, fmt.Errorf("sort function expects elements of a single type, got %s and %s", elementType, t)
 		}
-	default:
-		return nil, fmt.Errorf("sort function expects an array argument")
 	}
 
-	return nil, nil
+	sorted, err := typedArray(elementType, normalized)
+	if err != nil {
+		return nil, err
+	}
+
+	return bif.Sort(ctx, sorted)
 }
 
 // StdDev Calculates the standard deviation of two or more numbers.
 func (bif bif) StdDev(ctx context.Context, args ...any) (any, error) {
+	args = flattenArrays(args)
+
 	if len(args) < 1 {
 		return nil, fmt.Errorf("stddev function expects at least one argument")
 	}
@@ -1438,23 +1556,7 @@ func (bif bif) Sub(ctx context.Context, args ...any) (any, error) {
 		return nil, fmt.Errorf("sub function expects exactly two arguments")
 	}
 
-	switch a := args[0].(type) {
-	case int:
-		switch b := args[1].(type) {
-		case int:
-			return a - b, nil
-		case float64:
-			return float64(a) - b, nil
-		}
-	case float64:
-		switch b := args[1].(type) {
-		case int:
-			return a - float64(b), nil
-		case float64:
-			return a - b, nil
-		}
-	}
-	return nil, nil
+	return arithmetic(ctx, TokenTypeMinus, args[0], args[1])
 }
 
 // Sqrt Calculates the square root of a number.
@@ -1475,11 +1577,32 @@ func (bif bif) Sqrt(ctx context.Context, args ...any) (any, error) {
 
 // Sum Returns the sum of two or more numbers.
 func (bif bif) Sum(ctx context.Context, args ...any) (any, error) {
-	if len(args) < 1 {
-		return nil, fmt.Errorf("sum function expects a single argument")
+	// the sum of an empty array is 0
+	args = flattenArrays(args)
+
+	var (
+		sum   float64
+		exact = decimalMode(ctx)
+	)
+
+	for _, arg := range args {
+		switch arg.(type) {
+		case int, float64:
+		case Decimal:
+			exact = true
+		default:
+			return nil, fmt.Errorf("sum function expects number arguments")
+		}
 	}
 
-	var sum float64
+	if exact {
+		var total Decimal
+		for _, arg := range args {
+			d, _ := toDecimal(arg)
+			total = total.Add(d)
+		}
+		return total, nil
+	}
 
 	for _, arg := range args {
 		switch a := arg.(type) {
@@ -1487,11 +1610,6 @@ func (bif bif) Sum(ctx context.Context, args ...any) (any, error) {
 			sum += float64(a)
 		case float64:
 			sum += a
-		case []any:
-			ssum, _ := bif.Sum(ctx, a...)
-			sum += ssum.(float64)
-		default:
-			return nil, fmt.Errorf("sum function expects number arguments")
 		}
 	}
 
@@ -1504,20 +1622,19 @@ func (bif bif) Unique(ctx context.Context, args ...any) (any, error) {
 		return nil, fmt.Errorf("unique function expects a single argument")
 	}
 
-	switch arg := args[0].(type) {
-	case []any:
-		unique := make(map[any]bool)
-		var result []any
-		for _, a := range arg {
-			if !unique[a] {
-				unique[a] = true
-				result = append(result, a)
-			}
-		}
-		return result, nil
-	default:
+	array, ok := arrayElements(args[0])
+	if !ok {
 		return nil, fmt.Errorf("unique function expects an array argument")
 	}
+
+	// elements are compared like ==, so 1 and 1.0 are duplicates
+	var result []any
+	for _, a := range array {
+		if !slices.ContainsFunc(result, func(b any) bool { return equalValues(a, b) }) {
+			result = append(result, a)
+		}
+	}
+	return result, nil
 }
 
 // Tan Calculates the tangent of an angle in radians.
@@ -1572,6 +1689,8 @@ func (bif bif) Time(ctx context.Context, args ...any) (any, error) {
 
 // Variance Calculates the variance of two or more numbers.
 func (bif bif) Variance(ctx context.Context, args ...any) (any, error) {
+	args = flattenArrays(args)
+
 	if len(args) < 2 {
 		return nil, fmt.Errorf("variance function expects at least two arguments")
 	}
@@ -1603,3 +1722,66 @@ func (bif bif) Variance(ctx context.Context, args ...any) (any, error) {
 	// Use len(args) - 1 for sample variance
 	return variance / float64(len(args)-1), nil
 }
+
+// arrayElements returns the elements of an array, either []any or a typed
+// slice such as the []int of an int[...] literal.
+func arrayElements(v any) ([]any, bool) {
+	if array, ok := v.([]any); ok {
+		return array, true
+	}
+
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return nil, false
+	}
+
+	elements := make([]any, rv.Len())
+	for i := range elements {
+		elements[i] = rv.Index(i).Interface()
+	}
+
+	return elements, true
+}
+
+// flattenArrays replaces the array arguments of a function that accepts both
+// numbers and arrays of numbers with their normalized elements.
+func flattenArrays(args []any) []any {
+	var flat []any
+	for _, arg := range args {
+		if _, isString := arg.(string); !isString {
+			if elements, ok := arrayElements(arg); ok {
+				for _, element := range elements {
+					if n, err := normalizeNumber(element); err == nil {
+						element = n
+					}
+					flat = append(flat, element)
+				}
+				continue
+			}
+		}
+		flat = append(flat, arg)
+	}
+
+	return flat
+}
+
+// isNumber reports whether the value is an int, a float64 or a Decimal.
+func isNumber(v any) bool {
+	switch v.(type) {
+	case int, float64, Decimal:
+		return true
+	}
+
+	return false
+}
+
+// compoundGrowth returns (1 + rate)^n, exact when the rate is a decimal and n
+// an integer.
+func compoundGrowth(ctx context.Context, rate, n any) (any, error) {
+	base, err := arithmetic(ctx, TokenTypePlus, 1, rate)
+	if err != nil {
+		return nil, err
+	}
+
+	return arithmetic(ctx, TokenTypeExponent, base, n)
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"strings"
 	"testing"
 	"time"
 )
@@ -1115,3 +1116,87 @@ func TestBif_Variance(t *testing.T) {
 		t.Errorf("expected 2.5, got %v", out)
 	}
 }
+
+func TestTypedArrays(t *testing.T) {
+	ctx := SetVariables(context.TODO(), map[string]any{
+		"ints":   []int{3, 1, 2},
+		"floats": []float64{2.5, 0.5},
+		"mixed":  []any{3, 1.5, 2},
+		"when":   time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC),
+	})
+
+	inputs := map[string]string{
+		`int[1, 2, 3]`:                        "[]int [1 2 3]",
+		`float[1, 2.5]`:                       "[]float64 [1 2.5]",
+		`string["a", "b"]`:                    "[]string [a b]",
+		`time[when]`:                          "[]time.Time [2024-01-02 00:00:00 +0000 UTC]",
+		`any[1, "a"]`:                         "[]interface {} [1 a]",
+		`[1, "a"]`:                            "[]interface {} [1 a]",
+		`int[]`:                               "[]int []",
+		`sort(int[3, 1, 2])`:                  "[]int [1 2 3]",
+		`sort([3, 1, 2])`:                     "[]int [1 2 3]",
+		`sort(mixed)`:                         "[]float64 [1.5 2 3]",
+		`sort(ints)`:                          "[]int [1 2 3]",
+		`sort(string["b", "a"])`:              "[]string [a b]",
+		`sort([])`:                            "[]interface {} []",
+		`sum(int[1, 2, 3])`:                   "float64 6",
+		`sum([1, 2, 3], float[0.5])`:          "float64 6.5",
+		`sum(ints, floats)`:                   "float64 9",
+		`sum([])`:                             "float64 0",
+		`sum(int[], 1)`:                       "float64 1",
+		`unique(int[1, 1, 2])`:                "[]interface {} [1 2]",
+		`unique(string["a", "a"])`:            "[]interface {} [a]",
+		`unique([1, null, 1, null])`:          "[]interface {} [1 <nil>]",
+		`unique([1, 1.0, 2])`:                 "[]interface {} [1 2]",
+		`unique([[1], [1.0], {"a": 1}])`:      "[]interface {} [[1] map[a:1]]",
+		`mean(int[1, 2, 3])`:                  "float64 2",
+		`mean([1, 2, 3])`:                     "float64 2",
+		`median(float[1, 2, 3])`:              "float64 2",
+		`mode(int[1, 2, 2])`:                  "float64 2",
+		`variance(int[1, 2, 3, 4, 5])`:        "float64 2.5",
+		`stddev(int[2, 4, 4, 4, 5, 5, 7, 9])`: "float64 2",
+		`max(int[1, 5, 3])`:                   "float64 5",
+		`min(ints)`:                           "int 1",
+		`len(ints)`:                           "int 3",
+		`reverse(ints)`:                       "[]interface {} [2 1 3]",
+		`map(ints, (x) => x * 2)`:             "[]interface {} [6 2 4]",
+		`filter(floats, (x) => x > 1)`:        "[]interface {} [2.5]",
+		`reduce(ints, (acc, x) => acc + x)`:   "int 6",
+		`int[1, 2] == [1, 2]`:                 "bool true",
+		`int[1, 2] == float[1, 2]`:            "bool true",
+		`2 in int[1, 2]`:                      "bool true",
+		`int[1, 2, 3][1:]`:                    "[]int [2 3]",
+	}
+
+	for input, expected := range inputs {
+		out, err := Evaluate(ctx, input)
+		if err != nil {
+			t.Errorf("%s: %v", input, err)
+			continue
+		}
+
+		if got := fmt.Sprintf("%T %v", out, out); got != expected {
+			t.Errorf("%s: expected %s, got %s", input, expected, got)
+		}
+	}
+}
+
+func TestTypedArrayErrors(t *testing.T) {
+	inputs := map[string]string{
+		`int[1, "a"]`:    "element 1 of int array must be int, got string(a)",
+		`int[1, 2.5]`:    "element 1 of int array must be int",
+		`float[1, "a"]`:  "element 1 of float array must be float",
+		`string["a", 1]`: "element 1 of string array must be string",
+		`time["2024"]`:   "element 0 of time array must be time",
+		`int[null]`:      "element 0 of int array must be int",
+		`sort([1, "a"])`: "sort function expects elements of a single type",
+		`sort([true])`:   "sort function expects an array of numbers, strings or times",
+	}
+
+	for input, expected := range inputs {
+		_, err := Evaluate(context.TODO(), input)
+		if err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("%s: expected error containing %q, got %v", input, expected, err)
+		}
+	}
+}
@@ -0,0 +1,664 @@
+package expronaut
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+var (
+	// ErrUnknownVariable is reported by Check for a variable that is not
+	// declared in the schema.
+	ErrUnknownVariable = errors.New("unknown variable")
+	// ErrUnknownFunction is reported by Check and Compile for a call to a
+	// function that is not registered on the engine.
+	ErrUnknownFunction = errors.New("unknown function")
+	// ErrTypeMismatch is reported by Check for an operator applied to operands
+	// of types it does not accept.
+	ErrTypeMismatch = errors.New("type mismatch")
+)
+
+// Schema declares the variables of an expression for Check. The value of a
+// variable is its Type, a nested Schema for a map with known keys, or an
+// ArrayOf for an array with known elements:
+//
+//	Schema{
+//		"age":  TypeInt,
+//		"user": Schema{"name": TypeString, "tags": ArrayOf(TypeString)},
+//	}
+type Schema map[string]any
+
+// ArraySchema declares an array whose elements are of a known type, see
+// ArrayOf.
+type ArraySchema struct {
+	Elem any // a Type, Schema or ArraySchema
+}
+
+// ArrayOf declares an array whose elements are declared by elem, a Type,
+// Schema or ArraySchema.
+func ArrayOf(elem any) ArraySchema {
+	return ArraySchema{Elem: elem}
+}
+
+// CheckErrors are the problems Check found in an expression, in the order
+// they appear in the source.
+type CheckErrors []*Error
+
+func (e CheckErrors) Error() string {
+	switch len(e) {
+	case 0:
+		return "no errors"
+	case 1:
+		return e[0].Error()
+	case 2:
+		return fmt.Sprintf("%s (and 1 more error)", e[0])
+	}
+
+	return fmt.Sprintf("%s (and %d more errors)", e[0], len(e)-1)
+}
+
+func (e CheckErrors) Unwrap() []error {
+	errs := make([]error, len(e))
+	for i, err := range e {
+		errs[i] = err
+	}
+
+	return errs
+}
+
+// Check checks the expression against the schema with the functions of the
+// default engine, see Engine.Check.
+func Check(expr string, schema Schema) (Type, error) {
+	return defaultEngine.Check(expr, schema)
+}
+
+// Check infers the type of the expression from the variables declared in the
+// schema and the signatures of the functions of the engine, without
+// evaluating it. It reports operators applied to operands of the wrong type,
+// variables the schema does not declare, unknown functions and calls that do
+// not match their signature as CheckErrors. Values whose type is not known,
+// such as the results of functions without a signature or variables declared
+// as TypeAny, are accepted everywhere.
+//
+// The type of the expression is returned even when it has errors, TypeAny
+// when it is not known.
+func (e *Engine) Check(expr string, schema Schema) (Type, error) {
+	vars, err := schemaShape(schema)
+	if err != nil {
+		return TypeAny, err
+	}
+
+	tree, diagnostics := Parse(expr)
+	if err := diagnostics.Err(); err != nil {
+		return TypeAny, err
+	}
+
+	c := &checker{engine: e, vars: vars.fields}
+	result := c.check(tree)
+
+	if len(c.errors) > 0 {
+		slices.SortStableFunc(c.errors, func(a, b *Error) int {
+			return a.Span.Start.Offset - b.Span.Start.Offset
+		})
+		return result.typ, c.errors
+	}
+
+	return result.typ, nil
+}
+
+// shape is the static type of a value, with the fields of a map and the
+// elements of an array when they are known.
+type shape struct {
+	typ    Type
+	fields map[string]*shape // nil when the keys of a map are not known
+	elem   *shape            // nil when the elements of an array are not known
+}
+
+var anyShape = &shape{typ: TypeAny}
+
+// shapeOf returns the shape of a single type.
+func shapeOf(t Type) *shape {
+	if t == TypeAny {
+		return anyShape
+	}
+
+	return &shape{typ: t}
+}
+
+// schemaShape converts a declaration of a Schema to a shape.
+func schemaShape(decl any) (*shape, error) {
+	switch d := decl.(type) {
+	case Type:
+		return shapeOf(d), nil
+	case Schema:
+		s := &shape{typ: TypeMap, fields: make(map[string]*shape, len(d))}
+		for name, field := range d {
+			fs, err := schemaShape(field)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", name, err)
+			}
+			s.fields[name] = fs
+		}
+		return s, nil
+	case ArraySchema:
+		elem, err := schemaShape(d.Elem)
+		if err != nil {
+			return nil, err
+		}
+		return &shape{typ: TypeArray, elem: elem}, nil
+	}
+
+	return nil, fmt.Errorf("invalid schema declaration %T, expected a Type, Schema or ArraySchema", decl)
+}
+
+// union returns the shape of a value that has either of the shapes.
+func union(a, b *shape) *shape {
+	switch {
+	case a == b:
+		return a
+	case a.typ == TypeAny || b.typ == TypeAny:
+		return anyShape
+	case a.typ == typeNull:
+		return b
+	case b.typ == typeNull:
+		return a
+	}
+
+	return &shape{typ: a.typ | b.typ}
+}
+
+// kinds returns the single types the type combines.
+func (t Type) kinds() []Type {
+	var kinds []Type
+	for k := Type(1); k != 0; k <<= 1 {
+		if t&k != 0 {
+			kinds = append(kinds, k)
+		}
+	}
+
+	return kinds
+}
+
+// checker infers the shapes of the nodes of a tree and collects the errors.
+type checker struct {
+	engine *Engine
+	vars   map[string]*shape
+	scopes []map[string]*shape // the parameters of the enclosing lambdas
+	errors CheckErrors
+}
+
+func (c *checker) report(node ASTNode, err error) {
+	c.errors = append(c.errors, &Error{Span: spanOf(node), Err: err})
+}
+
+func (c *checker) errorf(node ASTNode, err error, format string, args ...any) {
+	c.report(node, fmt.Errorf("%w: "+format, append([]any{err}, args...)...))
+}
+
+// check returns the shape of the value the node evaluates to.
+func (c *checker) check(node ASTNode) *shape {
+	switch n := node.(type) {
+	case *IntLiteralNode:
+		return shapeOf(TypeInt)
+	case *FloatLiteralNode:
+		return shapeOf(TypeFloat)
+	case *StringLiteralNode:
+		return shapeOf(TypeString)
+	case *BooleanLiteralNode:
+		return shapeOf(TypeBool)
+	case *NullLiteralNode:
+		return shapeOf(typeNull)
+	case *DurationLiteralNode:
+		return shapeOf(TypeDuration)
+	case *VariableNode:
+		s, err := c.variable(n.Name)
+		if err != nil {
+			c.report(n, err)
+			return anyShape
+		}
+		return s
+	case *UnaryOperationNode:
+		return c.unary(n)
+	case *BinaryOperationNode:
+		return c.binary(n)
+	case *LogicalOperationNode:
+		left, right := c.check(n.Left), c.check(n.Right)
+		for _, operand := range []struct {
+			node  ASTNode
+			shape *shape
+		}{{n.Left, left}, {n.Right, right}} {
+			if !TypeBool.accepts(operand.shape.typ) {
+				c.errorf(operand.node, ErrTypeMismatch, "operand of %s must be bool, got %s", n.Operator.symbol(), operand.shape.typ)
+			}
+		}
+		return shapeOf(TypeBool)
+	case *RegexMatchNode:
+		if subject := c.check(n.Subject); !TypeString.accepts(subject.typ) {
+			c.errorf(n.Subject, ErrTypeMismatch, "subject of %s must be string, got %s", n.Operator.symbol(), subject.typ)
+		}
+		if pattern := c.check(n.Pattern); !TypeString.accepts(pattern.typ) {
+			c.errorf(n.Pattern, ErrTypeMismatch, "pattern of %s must be string, got %s", n.Operator.symbol(), pattern.typ)
+		}
+		return shapeOf(TypeBool)
+	case *ConditionalNode:
+		if condition := c.check(n.Condition); !TypeBool.accepts(condition.typ) {
+			c.errorf(n.Condition, ErrTypeMismatch, "condition must be bool, got %s", condition.typ)
+		}
+		return union(c.check(n.Consequent), c.check(n.Alternative))
+	case *NullCoalesceNode:
+		left := c.optional(n.Left)
+		right := c.check(n.Right)
+		if left == nil {
+			return right
+		}
+		return union(left, right)
+	case *OptionalChainNode:
+		object := c.optional(n.Object)
+		if object == nil {
+			return anyShape
+		}
+		s, err := c.fields(object, n.Path, "")
+		if err != nil {
+			// a missing field is null
+			return anyShape
+		}
+		return s
+	case *FunctionCallNode:
+		return c.call(n)
+	case *ArrayNode:
+		return c.array(n)
+	case *MapNode:
+		s := &shape{typ: TypeMap, fields: make(map[string]*shape, len(n.Keys))}
+		for i, key := range n.Keys {
+			s.fields[key] = c.check(n.Values[i])
+		}
+		return s
+	case *LambdaNode:
+		c.lambda(n, nil)
+		return shapeOf(TypeFunction)
+	case *IndexNode:
+		return c.index(n)
+	case *SliceNode:
+		object := c.check(n.Object)
+		for _, bound := range []ASTNode{n.Start, n.End} {
+			if bound == nil {
+				continue
+			}
+			if s := c.check(bound); !TypeInt.accepts(s.typ) {
+				c.errorf(bound, ErrTypeMismatch, "slice bound must be int, got %s", s.typ)
+			}
+		}
+		if !(TypeArray | TypeString).accepts(object.typ) {
+			c.errorf(n.Object, ErrTypeMismatch, "cannot slice %s", object.typ)
+			return anyShape
+		}
+		return object
+	}
+
+	return anyShape
+}
+
+// optional returns the shape of the left operand of ?? or the object of ?.,
+// nil when it is a variable that is not declared.
+func (c *checker) optional(node ASTNode) *shape {
+	if v, ok := node.(*VariableNode); ok {
+		s, err := c.variable(v.Name)
+		if err != nil {
+			return nil
+		}
+		return s
+	}
+
+	return c.check(node)
+}
+
+// variable returns the shape of a dotted variable name from the lambda
+// parameters in scope and then from the schema.
+func (c *checker) variable(name string) (*shape, error) {
+	parts := strings.Split(name, ".")
+
+	for i := len(c.scopes) - 1; i >= 0; i-- {
+		if s, ok := c.scopes[i][parts[0]]; ok {
+			return c.fields(s, parts[1:], parts[0])
+		}
+	}
+
+	s, ok := c.vars[parts[0]]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownVariable, parts[0])
+	}
+
+	return c.fields(s, parts[1:], parts[0])
+}
+
+// fields returns the shape of the value found by following the fields from a
+// value of the shape, prefix is the name of the value for error messages.
+func (c *checker) fields(s *shape, fields []string, prefix string) (*shape, error) {
+	for _, field := range fields {
+		name := field
+		if prefix != "" {
+			name = prefix + "." + field
+		}
+
+		switch {
+		case s.typ == TypeAny:
+			return anyShape, nil
+		case s.fields != nil:
+			next, ok := s.fields[field]
+			if !ok {
+				return nil, fmt.Errorf("%w: %s", ErrUnknownVariable, name)
+			}
+			s = next
+		case s.typ&(TypeMap|TypeArray) != 0 && s.elem == nil:
+			return anyShape, nil
+		case s.typ == TypeArray:
+			if _, err := strconv.Atoi(field); err != nil {
+				return nil, fmt.Errorf("%w: %s, %s is an array", ErrUnknownVariable, name, prefix)
+			}
+			s = s.elem
+		default:
+			return nil, fmt.Errorf("%w: %s, %s is %s", ErrUnknownVariable, name, prefix, s.typ)
+		}
+
+		prefix = name
+	}
+
+	return s, nil
+}
+
+func (c *checker) unary(n *UnaryOperationNode) *shape {
+	operand := c.check(n.Operand)
+	if operand.typ == TypeAny {
+		if n.Operator == TokenTypeNot {
+			return shapeOf(TypeBool)
+		}
+		return anyShape
+	}
+
+	var accepted Type
+	switch n.Operator {
+	case TokenTypeNot:
+		accepted = TypeBool
+	case TokenTypeMinus, TokenTypePlus:
+		accepted = TypeNumber | TypeDuration
+	case TokenTypeBitwiseNot:
+		accepted = TypeInt
+	}
+
+	if operand.typ&accepted == 0 {
+		c.errorf(n, ErrTypeMismatch, "cannot apply %s to %s", n.Operator.symbol(), operand.typ)
+		return anyShape
+	}
+
+	return shapeOf(operand.typ & accepted)
+}
+
+func (c *checker) binary(n *BinaryOperationNode) *shape {
+	left, right := c.check(n.Left), c.check(n.Right)
+
+	if left.typ == TypeAny || right.typ == TypeAny {
+		if isComparison(n.Operator) {
+			return shapeOf(TypeBool)
+		}
+		return anyShape
+	}
+
+	var (
+		result Type
+		valid  bool
+	)
+	for _, l := range left.typ.kinds() {
+		for _, r := range right.typ.kinds() {
+			if t, ok := binaryType(n.Operator, l, r); ok {
+				result |= t
+				valid = true
+			}
+		}
+	}
+
+	if !valid {
+		c.errorf(n, ErrTypeMismatch, "cannot apply %s to %s and %s", n.Operator.symbol(), left.typ, right.typ)
+		return anyShape
+	}
+
+	return shapeOf(result)
+}
+
+// isComparison reports whether the operator evaluates to a bool.
+func isComparison(op TokenType) bool {
+	switch op {
+	case TokenTypeEqual, TokenTypeNotEqual,
+		TokenTypeLessThan, TokenTypeLessThanOrEqual,
+		TokenTypeGreaterThan, TokenTypeGreaterThanOrEqual,
+		TokenTypeIn, TokenTypeNotIn:
+		return true
+	}
+
+	return false
+}
+
+// binaryType returns the type of the result of the binary operator applied to
+// operands of the single types l and r, following evalBinaryOperation, and
+// whether the operator is applicable to them.
+func binaryType(op TokenType, l, r Type) (Type, bool) {
+	numbers := l&TypeNumber != 0 && r&TypeNumber != 0
+
+	switch op {
+	case TokenTypeEqual, TokenTypeNotEqual:
+		return TypeBool, l == r || numbers || l == typeNull || r == typeNull
+	case TokenTypeLessThan, TokenTypeLessThanOrEqual, TokenTypeGreaterThan, TokenTypeGreaterThanOrEqual:
+		return TypeBool, numbers || (l == r && l&(TypeString|TypeTime|TypeDuration) != 0)
+	case TokenTypeIn, TokenTypeNotIn:
+		switch r {
+		case TypeArray:
+			return TypeBool, true
+		case TypeString, TypeMap:
+			return TypeBool, l == TypeString
+		}
+		return TypeAny, false
+	case TokenTypeLeftShift, TokenTypeRightShift:
+		return TypeInt, l == TypeInt && r == TypeInt
+	}
+
+	switch {
+	case op == TokenTypePlus && l == TypeString && r == TypeString:
+		return TypeString, true
+	case l == TypeTime && r == TypeDuration && (op == TokenTypePlus || op == TokenTypeMinus),
+		l == TypeDuration && r == TypeTime && op == TokenTypePlus:
+		return TypeTime, true
+	case l == TypeTime && r == TypeTime && op == TokenTypeMinus:
+		return TypeDuration, true
+	case l == TypeDuration && r == TypeDuration:
+		switch op {
+		case TokenTypePlus, TokenTypeMinus:
+			return TypeDuration, true
+		case TokenTypeDivide:
+			return TypeFloat, true
+		}
+	case l == TypeDuration && r&(TypeInt|TypeFloat) != 0 && (op == TokenTypeMultiply || op == TokenTypeDivide),
+		l == TypeInt && r == TypeDuration && op == TokenTypeMultiply:
+		return TypeDuration, true
+	case numbers:
+		return numberType(op, l, r), true
+	}
+
+	return TypeAny, false
+}
+
+// numberType returns the type of the result of an arithmetic operator applied
+// to the number types l and r.
+func numberType(op TokenType, l, r Type) Type {
+	switch {
+	case l == TypeDecimal || r == TypeDecimal:
+		return TypeDecimal
+	case op == TokenTypeExponent:
+		// a float, or a big integer in big integer mode
+		return TypeInt | TypeFloat
+	case op == TokenTypeDivideInteger || op == TokenTypeModulo:
+		return TypeInt
+	case l == TypeFloat || r == TypeFloat:
+		return TypeFloat
+	}
+
+	return TypeInt
+}
+
+func (c *checker) array(n *ArrayNode) *shape {
+	var elem *shape
+	for _, element := range n.Elements {
+		s := c.check(element)
+		if elem == nil {
+			elem = s
+		} else {
+			elem = union(elem, s)
+		}
+	}
+
+	switch n.Type {
+	case arrayTypeInt:
+		elem = shapeOf(TypeInt)
+	case arrayTypeFloat:
+		elem = shapeOf(TypeFloat)
+	case arrayTypeString:
+		elem = shapeOf(TypeString)
+	case arrayTypeTime:
+		elem = shapeOf(TypeTime)
+	}
+
+	if elem == nil {
+		elem = anyShape
+	}
+
+	return &shape{typ: TypeArray, elem: elem}
+}
+
+func (c *checker) index(n *IndexNode) *shape {
+	object, index := c.check(n.Object), c.check(n.Index)
+
+	switch {
+	case object.typ == TypeAny:
+		return anyShape
+	case object.typ == TypeString || object.typ == TypeArray:
+		if !TypeInt.accepts(index.typ) {
+			c.errorf(n.Index, ErrTypeMismatch, "index of %s must be int, got %s", object.typ, index.typ)
+		}
+		if object.typ == TypeString {
+			return shapeOf(TypeString)
+		}
+		if object.elem != nil {
+			return object.elem
+		}
+		return anyShape
+	case object.typ == TypeMap:
+		if !TypeString.accepts(index.typ) {
+			c.errorf(n.Index, ErrTypeMismatch, "key of map must be string, got %s", index.typ)
+		}
+		key, ok := n.Index.(*StringLiteralNode)
+		if !ok || object.fields == nil {
+			return anyShape
+		}
+		if s, ok := object.fields[key.Value]; ok {
+			return s
+		}
+		c.errorf(n.Index, ErrUnknownVariable, "key %s", key.Value)
+		return anyShape
+	case object.typ&(TypeString|TypeArray|TypeMap) == 0:
+		c.errorf(n.Object, ErrTypeMismatch, "cannot index %s", object.typ)
+	}
+
+	return anyShape
+}
+
+// lambda checks the body of the lambda with its parameters bound to the
+// shapes of the arguments it is called with, or to anyShape when they are
+// not known.
+func (c *checker) lambda(n *LambdaNode, args []*shape) *shape {
+	params := make(map[string]*shape, len(n.Params))
+	for i, param := range n.Params {
+		params[param] = anyShape
+		if i < len(args) {
+			params[param] = args[i]
+		}
+	}
+
+	c.scopes = append(c.scopes, params)
+	defer func() { c.scopes = c.scopes[:len(c.scopes)-1] }()
+
+	return c.check(n.Body)
+}
+
+func (c *checker) call(n *FunctionCallNode) *shape {
+	if !c.engine.HasFunction(n.FunctionName) {
+		c.errorf(n, ErrUnknownFunction, "%s", n.FunctionName)
+		for _, arg := range n.Arguments {
+			c.check(arg)
+		}
+		return anyShape
+	}
+
+	args := make([]*shape, len(n.Arguments))
+	for i, arg := range n.Arguments {
+		if _, ok := arg.(*LambdaNode); ok && i > 0 {
+			continue // checked below with the elements of the array
+		}
+		args[i] = c.check(arg)
+	}
+
+	// the lambdas passed to the higher order functions are called with the
+	// elements of the array
+	var elem *shape
+	if len(args) > 0 && args[0] != nil {
+		elem = args[0].elem
+	}
+	if elem == nil {
+		elem = anyShape
+	}
+
+	var body *shape
+	for i, arg := range n.Arguments {
+		lambda, ok := arg.(*LambdaNode)
+		if !ok || i == 0 {
+			continue
+		}
+
+		switch n.FunctionName {
+		case "filter", "map":
+			body = c.lambda(lambda, []*shape{elem, shapeOf(TypeInt)})
+		case "reduce":
+			c.lambda(lambda, []*shape{anyShape, elem, shapeOf(TypeInt)})
+		default:
+			c.lambda(lambda, nil)
+		}
+		args[i] = shapeOf(TypeFunction)
+	}
+
+	sig, ok := c.engine.FunctionSignature(n.FunctionName)
+	if !ok {
+		return anyShape
+	}
+
+	if err := sig.checkCount(n.FunctionName, len(n.Arguments)); err != nil {
+		c.report(n, err)
+	}
+
+	for i, arg := range args {
+		if err := sig.checkType(n.FunctionName, i, arg.typ, arg.typ.String()); err != nil {
+			c.report(n.Arguments[i], err)
+		}
+	}
+
+	switch n.FunctionName {
+	case "filter":
+		if len(args) > 0 && args[0].typ == TypeArray {
+			return args[0]
+		}
+	case "map":
+		if body != nil {
+			return &shape{typ: TypeArray, elem: body}
+		}
+	}
+
+	return shapeOf(sig.Result)
+}
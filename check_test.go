@@ -0,0 +1,154 @@
+package expronaut
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+var checkSchema = Schema{
+	"age":   TypeInt,
+	"name":  TypeString,
+	"start": TypeTime,
+	"meta":  TypeMap,
+	"extra": TypeAny,
+	"user": Schema{
+		"name":   TypeString,
+		"tags":   ArrayOf(TypeString),
+		"active": TypeBool,
+	},
+	"items": ArrayOf(Schema{"price": TypeFloat, "qty": TypeInt}),
+}
+
+func TestCheck(t *testing.T) {
+	inputs := map[string]Type{
+		`age > 18 && name == "Ada"`:             TypeBool,
+		`age + 1.5`:                             TypeFloat,
+		`age // 2`:                              TypeInt,
+		`name + user.name`:                      TypeString,
+		`start + 1h`:                            TypeTime,
+		`start - start`:                         TypeDuration,
+		`user.tags[0] + "!"`:                    TypeString,
+		`user.tags[1:]`:                         TypeArray,
+		`"admin" in user.tags`:                  TypeBool,
+		`user.active ? age : 2.5`:               TypeInt | TypeFloat,
+		`missing ?? 5`:                          TypeInt,
+		`user?.missing`:                         TypeAny,
+		`meta.anything.deep`:                    TypeAny,
+		`extra.x + 1`:                           TypeAny,
+		`-age`:                                  TypeInt,
+		`~age << 2`:                             TypeInt,
+		`name =~ "^A"`:                          TypeBool,
+		`abs(age)`:                              TypeNumber,
+		`len(user.tags)`:                        TypeInt,
+		`sum(map(items, i => i.price * i.qty))`: TypeNumber,
+		`len(filter(items, (i, n) => n < i.qty))`: TypeInt,
+		`{"a": age}["a"] * 2`:                     TypeInt,
+		`[1, 2.5][0]`:                             TypeInt | TypeFloat,
+		`string[][0]`:                             TypeString,
+	}
+
+	for input, expected := range inputs {
+		typ, err := Check(input, checkSchema)
+		if err != nil {
+			t.Errorf("%s: %v", input, err)
+			continue
+		}
+		if typ != expected {
+			t.Errorf("%s: expected %s, got %s", input, expected, typ)
+		}
+	}
+}
+
+func TestCheckErrors(t *testing.T) {
+	inputs := map[string]struct {
+		err     error
+		message string
+	}{
+		`age > "18"`:                       {ErrTypeMismatch, `1:1: type mismatch: cannot apply > to int and string`},
+		`1 + user.nmae`:                    {ErrUnknownVariable, `1:5: unknown variable: user.nmae`},
+		`age.years`:                        {ErrUnknownVariable, `1:1: unknown variable: age.years, age is int`},
+		`color == "red"`:                   {ErrUnknownVariable, `1:1: unknown variable: color`},
+		`3 * nope(age)`:                    {ErrUnknownFunction, `1:5: unknown function: nope`},
+		`abs(name)`:                        {ErrArgumentType, `1:5: invalid argument type: abs expects argument 1 (x) of type number, got string`},
+		`len()`:                            {ErrArgumentCount, `1:1: wrong number of arguments: len expects 1 argument, got 0`},
+		`filter(items, i => i.qty > "2")`:  {ErrTypeMismatch, `1:20: type mismatch: cannot apply > to int and string`},
+		`user.active && age`:               {ErrTypeMismatch, `1:16: type mismatch: operand of && must be bool, got int`},
+		`age ? 1 : 2`:                      {ErrTypeMismatch, `1:1: type mismatch: condition must be bool, got int`},
+		`!name`:                            {ErrTypeMismatch, `1:1: type mismatch: cannot apply ! to string`},
+		`age =~ "a"`:                       {ErrTypeMismatch, `1:1: type mismatch: subject of =~ must be string, got int`},
+		`1 in name`:                        {ErrTypeMismatch, `1:1: type mismatch: cannot apply in to int and string`},
+		`user.tags["a"]`:                   {ErrTypeMismatch, `1:11: type mismatch: index of array must be int, got string`},
+		`start + 5`:                        {ErrTypeMismatch, `1:1: type mismatch: cannot apply + to time and int`},
+		"age > 1 &&\n  name * 2 > 1":       {ErrTypeMismatch, `2:3: type mismatch: cannot apply * to string and int`},
+		`user.active ? age : name + 1`:     {ErrTypeMismatch, `1:21: type mismatch: cannot apply + to string and int`},
+		`len(user.tags) > "a" || x && 1`:   {ErrTypeMismatch, `1:1: type mismatch: cannot apply > to int and string (and 2 more errors)`},
+		`map(items, i => i.cost)`:          {ErrUnknownVariable, `1:17: unknown variable: i.cost`},
+		`reduce(items, (acc, i) => i.qty)`: {nil, ``},
+	}
+
+	for input, expected := range inputs {
+		_, err := Check(input, checkSchema)
+		if !errors.Is(err, expected.err) {
+			t.Errorf("%s: expected %v, got %v", input, expected.err, err)
+			continue
+		}
+		if err != nil && err.Error() != expected.message {
+			t.Errorf("%s: expected %q, got %q", input, expected.message, err)
+		}
+	}
+}
+
+func TestCheckErrorList(t *testing.T) {
+	_, err := Check(`age > "18" || nope() || user.nmae`, checkSchema)
+
+	var errs CheckErrors
+	if !errors.As(err, &errs) {
+		t.Fatalf("expected CheckErrors, got %v", err)
+	}
+
+	expected := []string{
+		`1:1: type mismatch: cannot apply > to int and string`,
+		`1:15: unknown function: nope`,
+		`1:25: unknown variable: user.nmae`,
+	}
+	if len(errs) != len(expected) {
+		t.Fatalf("expected %d errors, got %v", len(expected), errs)
+	}
+	for i, e := range errs {
+		if e.Error() != expected[i] {
+			t.Errorf("expected %q, got %q", expected[i], e)
+		}
+	}
+
+	if !errors.Is(err, ErrUnknownFunction) || !errors.Is(err, ErrUnknownVariable) {
+		t.Errorf("expected the errors to match every problem, got %v", err)
+	}
+}
+
+func TestEngineCheck(t *testing.T) {
+	engine := NewEngine()
+	engine.DefineFunction("greet", Signature{
+		Params: []Param{{Name: "name", Type: TypeString}},
+		Result: TypeString,
+	}, func(ctx context.Context, args ...any) (any, error) {
+		return "Hello " + args[0].(string), nil
+	})
+
+	if typ, err := engine.Check(`greet(user.name) + "!"`, checkSchema); err != nil || typ != TypeString {
+		t.Errorf("expected string, got %s (%v)", typ, err)
+	}
+
+	if _, err := engine.Check(`greet(age)`, checkSchema); !errors.Is(err, ErrArgumentType) {
+		t.Errorf("expected ErrArgumentType, got %v", err)
+	}
+
+	if _, err := Check(`greet("Ada")`, checkSchema); !errors.Is(err, ErrUnknownFunction) {
+		t.Errorf("expected ErrUnknownFunction on the default engine, got %v", err)
+	}
+
+	if _, err := Check(`age`, Schema{"age": 18}); err == nil || !strings.Contains(err.Error(), "invalid schema") {
+		t.Errorf("expected an invalid schema error, got %v", err)
+	}
+}
@@ -0,0 +1,373 @@
+package expronaut
+
+import (
+	"fmt"
+	"math/bits"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// opcode identifies a single bytecode instruction.
+type opcode uint8
+
+const (
+	opConst         opcode = iota // push constants[a]
+	opLoad                        // push the value of variable slot a
+	opLoadOptional                // push the value of variable slot a, or null when it is undefined
+	opField                       // pop an object, push the value at fields[a] or null when missing
+	opIndex                       // pop an index and an object, push the element
+	opSlice                       // pop the bounds flagged in b (1 start, 2 end) and an object, push the slice
+	opBinary                      // pop two operands, push the result of operators[a]
+	opUnary                       // pop one operand, push the result of operators[a]
+	opMatch                       // pop a string, push whether it matches regexps[a], negated when b is 1
+	opJumpIfFalse                 // jump to a when the boolean on top is false, pop it otherwise
+	opJumpIfTrue                  // jump to a when the boolean on top is true, pop it otherwise
+	opBool                        // assert that the value on top is a boolean
+	opBranch                      // pop the condition on top, jump to a when it is false
+	opJumpIfNotNull               // jump to a when the value on top is not null, pop it otherwise
+	opJump                        // jump to a
+	opCall                        // pop b arguments, push the result of calling functions[a]
+	opArray                       // pop a elements, push them as an array of arrayTypes[b]
+	opMap                         // pop the values for keys[a], push them as a map
+	opLambda                      // push a closure over lambdas[a]
+	opNode                        // push the tree walking evaluation of nodes[a]
+)
+
+var opcodeNames = [...]string{
+	opConst:         "CONST",
+	opLoad:          "LOAD",
+	opLoadOptional:  "LOADOPT",
+	opField:         "FIELD",
+	opIndex:         "INDEX",
+	opSlice:         "SLICE",
+	opBinary:        "BINARY",
+	opUnary:         "UNARY",
+	opMatch:         "MATCH",
+	opJumpIfFalse:   "JMPF",
+	opJumpIfTrue:    "JMPT",
+	opBool:          "BOOL",
+	opBranch:        "BRANCH",
+	opJumpIfNotNull: "JMPNN",
+	opJump:          "JMP",
+	opCall:          "CALL",
+	opArray:         "ARRAY",
+	opMap:           "MAP",
+	opLambda:        "LAMBDA",
+	opNode:          "NODE",
+}
+
+func (op opcode) String() string {
+	if int(op) < len(opcodeNames) {
+		return opcodeNames[op]
+	}
+
+	return fmt.Sprintf("OP(%d)", op)
+}
+
+// instruction is a single bytecode instruction with up to two operands.
+type instruction struct {
+	op opcode
+	a  int32
+	b  int32
+}
+
+// variableSlot is a variable referenced by the bytecode, with its dotted name
+// already split into its parts.
+type variableSlot struct {
+	name  string
+	parts []string
+}
+
+// functionRef is a function referenced by the bytecode. The function pointer
+// is resolved when the bytecode is compiled; fn is nil when the function was
+// not known at that time and is looked up again when it is called.
+type functionRef struct {
+	name string
+	fn   bifFunc
+}
+
+// bytecode is the compact, immutable form of an AST executed by the vm.
+type bytecode struct {
+	instructions []instruction
+	constants    []any
+	variables    []variableSlot
+	functions    []functionRef
+	fields       [][]string
+	regexps      []*regexp.Regexp
+	keys         [][]string
+	lambdas      []compiledLambda
+	operators    []TokenType
+	nodes        []ASTNode
+	spans        []Span // the span of the node each instruction belongs to
+	maxStack     int
+}
+
+// compiledLambda is a lambda with its body lowered to bytecode.
+type compiledLambda struct {
+	node *LambdaNode
+	code *bytecode
+}
+
+// compiler lowers an AST into bytecode.
+type compiler struct {
+	engine    *Engine
+	code      *bytecode
+	depth     int
+	variables map[string]int
+	functions map[string]int
+	operators map[TokenType]int
+	span      Span // the span of the node being compiled
+}
+
+// compileNode lowers the AST into bytecode, resolving the functions in the
+// engine. Nodes the compiler does not know how to lower are evaluated by the
+// tree walker from within the vm.
+func (e *Engine) compileNode(node ASTNode) *bytecode {
+	c := &compiler{
+		engine:    e,
+		code:      &bytecode{},
+		variables: make(map[string]int),
+		functions: make(map[string]int),
+		operators: make(map[TokenType]int),
+	}
+
+	c.compile(node)
+
+	return c.code
+}
+
+func (c *compiler) compile(node ASTNode) {
+	// the instructions of the node are located at its span, the instructions
+	// of its children at theirs
+	defer func(span Span) { c.span = span }(c.span)
+	c.span = spanOf(node)
+
+	switch n := node.(type) {
+	case *IntLiteralNode:
+		c.emitConst(n.Value)
+	case *FloatLiteralNode:
+		c.emitConst(n.Value)
+	case *DurationLiteralNode:
+		c.emitConst(n.Value)
+	case *StringLiteralNode:
+		c.emitConst(n.Value)
+	case *NullLiteralNode:
+		c.emitConst(nil)
+	case *BooleanLiteralNode:
+		c.emitConst(n.Value)
+	case *VariableNode:
+		c.emit(opLoad, c.variable(n.Name), 0, 1)
+	case *BinaryOperationNode:
+		c.compile(n.Left)
+		c.compile(n.Right)
+		c.emit(opBinary, c.operator(n.Operator), 0, -1)
+	case *UnaryOperationNode:
+		c.compile(n.Operand)
+		c.emit(opUnary, c.operator(n.Operator), 0, 0)
+	case *LogicalOperationNode:
+		jump := opJumpIfFalse
+		switch n.Operator {
+		case TokenTypeAnd:
+		case TokenTypeOr:
+			jump = opJumpIfTrue
+		default:
+			c.emitNode(node)
+			return
+		}
+
+		// the left operand decides whether the right operand is evaluated at all
+		c.compile(n.Left)
+		pos := c.emit(jump, 0, 0, -1)
+		c.compile(n.Right)
+		c.emit(opBool, 0, 0, 0)
+		c.code.instructions[pos].a = int32(len(c.code.instructions))
+	case *RegexMatchNode:
+		if n.regexp == nil {
+			// patterns that are not literals are compiled when evaluated
+			c.emitNode(node)
+			return
+		}
+
+		var negate int32
+		if n.Operator == TokenTypeNotMatch {
+			negate = 1
+		}
+
+		c.compile(n.Subject)
+		c.code.regexps = append(c.code.regexps, n.regexp)
+		c.emit(opMatch, int32(len(c.code.regexps)-1), negate, 0)
+	case *NullCoalesceNode:
+		c.compileOptional(n.Left)
+		jump := c.emit(opJumpIfNotNull, 0, 0, -1)
+		c.compile(n.Right)
+		c.code.instructions[jump].a = int32(len(c.code.instructions))
+	case *OptionalChainNode:
+		c.compileOptional(n.Object)
+		c.code.fields = append(c.code.fields, n.Path)
+		c.emit(opField, int32(len(c.code.fields)-1), 0, 0)
+	case *IndexNode:
+		c.compile(n.Object)
+		c.compile(n.Index)
+		c.emit(opIndex, 0, 0, -1)
+	case *SliceNode:
+		c.compile(n.Object)
+
+		var bounds int32
+		if n.Start != nil {
+			c.compile(n.Start)
+			bounds |= 1
+		}
+		if n.End != nil {
+			c.compile(n.End)
+			bounds |= 2
+		}
+
+		c.emit(opSlice, 0, bounds, -bits.OnesCount32(uint32(bounds)))
+	case *ConditionalNode:
+		c.compile(n.Condition)
+		branch := c.emit(opBranch, 0, 0, -1)
+
+		// only one of the branches is evaluated, both leave a single value
+		depth := c.depth
+		c.compile(n.Consequent)
+		jump := c.emit(opJump, 0, 0, 0)
+
+		c.depth = depth
+		c.code.instructions[branch].a = int32(len(c.code.instructions))
+		c.compile(n.Alternative)
+		c.code.instructions[jump].a = int32(len(c.code.instructions))
+	case *FunctionCallNode:
+		for _, arg := range n.Arguments {
+			c.compile(arg)
+		}
+		argc := len(n.Arguments)
+		c.emit(opCall, c.function(n.FunctionName), int32(argc), 1-argc)
+	case *ArrayNode:
+		for _, element := range n.Elements {
+			c.compile(element)
+		}
+		c.emit(opArray, int32(len(n.Elements)), int32(slices.Index(arrayTypes, n.Type)), 1-len(n.Elements))
+	case *LambdaNode:
+		c.code.lambdas = append(c.code.lambdas, compiledLambda{node: n, code: c.engine.compileNode(n.Body)})
+		c.emit(opLambda, int32(len(c.code.lambdas)-1), 0, 1)
+	case *MapNode:
+		for _, value := range n.Values {
+			c.compile(value)
+		}
+		c.code.keys = append(c.code.keys, n.Keys)
+		c.emit(opMap, int32(len(c.code.keys)-1), 0, 1-len(n.Values))
+	default:
+		c.emitNode(node)
+	}
+}
+
+// compileOptional compiles the node so that an undefined variable results in
+// null instead of an error.
+func (c *compiler) compileOptional(node ASTNode) {
+	if n, ok := node.(*VariableNode); ok {
+		c.emit(opLoadOptional, c.variable(n.Name), 0, 1)
+		return
+	}
+
+	c.compile(node)
+}
+
+// emit appends an instruction, tracks the stack depth it results in and
+// returns its position.
+func (c *compiler) emit(op opcode, a, b int32, stackEffect int) int {
+	c.code.instructions = append(c.code.instructions, instruction{op: op, a: a, b: b})
+	c.code.spans = append(c.code.spans, c.span)
+
+	c.depth += stackEffect
+	if c.depth > c.code.maxStack {
+		c.code.maxStack = c.depth
+	}
+
+	return len(c.code.instructions) - 1
+}
+
+// emitNode emits an instruction that evaluates the node with the tree walker.
+func (c *compiler) emitNode(node ASTNode) {
+	c.code.nodes = append(c.code.nodes, node)
+	c.emit(opNode, int32(len(c.code.nodes)-1), 0, 1)
+}
+
+func (c *compiler) emitConst(value any) {
+	c.code.constants = append(c.code.constants, value)
+	c.emit(opConst, int32(len(c.code.constants)-1), 0, 1)
+}
+
+// variable returns the slot of the variable, allocating one on first use.
+func (c *compiler) variable(name string) int32 {
+	if slot, ok := c.variables[name]; ok {
+		return int32(slot)
+	}
+
+	c.code.variables = append(c.code.variables, variableSlot{name: name, parts: strings.Split(name, ".")})
+	c.variables[name] = len(c.code.variables) - 1
+
+	return int32(len(c.code.variables) - 1)
+}
+
+// function returns the index of the function, resolving it on first use.
+func (c *compiler) function(name string) int32 {
+	if idx, ok := c.functions[name]; ok {
+		return int32(idx)
+	}
+
+	fn, _ := c.engine.function(name)
+	c.code.functions = append(c.code.functions, functionRef{name: name, fn: fn})
+	c.functions[name] = len(c.code.functions) - 1
+
+	return int32(len(c.code.functions) - 1)
+}
+
+func (c *compiler) operator(op TokenType) int32 {
+	if idx, ok := c.operators[op]; ok {
+		return int32(idx)
+	}
+
+	c.code.operators = append(c.code.operators, op)
+	c.operators[op] = len(c.code.operators) - 1
+
+	return int32(len(c.code.operators) - 1)
+}
+
+// String returns a human readable listing of the bytecode.
+func (b *bytecode) String() string {
+	var sb strings.Builder
+
+	for i, ins := range b.instructions {
+		fmt.Fprintf(&sb, "%04d %-8s", i, ins.op)
+
+		switch ins.op {
+		case opConst:
+			fmt.Fprintf(&sb, " %v", b.constants[ins.a])
+		case opLoad, opLoadOptional:
+			fmt.Fprintf(&sb, " %s", b.variables[ins.a].name)
+		case opMatch:
+			fmt.Fprintf(&sb, " %q %d", b.regexps[ins.a], ins.b)
+		case opField:
+			fmt.Fprintf(&sb, " %s", strings.Join(b.fields[ins.a], "."))
+		case opBinary, opUnary:
+			fmt.Fprintf(&sb, " %s", b.operators[ins.a])
+		case opJumpIfFalse, opJumpIfTrue, opBranch, opJump, opJumpIfNotNull:
+			fmt.Fprintf(&sb, " %04d", ins.a)
+		case opCall:
+			fmt.Fprintf(&sb, " %s/%d", b.functions[ins.a].name, ins.b)
+		case opArray:
+			fmt.Fprintf(&sb, " %d %s", ins.a, arrayTypes[ins.b])
+		case opMap:
+			fmt.Fprintf(&sb, " %s", strings.Join(b.keys[ins.a], ","))
+		case opLambda:
+			fmt.Fprintf(&sb, " %s", b.lambdas[ins.a].node)
+		case opNode:
+			fmt.Fprintf(&sb, " %s", b.nodes[ins.a])
+		}
+
+		sb.WriteByte('\n')
+	}
+
+	return sb.String()
+}
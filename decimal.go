@@ -0,0 +1,478 @@
+package expronaut
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// DecimalDivisionPrecision is the number of digits after the decimal point
+// kept when dividing decimals whose quotient does not terminate.
+var DecimalDivisionPrecision int32 = 16
+
+// MaxDecimalDigits limits the size of the decimals created in decimal mode,
+// the number of digits before and after the decimal point, so that an
+// expression such as decimal(10) ^ 1000000000 fails instead of exhausting the
+// memory.
+var MaxDecimalDigits = 100000
+
+// ErrDecimalOverflow is returned when a decimal would exceed MaxDecimalDigits.
+var ErrDecimalOverflow = errors.New("decimal overflow")
+
+// decimalKey is the context key of the decimal mode.
+type decimalKey struct{}
+
+// WithDecimal returns a context in which expressions are evaluated in decimal
+// mode: arithmetic and comparisons involving a float are done with exact
+// decimals instead of float64, so 0.1 + 0.2 == 0.3 holds. Int arithmetic is
+// not affected.
+func WithDecimal(ctx context.Context) context.Context {
+	return context.WithValue(ctx, decimalKey{}, true)
+}
+
+// decimalMode reports whether the context is in decimal mode.
+func decimalMode(ctx context.Context) bool {
+	if ctx == nil {
+		return false
+	}
+
+	enabled, _ := ctx.Value(decimalKey{}).(bool)
+	return enabled
+}
+
+// RoundingMode selects how a decimal is rounded.
+type RoundingMode string
+
+const (
+	RoundHalfUp   RoundingMode = "half_up"   // to nearest, ties away from zero
+	RoundHalfEven RoundingMode = "half_even" // to nearest, ties to even (banker's rounding)
+	RoundHalfDown RoundingMode = "half_down" // to nearest, ties towards zero
+	RoundUp       RoundingMode = "up"        // away from zero
+	RoundDown     RoundingMode = "down"      // towards zero, truncate
+	RoundCeiling  RoundingMode = "ceiling"   // towards positive infinity
+	RoundFloor    RoundingMode = "floor"     // towards negative infinity
+)
+
+// valid reports whether the rounding mode is one of the known modes.
+func (m RoundingMode) valid() bool {
+	switch m {
+	case RoundHalfUp, RoundHalfEven, RoundHalfDown, RoundUp, RoundDown, RoundCeiling, RoundFloor:
+		return true
+	}
+
+	return false
+}
+
+// Decimal is an arbitrary-precision decimal number, an integer coefficient
+// with a number of digits after the decimal point. The scale is kept by
+// addition, subtraction and multiplication, so 1.10 + 2.20 is 3.30. The zero
+// value is 0. Decimals are immutable.
+type Decimal struct {
+	coef  *big.Int
+	scale int32
+}
+
+// ParseDecimal parses a decimal written as 12, -1.50 or 1.5e3.
+func ParseDecimal(s string) (Decimal, error) {
+	mantissa, exponent := s, int64(0)
+	if i := strings.IndexAny(s, "eE"); i >= 0 {
+		var err error
+		mantissa = s[:i]
+		exponent, err = strconv.ParseInt(s[i+1:], 10, 32)
+		if err != nil {
+			return Decimal{}, fmt.Errorf("invalid decimal %q", s)
+		}
+	}
+
+	var scale int64
+	if i := strings.IndexByte(mantissa, '.'); i >= 0 {
+		scale = int64(len(mantissa) - i - 1)
+		mantissa = mantissa[:i] + mantissa[i+1:]
+	}
+
+	coef, ok := new(big.Int).SetString(mantissa, 10)
+	if !ok || strings.ContainsAny(mantissa, "_") {
+		return Decimal{}, fmt.Errorf("invalid decimal %q", s)
+	}
+
+	scale -= exponent
+	// the digits of the coefficient once the exponent is applied
+	digits := int64(len(strings.TrimLeft(mantissa, "+-0"))) - min(scale, 0)
+	if scale > int64(MaxDecimalDigits) || (coef.Sign() != 0 && digits > int64(MaxDecimalDigits)) {
+		return Decimal{}, fmt.Errorf("%w: decimal %q exceeds %d digits", ErrDecimalOverflow, s, MaxDecimalDigits)
+	}
+
+	if scale < 0 {
+		if coef.Sign() != 0 {
+			coef.Mul(coef, pow10(-scale))
+		}
+		scale = 0
+	}
+
+	if scale > math.MaxInt32 {
+		return Decimal{}, fmt.Errorf("invalid decimal %q", s)
+	}
+
+	return Decimal{coef: coef, scale: int32(scale)}, nil
+}
+
+// NewDecimalFromInt returns the decimal of the int.
+func NewDecimalFromInt(i int) Decimal {
+	return Decimal{coef: big.NewInt(int64(i))}
+}
+
+// NewDecimalFromFloat returns the decimal of the shortest decimal form of the
+// float, so 0.1 becomes exactly 0.1.
+func NewDecimalFromFloat(f float64) (Decimal, error) {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return Decimal{}, fmt.Errorf("cannot convert %v to a decimal", f)
+	}
+
+	return ParseDecimal(strconv.FormatFloat(f, 'f', -1, 64))
+}
+
+// toDecimal converts a number to a decimal.
+func toDecimal(v any) (Decimal, bool) {
+	switch n := v.(type) {
+	case Decimal:
+		return n, true
+	case int:
+		return NewDecimalFromInt(n), true
+	case *big.Int:
+		return Decimal{coef: new(big.Int).Set(n)}, true
+	case float64:
+		d, err := NewDecimalFromFloat(n)
+		return d, err == nil
+	}
+
+	return Decimal{}, false
+}
+
+func (d Decimal) coefficient() *big.Int {
+	if d.coef == nil {
+		return new(big.Int)
+	}
+
+	return d.coef
+}
+
+// rescale returns the coefficient of the decimal at a larger scale.
+func (d Decimal) rescale(scale int32) *big.Int {
+	if scale == d.scale {
+		return d.coefficient()
+	}
+
+	return new(big.Int).Mul(d.coefficient(), pow10(int64(scale-d.scale)))
+}
+
+// align returns the coefficients of both decimals at the same scale.
+func align(a, b Decimal) (*big.Int, *big.Int, int32) {
+	scale := max(a.scale, b.scale)
+	return a.rescale(scale), b.rescale(scale), scale
+}
+
+// Add returns d + e.
+func (d Decimal) Add(e Decimal) Decimal {
+	a, b, scale := align(d, e)
+	return Decimal{coef: new(big.Int).Add(a, b), scale: scale}
+}
+
+// Sub returns d - e.
+func (d Decimal) Sub(e Decimal) Decimal {
+	a, b, scale := align(d, e)
+	return Decimal{coef: new(big.Int).Sub(a, b), scale: scale}
+}
+
+// Mul returns d * e.
+func (d Decimal) Mul(e Decimal) Decimal {
+	return Decimal{coef: new(big.Int).Mul(d.coefficient(), e.coefficient()), scale: d.scale + e.scale}
+}
+
+// Div returns d / e. A quotient that does not terminate is rounded half up
+// to DecimalDivisionPrecision digits after the decimal point.
+func (d Decimal) Div(e Decimal) (Decimal, error) {
+	if e.Sign() == 0 {
+		return Decimal{}, fmt.Errorf("decimal division by zero")
+	}
+
+	scale := max(DecimalDivisionPrecision, d.scale)
+	q := decimalFromRat(new(big.Rat).Quo(d.Rat(), e.Rat()), scale, RoundHalfUp)
+
+	return q.trim(d.scale), nil
+}
+
+// QuoRem returns the quotient of d / e truncated to an integer, and the
+// remainder d - e * quotient.
+func (d Decimal) QuoRem(e Decimal) (Decimal, Decimal, error) {
+	if e.Sign() == 0 {
+		return Decimal{}, Decimal{}, fmt.Errorf("decimal division by zero")
+	}
+
+	a, b, _ := align(d, e)
+	q := new(big.Int).Quo(a, b)
+	quo := Decimal{coef: q}
+
+	return quo, d.Sub(e.Mul(quo)), nil
+}
+
+// Pow returns d raised to the integer power n.
+func (d Decimal) Pow(n int) (Decimal, error) {
+	if n < 0 {
+		p, err := d.Pow(-n)
+		if err != nil {
+			return Decimal{}, err
+		}
+		return NewDecimalFromInt(1).Div(p)
+	}
+
+	// the digits of the result are about n times the digits of d
+	digits := float64(max(d.coefficient().BitLen()-1, 0)) * math.Log10(2)
+	if int64(d.scale)*int64(n) > int64(MaxDecimalDigits) || digits*float64(n) > float64(MaxDecimalDigits) {
+		return Decimal{}, fmt.Errorf("%w: %s ^ %d exceeds %d digits", ErrDecimalOverflow, d, n, MaxDecimalDigits)
+	}
+
+	coef := new(big.Int).Exp(d.coefficient(), big.NewInt(int64(n)), nil)
+	return Decimal{coef: coef, scale: d.scale * int32(n)}, nil
+}
+
+// Neg returns -d.
+func (d Decimal) Neg() Decimal {
+	return Decimal{coef: new(big.Int).Neg(d.coefficient()), scale: d.scale}
+}
+
+// Sign returns -1, 0 or 1 depending on the sign of d.
+func (d Decimal) Sign() int {
+	return d.coefficient().Sign()
+}
+
+// Cmp compares d and e and returns -1, 0 or 1. 1.10 and 1.1 are equal.
+func (d Decimal) Cmp(e Decimal) int {
+	a, b, _ := align(d, e)
+	return a.Cmp(b)
+}
+
+// Round rounds d to the number of digits after the decimal point using the
+// rounding mode. The result has exactly places digits after the decimal
+// point, Round(2.5, 2) is 2.50.
+func (d Decimal) Round(places int32, mode RoundingMode) Decimal {
+	if places < 0 {
+		places = 0
+	}
+
+	if d.scale <= places {
+		return Decimal{coef: d.rescale(places), scale: places}
+	}
+
+	return Decimal{coef: roundQuo(d.coefficient(), pow10(int64(d.scale-places)), mode), scale: places}
+}
+
+// trim removes trailing zeros after the decimal point, keeping at least keep
+// digits after it.
+func (d Decimal) trim(keep int32) Decimal {
+	coef, scale := d.coefficient(), d.scale
+	ten, r := big.NewInt(10), new(big.Int)
+	for scale > keep {
+		q, rem := new(big.Int).QuoRem(coef, ten, r)
+		if rem.Sign() != 0 {
+			break
+		}
+		coef, scale = q, scale-1
+	}
+
+	return Decimal{coef: coef, scale: scale}
+}
+
+// IsInteger reports whether d has no fractional part.
+func (d Decimal) IsInteger() bool {
+	return d.trim(0).scale == 0
+}
+
+// smallInt returns d as an int when it is an integer that fits in an int32.
+func (d Decimal) smallInt() (int, bool) {
+	t := d.trim(0)
+	if t.scale != 0 || !t.coefficient().IsInt64() {
+		return 0, false
+	}
+
+	i := t.coefficient().Int64()
+	if i < math.MinInt32 || i > math.MaxInt32 {
+		return 0, false
+	}
+
+	return int(i), true
+}
+
+// Rat returns d as a rational number.
+func (d Decimal) Rat() *big.Rat {
+	return new(big.Rat).SetFrac(d.coefficient(), pow10(int64(d.scale)))
+}
+
+// Float64 returns the float64 closest to d.
+func (d Decimal) Float64() float64 {
+	f, _ := d.Rat().Float64()
+	return f
+}
+
+// String returns d with all the digits of its scale, 3.30 or -0.05.
+func (d Decimal) String() string {
+	digits := new(big.Int).Abs(d.coefficient()).String()
+
+	var sb strings.Builder
+	if d.Sign() < 0 {
+		sb.WriteByte('-')
+	}
+
+	if d.scale == 0 {
+		sb.WriteString(digits)
+		return sb.String()
+	}
+
+	if pad := int(d.scale) - len(digits) + 1; pad > 0 {
+		digits = strings.Repeat("0", pad) + digits
+	}
+
+	point := len(digits) - int(d.scale)
+	sb.WriteString(digits[:point])
+	sb.WriteByte('.')
+	sb.WriteString(digits[point:])
+
+	return sb.String()
+}
+
+// MarshalJSON encodes d as a JSON number.
+func (d Decimal) MarshalJSON() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+// decimalFromRat rounds the rational number to a decimal with the given
+// number of digits after the decimal point.
+func decimalFromRat(r *big.Rat, scale int32, mode RoundingMode) Decimal {
+	num := new(big.Int).Mul(r.Num(), pow10(int64(scale)))
+	return Decimal{coef: roundQuo(num, r.Denom(), mode), scale: scale}
+}
+
+// roundQuo returns num / den rounded to an integer using the rounding mode.
+// den must be positive.
+func roundQuo(num, den *big.Int, mode RoundingMode) *big.Int {
+	q, r := new(big.Int).QuoRem(num, den, new(big.Int))
+	if r.Sign() == 0 {
+		return q
+	}
+
+	// the quotient is truncated towards zero, decide whether to move it one
+	// step away from zero
+	negative := num.Sign() < 0
+	half := new(big.Int).Abs(r)
+	half.Mul(half, big.NewInt(2))
+	cmp := half.Cmp(den)
+
+	var away bool
+	switch mode {
+	case RoundHalfEven:
+		away = cmp > 0 || (cmp == 0 && q.Bit(0) == 1)
+	case RoundHalfDown:
+		away = cmp > 0
+	case RoundUp:
+		away = true
+	case RoundDown:
+		away = false
+	case RoundCeiling:
+		away = !negative
+	case RoundFloor:
+		away = negative
+	default:
+		away = cmp >= 0
+	}
+
+	if !away {
+		return q
+	}
+
+	if negative {
+		return q.Sub(q, big.NewInt(1))
+	}
+
+	return q.Add(q, big.NewInt(1))
+}
+
+// pow10 returns 10^n.
+func pow10(n int64) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(n), nil)
+}
+
+// usesDecimal reports whether an operation on the two operands is done with
+// decimals: when one of them is a Decimal, or when one is a float in decimal
+// mode.
+func usesDecimal(ctx context.Context, left, right any) bool {
+	_, l := left.(Decimal)
+	_, r := right.(Decimal)
+	if l || r {
+		return true
+	}
+
+	_, l = left.(float64)
+	_, r = right.(float64)
+
+	return (l || r) && decimalMode(ctx)
+}
+
+// decimalArithmetic applies an arithmetic operator to two numbers as decimals.
+func decimalArithmetic(op TokenType, left, right any) (any, error) {
+	a, okA := toDecimal(left)
+	b, okB := toDecimal(right)
+	if !okA || !okB {
+		return nil, fmt.Errorf("type mismatch or operation not applicable (%T(%v), %s, %T(%v))", left, left, op, right, right)
+	}
+
+	switch op {
+	case TokenTypePlus:
+		return a.Add(b), nil
+	case TokenTypeMinus:
+		return a.Sub(b), nil
+	case TokenTypeMultiply:
+		return a.Mul(b), nil
+	case TokenTypeDivide:
+		return a.Div(b)
+	case TokenTypeDivideInteger:
+		q, _, err := a.QuoRem(b)
+		return q, err
+	case TokenTypeModulo:
+		_, r, err := a.QuoRem(b)
+		return r, err
+	case TokenTypeExponent:
+		// only integer exponents are exact
+		if n, ok := b.smallInt(); ok {
+			return a.Pow(n)
+		}
+
+		return math.Pow(a.Float64(), b.Float64()), nil
+	}
+
+	return nil, fmt.Errorf("unknown or unsupported operator: %v", op)
+}
+
+// applyDecimalComparison applies the comparison operator to the two decimals.
+func applyDecimalComparison(left, right Decimal, op TokenType) bool {
+	cmp := left.Cmp(right)
+
+	switch op {
+	case TokenTypeEqual:
+		return cmp == 0
+	case TokenTypeNotEqual:
+		return cmp != 0
+	case TokenTypeLessThan:
+		return cmp < 0
+	case TokenTypeLessThanOrEqual:
+		return cmp <= 0
+	case TokenTypeGreaterThan:
+		return cmp > 0
+	case TokenTypeGreaterThanOrEqual:
+		return cmp >= 0
+	}
+
+	return false
+}
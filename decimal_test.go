@@ -0,0 +1,239 @@
+package expronaut
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestParseDecimal(t *testing.T) {
+	inputs := map[string]string{
+		"0":       "0",
+		"12":      "12",
+		"-1.50":   "-1.50",
+		"0.05":    "0.05",
+		"-0.005":  "-0.005",
+		"1.5e3":   "1500",
+		"1.25e-1": "0.125",
+		"+3.10":   "3.10",
+	}
+
+	for input, expected := range inputs {
+		d, err := ParseDecimal(input)
+		if err != nil {
+			t.Errorf("%s: %v", input, err)
+			continue
+		}
+
+		if d.String() != expected {
+			t.Errorf("%s: expected %s, got %s", input, expected, d)
+		}
+	}
+
+	for _, input := range []string{"", "abc", "1.2.3", "1e", "1_000"} {
+		if _, err := ParseDecimal(input); err == nil {
+			t.Errorf("%q: expected an error", input)
+		}
+	}
+}
+
+func TestDecimalRound(t *testing.T) {
+	inputs := []struct {
+		value    string
+		places   int32
+		mode     RoundingMode
+		expected string
+	}{
+		{"2.345", 2, RoundHalfUp, "2.35"},
+		{"2.345", 2, RoundHalfEven, "2.34"},
+		{"2.355", 2, RoundHalfEven, "2.36"},
+		{"2.345", 2, RoundHalfDown, "2.34"},
+		{"2.341", 2, RoundUp, "2.35"},
+		{"2.349", 2, RoundDown, "2.34"},
+		{"-2.341", 2, RoundCeiling, "-2.34"},
+		{"-2.341", 2, RoundFloor, "-2.35"},
+		{"-2.345", 2, RoundHalfUp, "-2.35"},
+		{"-2.345", 2, RoundHalfEven, "-2.34"},
+		{"2.5", 0, RoundHalfEven, "2"},
+		{"3.5", 0, RoundHalfEven, "4"},
+		{"2.5", 2, RoundHalfUp, "2.50"},
+	}
+
+	for _, input := range inputs {
+		d, _ := ParseDecimal(input.value)
+		if got := d.Round(input.places, input.mode).String(); got != input.expected {
+			t.Errorf("round(%s, %d, %s): expected %s, got %s", input.value, input.places, input.mode, input.expected, got)
+		}
+	}
+}
+
+func TestDecimalMode(t *testing.T) {
+	ctx := WithDecimal(SetVariables(context.TODO(), map[string]any{
+		"price":    19.99,
+		"qty":      3,
+		"rate":     0.21,
+		"discount": decimalValue("0.10"),
+		"lines":    []any{0.1, 0.2, 0.3},
+	}))
+
+	inputs := map[string]string{
+		`0.1 + 0.2`:                          "0.3",
+		`0.1 + 0.2 == 0.3`:                   "true",
+		`1.10 + 2.20`:                        "3.3",
+		`price * qty`:                        "59.97",
+		`price * qty * (1 + rate)`:           "72.5637",
+		`round(price * qty * (1 + rate), 2)`: "72.56",
+		`round(2.345, 2, "half_even")`:       "2.34",
+		`round(2.345, 2)`:                    "2.35",
+		`1 / 3`:                              "0",
+		`1.0 / 3`:                            "0.3333333333333333",
+		`10.0 / 4`:                           "2.5",
+		`7.5 // 2`:                           "3",
+		`7.5 % 2`:                            "1.5",
+		`1.1 ^ 2`:                            "1.21",
+		`-price`:                             "-19.99",
+		`price > 19.98`:                      "true",
+		`price == 19.99`:                     "true",
+		`discount * 100`:                     "10.00",
+		`sum(lines)`:                         "0.6",
+		`sum(lines) == 0.6`:                  "true",
+		`sum(int[])`:                         "0",
+		`fv(1000.00, 0.05, 2)`:               "1102.5000",
+		`round(pv(1102.50, 0.05, 2), 2)`:     "1000.00",
+		`decimal("0.1") * 3`:                 "0.3",
+		`qty * 2`:                            "6",
+		`0.3 in [0.1 + 0.2]`:                 "true",
+	}
+
+	for input, expected := range inputs {
+		program, err := Compile(input)
+		if err != nil {
+			t.Errorf("%s: %v", input, err)
+			continue
+		}
+
+		for _, run := range []func() (any, error){
+			func() (any, error) { return program.Run(ctx, nil) },
+			func() (any, error) { return program.Tree().Evaluate(ctx) },
+		} {
+			out, err := run()
+			if err != nil {
+				t.Errorf("%s: %v", input, err)
+				continue
+			}
+
+			if fmt.Sprint(out) != expected {
+				t.Errorf("%s: expected %s, got %T(%v)", input, expected, out, out)
+			}
+		}
+	}
+
+	// the sum of an empty array stays exact
+	if out, err := Evaluate(ctx, `sum([])`); err != nil || out != (Decimal{}) {
+		t.Errorf("expected a zero Decimal, got %T(%v), %v", out, out, err)
+	}
+}
+
+func TestDecimalWithoutMode(t *testing.T) {
+	ctx := SetVariables(context.TODO(), map[string]any{"amount": decimalValue("10.25")})
+
+	inputs := map[string]string{
+		`0.1 + 0.2`:                     "0.30000000000000004",
+		`amount + 0.1`:                  "10.35",
+		`amount * 2`:                    "20.50",
+		`decimal("0.1") + decimal(0.2)`: "0.3",
+		`decimal(5) / 4`:                "1.25",
+		`round(amount, 1, "half_even")`: "10.2",
+		`round(2.345, 2)`:               "2.35",
+		`round(2.5)`:                    "3",
+		`sum(amount, 1)`:                "11.25",
+		`amount == 10.25`:               "true",
+	}
+
+	for input, expected := range inputs {
+		out, err := Evaluate(ctx, input)
+		if err != nil {
+			t.Errorf("%s: %v", input, err)
+			continue
+		}
+
+		if fmt.Sprint(out) != expected {
+			t.Errorf("%s: expected %s, got %T(%v)", input, expected, out, out)
+		}
+	}
+
+	errorInputs := map[string]string{
+		`decimal("abc")`:          "invalid decimal",
+		`amount / 0`:              "decimal division by zero",
+		`round(amount, 2, "odd")`: "rounding mode",
+		`round(amount, -1)`:       "non-negative int",
+	}
+
+	for input, expected := range errorInputs {
+		_, err := Evaluate(ctx, input)
+		if err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("%s: expected error containing %q, got %v", input, expected, err)
+		}
+	}
+}
+
+func TestDecimalOverflow(t *testing.T) {
+	ctx := WithDecimal(context.TODO())
+
+	for _, input := range []string{
+		`decimal(10) ^ 300000000`,
+		`decimal(10) ^ -300000000`,
+		`decimal("0.1") ^ 200000`,
+		`1.5 ^ 1000000`,
+		`decimal("1e300000000")`,
+		`decimal("1e-300000000")`,
+		`round(1.5, 1000000000)`,
+	} {
+		_, err := Evaluate(ctx, input)
+		if !errors.Is(err, ErrDecimalOverflow) {
+			t.Errorf("%s: expected %v, got %v", input, ErrDecimalOverflow, err)
+		}
+	}
+
+	inputs := map[string]string{
+		`decimal(10) ^ 1000 > 0`:      "true",
+		`decimal("0e300000000")`:      "0",
+		`decimal("1.5e2") * 2`:        "300",
+		`round(decimal("1.5"), 1000)`: "1.5" + strings.Repeat("0", 999),
+	}
+
+	for input, expected := range inputs {
+		out, err := Evaluate(ctx, input)
+		if err != nil {
+			t.Errorf("%s: %v", input, err)
+			continue
+		}
+
+		if fmt.Sprint(out) != expected {
+			t.Errorf("%s: expected %s, got %v", input, expected, out)
+		}
+	}
+}
+
+func TestDecimalMarshalJSON(t *testing.T) {
+	out, err := json.Marshal(map[string]any{"total": decimalValue("-12.50")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(out) != `{"total":-12.50}` {
+		t.Errorf("expected {\"total\":-12.50}, got %s", out)
+	}
+}
+
+func decimalValue(s string) Decimal {
+	d, err := ParseDecimal(s)
+	if err != nil {
+		panic(err)
+	}
+
+	return d
+}
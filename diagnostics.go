@@ -0,0 +1,233 @@
+package expronaut
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// ErrSyntax is returned when evaluating an ErrorNode, the part of a tree that
+// could not be parsed.
+var ErrSyntax = errors.New("syntax error")
+
+// Severity is the severity of a Diagnostic.
+type Severity int
+
+const (
+	// SeverityError is a problem that keeps the expression from compiling.
+	SeverityError Severity = iota + 1
+	// SeverityWarning is a problem that does not keep the expression from
+	// compiling.
+	SeverityWarning
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityError:
+		return "error"
+	case SeverityWarning:
+		return "warning"
+	}
+
+	return fmt.Sprintf("Severity(%d)", int(s))
+}
+
+// DiagnosticCode identifies the kind of problem a Diagnostic reports. Codes
+// are stable, unlike the messages, and can be used to filter or translate
+// diagnostics.
+type DiagnosticCode string
+
+const (
+	CodeIllegalCharacter   DiagnosticCode = "illegal-character"   // a character that is not part of the syntax
+	CodeUnterminatedString DiagnosticCode = "unterminated-string" // a string literal without its closing quote
+	CodeInvalidLiteral     DiagnosticCode = "invalid-literal"     // a number, duration or regular expression that cannot be parsed
+	CodeUnexpectedToken    DiagnosticCode = "unexpected-token"    // a token where the syntax expects another one
+	CodeUnclosedBracket    DiagnosticCode = "unclosed-bracket"    // a bracket the expression ends without closing
+	CodeMissingOperator    DiagnosticCode = "missing-operator"    // two operands without an operator between them
+	CodeTrailingInput      DiagnosticCode = "trailing-input"      // input after the end of the expression
+	CodeInvalidKey         DiagnosticCode = "invalid-key"         // a map literal key that is not a string
+	CodeDuplicateKey       DiagnosticCode = "duplicate-key"       // a key that appears twice in a map literal
+	CodeInvalidPath        DiagnosticCode = "invalid-path"        // a dotted variable name with an empty segment, a.b.
+	CodeInvalidParameter   DiagnosticCode = "invalid-parameter"   // a lambda parameter that is dotted or declared twice
+	CodeArgumentCount      DiagnosticCode = "argument-count"      // a call with the wrong number of arguments
+	CodeArgumentType       DiagnosticCode = "argument-type"       // a call with an argument of the wrong type
+	CodeUnknownFunction    DiagnosticCode = "unknown-function"    // a call to a function that is not registered
+)
+
+// Diagnostic is a problem found in an expression.
+type Diagnostic struct {
+	Severity   Severity
+	Code       DiagnosticCode
+	Message    string
+	Span       Span
+	Suggestion string // how to fix the problem, empty when there is no suggestion
+
+	err error // the error reported, nil when it is described by Message only
+}
+
+// String returns the diagnostic in the form line:column: severity: message.
+func (d Diagnostic) String() string {
+	s := fmt.Sprintf("%s: %s: %s", d.Span.Start, d.Severity, d.Message)
+	if d.Suggestion != "" {
+		s += " (" + d.Suggestion + ")"
+	}
+
+	return s
+}
+
+// error returns the diagnostic as an error located at its span.
+func (d Diagnostic) error() error {
+	err := d.err
+	if err == nil {
+		err = errors.New(d.Message)
+	}
+
+	return locate(err, d.Span)
+}
+
+// Diagnostics are the problems found in an expression.
+type Diagnostics []Diagnostic
+
+// HasErrors reports whether one of the diagnostics is an error.
+func (d Diagnostics) HasErrors() bool {
+	return slices.ContainsFunc(d, func(d Diagnostic) bool { return d.Severity == SeverityError })
+}
+
+// Err returns the first error as an *Error, nil when there are no errors.
+func (d Diagnostics) Err() error {
+	for _, diagnostic := range d {
+		if diagnostic.Severity == SeverityError {
+			return diagnostic.error()
+		}
+	}
+
+	return nil
+}
+
+// String returns the diagnostics, one per line.
+func (d Diagnostics) String() string {
+	lines := make([]string, len(d))
+	for i, diagnostic := range d {
+		lines[i] = diagnostic.String()
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// sort orders the diagnostics by their position in the source.
+func (d Diagnostics) sort() {
+	slices.SortStableFunc(d, func(a, b Diagnostic) int {
+		return a.Span.Start.Offset - b.Span.Start.Offset
+	})
+}
+
+// Parse parses the expression into a tree and returns it with all problems
+// found in the source: every illegal character, unterminated string and
+// syntax error, and any input following the expression. When there are
+// errors the tree is partial, the parts that could not be parsed are
+// ErrorNode placeholders.
+func Parse(expr string) (ASTNode, Diagnostics) {
+	lexer := NewLexer(expr)
+	p := NewParser(lexer)
+
+	tree := p.Parse()
+
+	diagnostics := append(lexer.diagnostics, p.diagnostics...)
+	diagnostics.sort()
+
+	return tree, diagnostics
+}
+
+// Validate reports all problems in the expression with the functions of the
+// default engine, see Engine.Validate.
+func Validate(expr string) Diagnostics {
+	return defaultEngine.Validate(expr)
+}
+
+// Validate reports all problems in the expression that Compile would
+// reject, instead of only the first. Calls to functions that are not
+// registered on the engine come with the closest registered name as
+// suggestion. The calls are only checked when the expression parses without
+// errors.
+func (e *Engine) Validate(expr string) Diagnostics {
+	tree, diagnostics := Parse(expr)
+	if diagnostics.HasErrors() {
+		return diagnostics
+	}
+
+	for _, err := range e.checkCalls(tree) {
+		var (
+			located *Error
+			unknown *UnknownFunctionError
+		)
+		errors.As(err, &located)
+
+		d := Diagnostic{
+			Severity: SeverityError,
+			Code:     CodeArgumentType,
+			Message:  located.Err.Error(),
+			Span:     located.Span,
+			err:      located.Err,
+		}
+
+		switch {
+		case errors.Is(err, ErrArgumentCount):
+			d.Code = CodeArgumentCount
+		case errors.As(err, &unknown):
+			d.Code = CodeUnknownFunction
+			if name := e.closestFunction(unknown.Name); name != "" {
+				d.Suggestion = fmt.Sprintf("did you mean %s?", name)
+			}
+		}
+
+		diagnostics = append(diagnostics, d)
+	}
+
+	diagnostics.sort()
+
+	return diagnostics
+}
+
+// closestFunction returns the name of the registered function that is the
+// most similar to name, empty when none is similar enough to be a typo.
+func (e *Engine) closestFunction(name string) string {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	var (
+		closest string
+		best    = max(1, len(name)/3) + 1
+	)
+	for candidate := range e.functions {
+		d := editDistance(strings.ToLower(name), strings.ToLower(candidate))
+		if d < best || (d == best && candidate < closest) {
+			closest, best = candidate, d
+		}
+	}
+
+	return closest
+}
+
+// editDistance returns the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+
+	return prev[len(b)]
+}
@@ -0,0 +1,179 @@
+package expronaut
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestParseDiagnostics(t *testing.T) {
+	inputs := map[string][]string{
+		`1 + 2`:                        nil,
+		`5min`:                         {"1:2 trailing-input"},
+		`{"a": 1}.a`:                   {"1:9 illegal-character", "1:10 trailing-input"},
+		`1 + # 2 @ 3`:                  {"1:5 illegal-character", "1:7 trailing-input", "1:9 illegal-character"},
+		`a = 1`:                        {"1:3 illegal-character", "1:5 trailing-input"},
+		`a & b`:                        {"1:3 illegal-character", "1:5 trailing-input"},
+		`x é`:                          {"1:3 illegal-character"},
+		`"abc`:                         {"1:1 unterminated-string"},
+		"name == `abc":                 {"1:9 unterminated-string"},
+		`1 + )`:                        {"1:5 unexpected-token"},
+		`1 +`:                          {"1:4 unexpected-token"},
+		`max(1 2)`:                     {"1:7 unexpected-token"},
+		`1 2 3`:                        {"1:3 trailing-input"},
+		`{"a": 1, "a": 2}`:             {"1:10 duplicate-key"},
+		`(x, x) => x`:                  {"1:5 invalid-parameter"},
+		`name =~ "["`:                  {"1:9 invalid-literal"},
+		`a.b. + a..c`:                  {"1:1 invalid-path", "1:8 invalid-path"},
+		`a?.b.`:                        {"1:4 invalid-path"},
+		`{1: 2}`:                       {"1:2 invalid-key"},
+		`[1, 2`:                        {"1:6 unclosed-bracket"},
+		"1 +\n 99999999999999999999 $": {"2:2 invalid-literal", "2:23 illegal-character"},
+	}
+
+	for input, expected := range inputs {
+		_, diagnostics := Parse(input)
+
+		var got []string
+		for _, d := range diagnostics {
+			got = append(got, d.Span.Start.String()+" "+string(d.Code))
+			if d.Severity != SeverityError || d.Message == "" {
+				t.Errorf("%s: unexpected diagnostic %s", input, d)
+			}
+		}
+
+		if !slices.Equal(got, expected) {
+			t.Errorf("%s: expected %q, got %q", input, expected, got)
+		}
+
+		if _, err := Compile(input); (err != nil) != diagnostics.HasErrors() {
+			t.Errorf("%s: expected Compile to fail with the diagnostics, got %v", input, err)
+		}
+	}
+}
+
+func TestParseRecovery(t *testing.T) {
+	inputs := map[string]struct {
+		tree        string
+		diagnostics []string
+	}{
+		`(1 + 2`:                   {"(1 PLUS 2)", []string{"1:7 unclosed-bracket"}},
+		`max(1`:                    {"max([1])", []string{"1:6 unclosed-bracket"}},
+		`max(min(1 2`:              {"max([min([1])])", []string{"1:11 unexpected-token", "1:12 unclosed-bracket"}},
+		`max(1, , 2)`:              {"max([1 <error> 2])", []string{"1:8 unexpected-token"}},
+		`[1, ) , 3]`:               {"[1, <error>, 3]", []string{"1:5 unexpected-token"}},
+		`max(1 2, len(), 3 +) * 2`: {"(max([1 len([]) (3 PLUS <error>)]) MULTIPLY 2)", []string{"1:7 unexpected-token", "1:20 unexpected-token"}},
+		`{"a": 1, b: 2, "c": }`:    {`{"a": 1, "c": <error>}`, []string{"1:10 invalid-key", "1:21 unexpected-token"}},
+		`1 + * 2`:                  {"(1 PLUS (<error> MULTIPLY 2))", []string{"1:5 unexpected-token"}},
+		`(1, 2) + 3`:               {"(1 PLUS 3)", []string{"1:3 unexpected-token"}},
+		`max(1)) * 2 + (`:          {"<error>(max([1]), (2 PLUS <error>))", []string{"1:7 trailing-input", "1:16 unexpected-token"}},
+		`a[1 2] + [1, 2`:           {"(a[1] PLUS [1, 2])", []string{"1:5 unexpected-token", "1:15 unclosed-bracket"}},
+		`a ? : b`:                  {"(a ? <error> : b)", []string{"1:5 unexpected-token"}},
+		`1 2 + * 3`:                {"<error>(1, 3)", []string{"1:3 trailing-input"}},
+		`1 2 - -3 == 4`:            {"<error>(1, (3 EQUAL 4))", []string{"1:3 trailing-input"}},
+	}
+
+	for input, expected := range inputs {
+		tree, diagnostics := Parse(input)
+
+		var got []string
+		for _, d := range diagnostics {
+			got = append(got, d.Span.Start.String()+" "+string(d.Code))
+		}
+
+		if !slices.Equal(got, expected.diagnostics) {
+			t.Errorf("%s: expected diagnostics %q, got %q", input, expected.diagnostics, got)
+		}
+
+		if tree == nil || tree.String() != expected.tree {
+			t.Errorf("%s: expected tree %s, got %v", input, expected.tree, tree)
+		}
+	}
+}
+
+func TestErrorNodeEvaluate(t *testing.T) {
+	tree, _ := Parse(`1 + * 2`)
+
+	_, err := tree.Evaluate(context.Background())
+	if !errors.Is(err, ErrSyntax) {
+		t.Fatalf("expected %v, got %v", ErrSyntax, err)
+	}
+
+	if err.Error() != "1:5: syntax error" {
+		t.Errorf("expected the error at the placeholder, got %v", err)
+	}
+}
+
+func TestDiagnosticSuggestion(t *testing.T) {
+	inputs := map[string]string{
+		`a = 1`:   "1:3: error: illegal character \"=\" (use == to compare values)",
+		`a | b`:   "1:3: error: illegal character \"|\" (use || for a logical or)",
+		`'abc`:    "1:1: error: unterminated string (add the closing ')",
+		`lenn(x)`: "1:1: error: unknown function: lenn (did you mean len?)",
+	}
+
+	for input, expected := range inputs {
+		diagnostics := Validate(input)
+		if len(diagnostics) == 0 || diagnostics[0].String() != expected {
+			t.Errorf("%s: expected %q, got %q", input, expected, diagnostics)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	inputs := map[string][]string{
+		`len("abc") + abs(-1)`:           nil,
+		`abz(1) + lenn("a")`:             {"1:1 unknown-function", "1:10 unknown-function"},
+		`len(1, 2) + sqrt("a")`:          {"1:1 argument-count", "1:5 argument-type", "1:18 argument-type"},
+		`len(1, 2) + sqrt("a") + 1 2`:    {"1:27 trailing-input"},
+		`nothinglike(1) + len([1])`:      {"1:1 unknown-function"},
+		`map([1], x => abs("a")) ?? foo`: {"1:19 argument-type"},
+	}
+
+	for input, expected := range inputs {
+		diagnostics := Validate(input)
+
+		var got []string
+		for _, d := range diagnostics {
+			got = append(got, d.Span.Start.String()+" "+string(d.Code))
+		}
+
+		if !slices.Equal(got, expected) {
+			t.Errorf("%s: expected %q, got %q", input, expected, got)
+		}
+	}
+
+	diagnostics := Validate(`lenn("a")`)
+	if !errors.Is(diagnostics.Err(), ErrUnknownFunction) {
+		t.Errorf("expected an unknown function to be an error, got %s", diagnostics)
+	}
+
+	engine := NewEngine()
+	engine.UnregisterFunction("len")
+	if diagnostics := engine.Validate(`len("a")`); len(diagnostics) != 1 || diagnostics[0].Code != CodeUnknownFunction {
+		t.Errorf("expected len to be unknown on the engine, got %s", diagnostics)
+	}
+}
+
+func TestDiagnosticsErr(t *testing.T) {
+	_, diagnostics := Parse("1 + 99999999999999999999 + #")
+
+	err := diagnostics.Err()
+	if !errors.Is(err, ErrIntegerOverflow) {
+		t.Errorf("expected ErrIntegerOverflow, got %v", err)
+	}
+
+	var located *Error
+	if !errors.As(err, &located) || located.Span.String() != "1:5-1:25" {
+		t.Errorf("expected an error located at 1:5-1:25, got %v", err)
+	}
+
+	if _, err := Compile("1 + 99999999999999999999 + #"); !errors.Is(err, ErrIntegerOverflow) {
+		t.Errorf("expected Compile to return the first error, got %v", err)
+	}
+
+	if Diagnostics(nil).Err() != nil {
+		t.Errorf("expected no error without diagnostics")
+	}
+}
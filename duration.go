@@ -0,0 +1,210 @@
+package expronaut
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// durationUnits are the units of a duration literal, longer units that share
+// a prefix with a shorter one come first.
+var durationUnits = []string{"ns", "us", "µs", "ms", "s", "m", "h", "d"}
+
+// durationEnd returns the end of the duration literal, such as 5m, 1.5h or
+// 2h30m, that starts at the position in the input, or 0 when there is none.
+func durationEnd(input string, position int) int {
+	end := 0
+
+	for i := position; i < len(input) && isDigit(input[i]); {
+		for i < len(input) && isDigit(input[i]) {
+			i++
+		}
+
+		if i+1 < len(input) && input[i] == '.' && isDigit(input[i+1]) {
+			i++
+			for i < len(input) && isDigit(input[i]) {
+				i++
+			}
+		}
+
+		unit := durationUnit(input[i:])
+		if unit == "" {
+			return 0
+		}
+
+		i += len(unit)
+		end = i
+	}
+
+	// 5min or 1s.x is not a duration
+	if end < len(input) && (isLetter(input[end]) || isDigit(input[end]) || input[end] == '.') {
+		return 0
+	}
+
+	return end
+}
+
+// durationUnit returns the duration unit the input starts with.
+func durationUnit(input string) string {
+	for _, unit := range durationUnits {
+		if strings.HasPrefix(input, unit) {
+			return unit
+		}
+	}
+
+	return ""
+}
+
+// parseDuration parses a duration literal. Next to the units known by
+// time.ParseDuration a literal may use d for days of 24 hours.
+func parseDuration(lit string) (time.Duration, error) {
+	var (
+		sb    strings.Builder
+		start int
+	)
+
+	for i := 0; i < len(lit); i++ {
+		if lit[i] != 'd' {
+			continue
+		}
+
+		// the number of days starts after the previous unit
+		j := i
+		for j > start && (isDigit(lit[j-1]) || lit[j-1] == '.') {
+			j--
+		}
+
+		days, err := strconv.ParseFloat(lit[j:i], 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration literal %s", lit)
+		}
+
+		sb.WriteString(lit[start:j])
+		sb.WriteString(strconv.FormatFloat(days*24, 'f', -1, 64))
+		sb.WriteByte('h')
+		start = i + 1
+	}
+
+	sb.WriteString(lit[start:])
+
+	d, err := time.ParseDuration(sb.String())
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration literal %s", lit)
+	}
+
+	return d, nil
+}
+
+// formatDuration returns the duration as a literal, 30d instead of 720h0m0s
+// and 2h30m instead of 2h30m0s.
+func formatDuration(d time.Duration) string {
+	const day = 24 * time.Hour
+
+	if d != 0 && d%day == 0 {
+		return fmt.Sprintf("%dd", d/day)
+	}
+
+	s := d.String()
+	s = strings.Replace(s, "m0s", "m", 1)
+	s = strings.Replace(s, "h0m", "h", 1)
+
+	return s
+}
+
+// durationArithmetic applies an arithmetic operator to times and durations.
+// It reports false when neither operand is a time or a duration, or the
+// operator does not apply to them:
+//
+//   - time + duration and duration + time are a time, time - duration too
+//   - time - time is the duration between them
+//   - duration + duration and duration - duration are a duration
+//   - duration * number and duration / number are a duration
+//   - duration / duration is a float64
+func durationArithmetic(op TokenType, left, right any) (any, bool, error) {
+	switch a := left.(type) {
+	case time.Time:
+		switch b := right.(type) {
+		case time.Duration:
+			switch op {
+			case TokenTypePlus:
+				return a.Add(b), true, nil
+			case TokenTypeMinus:
+				return a.Add(-b), true, nil
+			}
+		case time.Time:
+			if op == TokenTypeMinus {
+				return a.Sub(b), true, nil
+			}
+		}
+	case time.Duration:
+		switch b := right.(type) {
+		case time.Time:
+			if op == TokenTypePlus {
+				return b.Add(a), true, nil
+			}
+		case time.Duration:
+			var (
+				result int
+				ok     bool
+			)
+
+			switch op {
+			case TokenTypePlus:
+				result, ok = addInt(int(a), int(b))
+			case TokenTypeMinus:
+				result, ok = subInt(int(a), int(b))
+			case TokenTypeDivide:
+				return float64(a) / float64(b), true, nil
+			default:
+				return nil, false, nil
+			}
+
+			if !ok {
+				return nil, true, fmt.Errorf("%w: %s %s %s", ErrIntegerOverflow, formatDuration(a), op, formatDuration(b))
+			}
+
+			return time.Duration(result), true, nil
+		case int:
+			return scaleDuration(op, a, float64(b))
+		case float64:
+			return scaleDuration(op, a, b)
+		}
+	case int:
+		if b, ok := right.(time.Duration); ok && op == TokenTypeMultiply {
+			return scaleDuration(op, b, float64(a))
+		}
+	case float64:
+		if b, ok := right.(time.Duration); ok && op == TokenTypeMultiply {
+			return scaleDuration(op, b, a)
+		}
+	}
+
+	return nil, false, nil
+}
+
+// scaleDuration multiplies or divides the duration by the factor, rounding to
+// the nearest nanosecond.
+func scaleDuration(op TokenType, d time.Duration, factor float64) (any, bool, error) {
+	var f float64
+
+	switch op {
+	case TokenTypeMultiply:
+		f = float64(d) * factor
+	case TokenTypeDivide:
+		if factor == 0 {
+			return nil, true, fmt.Errorf("duration division by zero")
+		}
+		f = float64(d) / factor
+	default:
+		return nil, false, nil
+	}
+
+	n, err := floatToInt(math.Round(f))
+	if err != nil {
+		return nil, true, err
+	}
+
+	return time.Duration(n), true, nil
+}
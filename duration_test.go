@@ -0,0 +1,193 @@
+package expronaut
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDurationLiterals(t *testing.T) {
+	inputs := map[string]time.Duration{
+		`5m`:      5 * time.Minute,
+		`2h30m`:   2*time.Hour + 30*time.Minute,
+		`7d`:      7 * 24 * time.Hour,
+		`1.5h`:    90 * time.Minute,
+		`1d12h`:   36 * time.Hour,
+		`250ms`:   250 * time.Millisecond,
+		`10us`:    10 * time.Microsecond,
+		`10µs`:    10 * time.Microsecond,
+		`42ns`:    42,
+		`1h5d`:    121 * time.Hour,
+		`0.5d`:    12 * time.Hour,
+		`1m30s`:   90 * time.Second,
+		`-5m`:     -5 * time.Minute,
+		`(3d)`:    3 * 24 * time.Hour,
+		`[1h][0]`: time.Hour,
+	}
+
+	for input, expected := range inputs {
+		program, err := Compile(input)
+		if err != nil {
+			t.Errorf("%s: %v", input, err)
+			continue
+		}
+
+		for _, run := range []func() (any, error){
+			func() (any, error) { return program.Run(context.TODO(), nil) },
+			func() (any, error) { return program.Tree().Evaluate(context.TODO()) },
+		} {
+			out, err := run()
+			if err != nil {
+				t.Errorf("%s: %v", input, err)
+				continue
+			}
+
+			if out != expected {
+				t.Errorf("%s: expected %v, got %T(%v)", input, expected, out, out)
+			}
+		}
+	}
+
+	// a number followed by a word that is not a unit is not a duration
+	for _, input := range []string{`5min`, `1e3`, `2h30`, `1s.x`} {
+		if tok := NewLexer(input).NextToken(); tok.Type == TokenTypeDuration {
+			t.Errorf("%s: unexpected duration token %s", input, tok.Literal)
+		}
+	}
+}
+
+func TestDurationArithmetic(t *testing.T) {
+	created := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	ctx := SetVariables(context.TODO(), map[string]any{
+		"created": created,
+		"updated": created.Add(45 * 24 * time.Hour),
+		"timeout": 90 * time.Second,
+	})
+
+	inputs := map[string]string{
+		`created + 5m`:                         "2024-01-01 12:05:00 +0000 UTC",
+		`2h + created`:                         "2024-01-01 14:00:00 +0000 UTC",
+		`created - 1d`:                         "2023-12-31 12:00:00 +0000 UTC",
+		`updated - created`:                    "1080h0m0s",
+		`updated - created > 30d`:              "true",
+		`updated - created < 30d`:              "false",
+		`updated - 60d < created`:              "true",
+		`timeout == 1m30s`:                     "true",
+		`timeout >= 2m`:                        "false",
+		`timeout + 30s`:                        "2m0s",
+		`timeout - 2m`:                         "-30s",
+		`timeout * 2`:                          "3m0s",
+		`2 * timeout`:                          "3m0s",
+		`timeout * 1.5`:                        "2m15s",
+		`timeout / 3`:                          "30s",
+		`1h / 30m`:                             "2",
+		`-timeout`:                             "-1m30s",
+		`timeout in [30s, 90s]`:                "true",
+		`add(created, 1h)`:                     "2024-01-01 13:00:00 +0000 UTC",
+		`duration("36h") == 1d12h`:             "true",
+		`duration("-2d")`:                      "-48h0m0s",
+		`now() - created > 1d`:                 "true",
+		`diffdate(created, updated) == 45d`:    "true",
+		`created + 1h > created ? "ok" : "no"`: "ok",
+	}
+
+	for input, expected := range inputs {
+		program, err := Compile(input)
+		if err != nil {
+			t.Errorf("%s: %v", input, err)
+			continue
+		}
+
+		for _, run := range []func() (any, error){
+			func() (any, error) { return program.Run(ctx, nil) },
+			func() (any, error) { return program.Tree().Evaluate(ctx) },
+		} {
+			out, err := run()
+			if err != nil {
+				t.Errorf("%s: %v", input, err)
+				continue
+			}
+
+			if got := fmt.Sprint(out); got != expected {
+				t.Errorf("%s: expected %s, got %s", input, expected, got)
+			}
+		}
+	}
+}
+
+func TestDurationErrors(t *testing.T) {
+	ctx := SetVariables(context.TODO(), map[string]any{
+		"created": time.Now(),
+	})
+
+	inputs := map[string]string{
+		`5m + 1`:                "type mismatch",
+		`5m > 1`:                "type mismatch",
+		`5m % 2m`:               "type mismatch",
+		`created + created`:     "type mismatch",
+		`created * 2`:           "type mismatch",
+		`5m / 0`:                "duration division by zero",
+		`106751d + 1d`:          "integer overflow",
+		`duration("soon")`:      "invalid duration",
+		`duration(5)`:           "of type string or duration, got int",
+		`now(1)`:                "now expects no arguments, got 1",
+		`99999999999999999999h`: "invalid duration literal",
+	}
+
+	for input, expected := range inputs {
+		_, err := Evaluate(ctx, input)
+		if err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("%s: expected error containing %q, got %v", input, expected, err)
+		}
+	}
+}
+
+func TestDurationString(t *testing.T) {
+	inputs := map[string]string{
+		`5m`:             "5m",
+		`2h30m`:          "2h30m",
+		`7d`:             "7d",
+		`36h`:            "36h",
+		`1h0m5s`:         "1h5s",
+		`created + 30d`:  "(created PLUS 30d)",
+		`timeout > 1m5s`: "(timeout GREATER_THAN 1m5s)",
+	}
+
+	for input, expected := range inputs {
+		program, err := Compile(input)
+		if err != nil {
+			t.Errorf("%s: %v", input, err)
+			continue
+		}
+
+		if got := program.Tree().String(); got != expected {
+			t.Errorf("%s: expected %s, got %s", input, expected, got)
+		}
+	}
+}
+
+func TestDurationGoTemplate(t *testing.T) {
+	inputs := map[string]string{
+		`created + 5m`:        ".created.Add 300000000000",
+		`created - 1s`:        ".created.Add -1000000000",
+		`1s + created`:        ".created.Add 1000000000",
+		`timeout > 1m`:        "gt .timeout 60000000000",
+		`(created - 1d) + 1h`: "(.created.Add -86400000000000).Add 3600000000000",
+		`created + timeout`:   "add .created .timeout",
+	}
+
+	for input, expected := range inputs {
+		program, err := Compile(input)
+		if err != nil {
+			t.Errorf("%s: %v", input, err)
+			continue
+		}
+
+		if got := program.Tree().GoTemplate(); got != expected {
+			t.Errorf("%s: expected %s, got %s", input, expected, got)
+		}
+	}
+}
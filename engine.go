@@ -0,0 +1,225 @@
+package expronaut
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"sync"
+)
+
+// Engine compiles and evaluates expressions with its own set of functions.
+// Functions registered on an engine are only visible to the expressions it
+// compiles, so several libraries in one binary can each use their own engine
+// without fighting over function names. An Engine is safe for concurrent use,
+// functions may be registered while expressions are being evaluated.
+//
+// The package level functions, such as Compile, Evaluate and
+// RegisterFunction, use the default engine.
+type Engine struct {
+	mu         sync.RWMutex
+	functions  bif
+	signatures map[string]Signature
+	programs   *programCache
+}
+
+// defaultEngine is the engine used by the package level functions, its
+// functions are the BuiltinFunctions.
+var defaultEngine *Engine
+
+// engineKey is the context key of the engine evaluating an expression.
+type engineKey struct{}
+
+// NewEngine returns an engine with the builtin functions.
+func NewEngine() *Engine {
+	return newEngine(builtins(), maps.Clone(builtinSignatures))
+}
+
+// DefaultEngine returns the engine used by the package level functions.
+func DefaultEngine() *Engine {
+	return defaultEngine
+}
+
+func newEngine(functions bif, signatures map[string]Signature) *Engine {
+	e := &Engine{functions: functions, signatures: signatures}
+	e.programs = &programCache{engine: e, programs: make(map[string]*Program)}
+
+	return e
+}
+
+// Clone returns a new engine with a copy of the functions of the engine.
+func (e *Engine) Clone() *Engine {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	return newEngine(maps.Clone(e.functions), maps.Clone(e.signatures))
+}
+
+// RegisterFunction adds a function to the engine, replacing the function
+// with the same name. Programs compiled before the function was registered
+// call the function they were compiled with, while expressions evaluated
+// from their source call the new one. The function has no signature and
+// validates its own arguments.
+func (e *Engine) RegisterFunction(name string, function bifFunc) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.functions[name] = function
+	delete(e.signatures, name)
+	e.programs.reset()
+}
+
+// DefineFunction adds a function with a signature to the engine, replacing
+// the function with the same name. Calls to the function are checked against
+// the signature when an expression is compiled and before the function is
+// called, so the function receives the declared number of arguments of the
+// declared types. DefineFunction panics when a required or variadic parameter
+// follows an optional one.
+func (e *Engine) DefineFunction(name string, signature Signature, function bifFunc) {
+	if err := signature.validate(); err != nil {
+		panic(fmt.Sprintf("expronaut: DefineFunction(%q): %v", name, err))
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.functions[name] = signature.bind(name, function)
+	e.signatures[name] = signature
+	e.programs.reset()
+}
+
+// UnregisterFunction removes a function from the engine.
+func (e *Engine) UnregisterFunction(name string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	delete(e.functions, name)
+	delete(e.signatures, name)
+	e.programs.reset()
+}
+
+// FunctionSignature returns the signature of a function, it reports false
+// when the function was registered without one.
+func (e *Engine) FunctionSignature(name string) (Signature, bool) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	signature, ok := e.signatures[name]
+	return signature, ok
+}
+
+// HasFunction reports whether a function with the name is registered.
+func (e *Engine) HasFunction(name string) bool {
+	_, ok := e.function(name)
+	return ok
+}
+
+// function returns the function registered under the name.
+func (e *Engine) function(name string) (bifFunc, bool) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	fn, ok := e.functions[name]
+	return fn, ok
+}
+
+// Compile lexes and parses the expression and returns a reusable Program
+// bound to the engine. Functions are resolved when the expression is
+// compiled, a call to a function that is not registered is reported as an
+// UnknownFunctionError. Calls to functions with a signature are checked
+// against it.
+func (e *Engine) Compile(expr string) (*Program, error) {
+	tree, diagnostics := Parse(expr)
+	if err := diagnostics.Err(); err != nil {
+		return nil, err
+	}
+
+	if errs := e.checkCalls(tree); len(errs) > 0 {
+		return nil, errs[0]
+	}
+
+	return &Program{source: expr, tree: tree, code: e.compileNode(tree), engine: e}, nil
+}
+
+// MustCompile is like Compile but panics if the expression cannot be compiled.
+func (e *Engine) MustCompile(expr string) *Program {
+	program, err := e.Compile(expr)
+	if err != nil {
+		panic(fmt.Sprintf("expronaut: Compile(%q): %v", expr, err))
+	}
+
+	return program
+}
+
+// Evaluate compiles the expression, or reuses a previously compiled program
+// for it, and evaluates it with the variables stored in ctx.
+func (e *Engine) Evaluate(ctx context.Context, expr string) (any, error) {
+	program, err := e.programs.compile(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	return program.Run(ctx, nil)
+}
+
+// EvaluateBool is like Evaluate but expects a boolean result.
+func (e *Engine) EvaluateBool(ctx context.Context, expr string) (bool, error) {
+	program, err := e.programs.compile(expr)
+	if err != nil {
+		return false, err
+	}
+
+	return program.RunBool(ctx, nil)
+}
+
+// Exp evaluates a comparison with the variables given as key value pairs, see
+// the package level Exp.
+func (e *Engine) Exp(comparison string, params ...any) (bool, error) {
+	var dict map[string]any
+	if len(params) > 0 {
+		if len(params)%2 != 0 {
+			return false, errors.New("invalid dict call")
+		}
+
+		dict = make(map[string]any, len(params)/2)
+		for i := 0; i < len(params); i += 2 {
+			key, ok := params[i].(string)
+			if !ok {
+				return false, errors.New("dict keys must be strings")
+			}
+			dict[key] = params[i+1]
+		}
+	}
+
+	program, err := e.programs.compile(comparison)
+	if err != nil {
+		return false, err
+	}
+
+	ctx := context.TODO()
+	ctx = SetVariables(ctx, dict)
+
+	return program.RunBool(ctx, nil)
+}
+
+// withEngine returns a context in which functions are looked up in the
+// engine.
+func withEngine(ctx context.Context, e *Engine) context.Context {
+	if engineFrom(ctx) == e {
+		return ctx
+	}
+
+	return context.WithValue(ctx, engineKey{}, e)
+}
+
+// engineFrom returns the engine evaluating the expression, the default engine
+// when the context has none.
+func engineFrom(ctx context.Context) *Engine {
+	if ctx != nil {
+		if e, ok := ctx.Value(engineKey{}).(*Engine); ok {
+			return e
+		}
+	}
+
+	return defaultEngine
+}
@@ -0,0 +1,163 @@
+package expronaut
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestEngineIsolation(t *testing.T) {
+	engine := NewEngine()
+	engine.RegisterFunction("twice", func(ctx context.Context, args ...any) (any, error) {
+		return BuiltinFunctions.Mul(ctx, args[0], 2)
+	})
+	engine.RegisterFunction("plus", func(ctx context.Context, args ...any) (any, error) {
+		return BuiltinFunctions.Add(ctx, args[0], args[1])
+	})
+
+	ctx := SetVariables(context.TODO(), map[string]any{"items": []any{1, 2, 3}})
+
+	inputs := map[string]string{
+		`twice(21)`:                     "42",
+		`twice(abs(-2))`:                "4",
+		`map(items, x => twice(x))`:     "[2 4 6]",
+		`map(items, "twice(_x)")`:       "[2 4 6]",
+		`filter(items, "twice(x) > 4")`: "[3]",
+		`reduce(items, "plus", 0)`:      "6",
+	}
+
+	for input, expected := range inputs {
+		program, err := engine.Compile(input)
+		if err != nil {
+			t.Errorf("%s: %v", input, err)
+			continue
+		}
+
+		for _, run := range []func() (any, error){
+			func() (any, error) { return program.Run(ctx, nil) },
+			func() (any, error) { return engine.Evaluate(ctx, input) },
+		} {
+			out, err := run()
+			if err != nil {
+				t.Errorf("%s: %v", input, err)
+				continue
+			}
+
+			if got := fmt.Sprint(out); got != expected {
+				t.Errorf("%s: expected %s, got %s", input, expected, got)
+			}
+		}
+
+		// the function is unknown to the default engine and other engines
+		for _, other := range []*Engine{defaultEngine, NewEngine()} {
+			if _, err := other.Evaluate(ctx, input); err == nil || (!strings.Contains(err.Error(), "twice") && !strings.Contains(err.Error(), "plus")) {
+				t.Errorf("%s: expected an error for the unknown function, got %v", input, err)
+			}
+		}
+	}
+
+	if DefaultEngine().HasFunction("twice") {
+		t.Errorf("expected twice not to be registered on the default engine")
+	}
+}
+
+func TestEngineRegisterAgain(t *testing.T) {
+	engine := NewEngine()
+	ctx := context.TODO()
+
+	for i, define := range []func(bifFunc){
+		func(f bifFunc) { engine.RegisterFunction("answer", f) },
+		func(f bifFunc) { engine.DefineFunction("answer", Signature{Result: TypeInt}, f) },
+		func(f bifFunc) { engine.RegisterFunction("answer", f) },
+	} {
+		define(func(ctx context.Context, args ...any) (any, error) { return i, nil })
+
+		out, err := engine.Evaluate(ctx, `answer()`)
+		if err != nil || out != i {
+			t.Errorf("%d: expected %d, got %v (%v)", i, i, out, err)
+		}
+	}
+
+	engine.UnregisterFunction("answer")
+	if _, err := engine.Evaluate(ctx, `answer()`); err == nil {
+		t.Errorf("expected an error after the function was unregistered")
+	}
+}
+
+func TestEngineClone(t *testing.T) {
+	engine := NewEngine()
+	engine.RegisterFunction("answer", func(ctx context.Context, args ...any) (any, error) {
+		return 42, nil
+	})
+
+	clone := engine.Clone()
+	clone.UnregisterFunction("abs")
+
+	if !clone.HasFunction("answer") {
+		t.Errorf("expected the clone to keep the registered functions")
+	}
+	if clone.HasFunction("abs") {
+		t.Errorf("expected abs to be unregistered from the clone")
+	}
+	if !engine.HasFunction("abs") {
+		t.Errorf("expected abs to remain registered on the engine")
+	}
+
+	out, err := clone.Evaluate(context.TODO(), `answer() + 1`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != 43 {
+		t.Errorf("expected 43, got %v", out)
+	}
+
+	if _, err := clone.Evaluate(context.TODO(), `abs(-1)`); err == nil {
+		t.Errorf("expected an error for the unregistered function")
+	}
+}
+
+func TestEngineConcurrentRegistration(t *testing.T) {
+	engine := NewEngine()
+	program := engine.MustCompile(`abs(x) + 1`)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(2)
+
+		go func(i int) {
+			defer wg.Done()
+
+			engine.RegisterFunction(fmt.Sprintf("fn%d", i), func(ctx context.Context, args ...any) (any, error) {
+				return i, nil
+			})
+		}(i)
+
+		go func(i int) {
+			defer wg.Done()
+
+			out, err := program.Run(context.TODO(), map[string]any{"x": -i})
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if out != i+1 {
+				t.Errorf("x=%d: expected %d, got %v", -i, i+1, out)
+			}
+
+			if _, err := engine.Evaluate(context.TODO(), fmt.Sprintf("len([%d])", i)); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	out, err := engine.Evaluate(context.TODO(), `fn7()`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != 7 {
+		t.Errorf("expected 7, got %v", out)
+	}
+}
@@ -0,0 +1,80 @@
+package expronaut
+
+import (
+	"context"
+)
+
+// Resolver resolves the variables of an expression. Get receives the dotted
+// name of a variable split into its parts, user.address.city is passed as
+// []string{"user", "address", "city"}, and reports whether the variable is
+// defined. A variable that is defined may be null.
+//
+// Variables are only resolved when the expression uses them, so a resolver
+// can fetch them lazily from a database, a cache or a feature store. A
+// compiled program resolves every variable at most once per run, except in
+// the body of a lambda, which resolves its variables again on every call.
+// The path is not used after Get returns, Get may keep or modify it.
+type Resolver interface {
+	Get(path []string) (any, bool)
+}
+
+// ResolverFunc adapts an ordinary function to a Resolver.
+type ResolverFunc func(path []string) (any, bool)
+
+// Get calls f(path).
+func (f ResolverFunc) Get(path []string) (any, bool) {
+	return f(path)
+}
+
+// MapEnv is the Resolver used by SetVariables, it resolves variables from a
+// map. The parts after the first one are looked up in its values with
+// LookupPath.
+type MapEnv map[string]any
+
+// Get returns the value at the path in the map.
+func (e MapEnv) Get(path []string) (any, bool) {
+	return lookupPath(e, path)
+}
+
+// LookupPath follows the path through the value, walking maps, structs,
+// pointers, slices and getter methods the same way dotted variable names are
+// resolved. It can be used by a Resolver that fetches top level values and
+// leaves the rest of the path to expronaut.
+func LookupPath(value any, path []string) (any, bool) {
+	return lookupFields(value, path)
+}
+
+// resolverKey is the context key of the Resolver.
+type resolverKey struct{}
+
+// WithResolver returns a context in which the variables of expressions are
+// resolved by r.
+func WithResolver(ctx context.Context, r Resolver) context.Context {
+	return context.WithValue(ctx, resolverKey{}, r)
+}
+
+// SetVariables returns a context in which the variables of expressions are
+// resolved from the map. The map is also stored under the deprecated
+// ContextKey, so that functions reading it from the context keep working.
+func SetVariables(ctx context.Context, variables map[string]any) context.Context {
+	ctx = context.WithValue(ctx, ContextKey, variables)
+	return WithResolver(ctx, MapEnv(variables))
+}
+
+// resolverFrom returns the Resolver stored in the context. A map stored under
+// the deprecated ContextKey is used when there is none.
+func resolverFrom(ctx context.Context) (Resolver, bool) {
+	if ctx == nil {
+		return nil, false
+	}
+
+	if r, ok := ctx.Value(resolverKey{}).(Resolver); ok {
+		return r, true
+	}
+
+	if vars, ok := ctx.Value(ContextKey).(map[string]any); ok {
+		return MapEnv(vars), true
+	}
+
+	return nil, false
+}
@@ -0,0 +1,168 @@
+package expronaut
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// countingResolver resolves the top level variables from a map, counting how
+// often every variable is fetched.
+type countingResolver struct {
+	values map[string]any
+	calls  map[string]int
+}
+
+func (r *countingResolver) Get(path []string) (any, bool) {
+	r.calls[strings.Join(path, ".")]++
+
+	value, ok := r.values[path[0]]
+	if !ok {
+		return nil, false
+	}
+
+	return LookupPath(value, path[1:])
+}
+
+func TestResolver(t *testing.T) {
+	resolver := &countingResolver{
+		values: map[string]any{
+			"user":  map[string]any{"name": "Ada", "age": 36},
+			"limit": 40,
+			"other": 1,
+		},
+		calls: make(map[string]int),
+	}
+
+	ctx := WithResolver(context.TODO(), resolver)
+
+	program := MustCompile(`user.age < limit && user.age + 4 == limit && user.name == "Ada"`)
+
+	for _, run := range []func() (any, error){
+		func() (any, error) { return program.Run(ctx, nil) },
+		func() (any, error) { return program.Tree().Evaluate(ctx) },
+	} {
+		out, err := run()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if out != true {
+			t.Errorf("expected true, got %v", out)
+		}
+	}
+
+	if resolver.calls["other"] != 0 {
+		t.Errorf("expected unused variables not to be resolved, got %d calls", resolver.calls["other"])
+	}
+
+	// the vm resolves user.age once, the tree walker every time it is used
+	if resolver.calls["user.age"] != 3 {
+		t.Errorf("expected user.age to be resolved 3 times, got %d", resolver.calls["user.age"])
+	}
+
+	_, err := program.Run(WithResolver(context.TODO(), &countingResolver{calls: make(map[string]int)}), nil)
+
+	var undefined *UndefinedVariableError
+	if !errors.As(err, &undefined) || undefined.Name != "user.age" {
+		t.Errorf("expected user.age to be undefined, got %v", err)
+	}
+}
+
+func TestResolverFunc(t *testing.T) {
+	features := ResolverFunc(func(path []string) (any, bool) {
+		if path[0] != "feature" || len(path) != 2 {
+			return nil, false
+		}
+		return strings.HasPrefix(path[1], "new"), true
+	})
+
+	inputs := map[string]string{
+		`feature.newCheckout`:                     "true",
+		`feature.oldCheckout`:                     "false",
+		`feature.newSearch ? "new" : "old"`:       "new",
+		`map([1, 2], x => feature.newX && x > 1)`: "[false true]",
+	}
+
+	ctx := WithResolver(context.TODO(), features)
+	for input, expected := range inputs {
+		out, err := Evaluate(ctx, input)
+		if err != nil {
+			t.Errorf("%s: %v", input, err)
+			continue
+		}
+
+		if got := fmt.Sprint(out); got != expected {
+			t.Errorf("%s: expected %s, got %s", input, expected, got)
+		}
+	}
+
+	if _, err := Evaluate(ctx, `feature`); err == nil {
+		t.Errorf("expected feature to be undefined")
+	}
+}
+
+func TestResolverModifiesPath(t *testing.T) {
+	resolver := ResolverFunc(func(path []string) (any, bool) {
+		defer func() { path[0] = "modified" }()
+
+		if path[0] != "user" {
+			return nil, false
+		}
+		return LookupPath(map[string]any{"name": "Ada"}, path[1:])
+	})
+
+	ctx := WithResolver(context.TODO(), resolver)
+	program := MustCompile(`user.name`)
+
+	for i := 0; i < 2; i++ {
+		out, err := program.Run(ctx, nil)
+		if err != nil || out != "Ada" {
+			t.Errorf("run %d: expected Ada, got %v (%v)", i, out, err)
+		}
+	}
+}
+
+func TestMapEnv(t *testing.T) {
+	env := MapEnv{"user": map[string]any{"name": "Ada", "manager": nil}}
+
+	if value, ok := env.Get([]string{"user", "name"}); !ok || value != "Ada" {
+		t.Errorf("expected Ada, got %v", value)
+	}
+
+	if value, ok := env.Get([]string{"user", "manager"}); !ok || value != nil {
+		t.Errorf("expected a defined null, got %v, %v", value, ok)
+	}
+
+	if _, ok := env.Get([]string{"user", "email"}); ok {
+		t.Errorf("expected user.email to be undefined")
+	}
+
+	out, err := Evaluate(WithResolver(context.TODO(), env), `user.name`)
+	if err != nil || out != "Ada" {
+		t.Errorf("expected Ada, got %v, %v", out, err)
+	}
+}
+
+func TestContextKeyFallback(t *testing.T) {
+	ctx := context.WithValue(context.TODO(), ContextKey, map[string]any{"a": 1})
+
+	out, err := Evaluate(ctx, `a + 1`)
+	if err != nil || out != 2 {
+		t.Errorf("expected 2, got %v, %v", out, err)
+	}
+
+	// a resolver takes precedence over the map under ContextKey
+	out, err = Evaluate(SetVariables(ctx, map[string]any{"a": 10}), `a + 1`)
+	if err != nil || out != 11 {
+		t.Errorf("expected 11, got %v, %v", out, err)
+	}
+
+	// functions reading the map under ContextKey keep working
+	vars, ok := SetVariables(context.TODO(), map[string]any{"a": 10}).Value(ContextKey).(map[string]any)
+	if !ok || vars["a"] != 10 {
+		t.Errorf("expected the variables under ContextKey, got %v", vars)
+	}
+}
@@ -2,8 +2,6 @@ package expronaut
 
 import (
 	"context"
-	"errors"
-	"fmt"
 )
 
 func ToGoTemplate(comparison string) string {
@@ -14,39 +12,15 @@ func ToGoTemplate(comparison string) string {
 	return tree.GoTemplate()
 }
 
-func SetVariables(ctx context.Context, variables map[string]any) context.Context {
-	return context.WithValue(ctx, ContextKey, variables)
-}
-
+// Evaluate compiles the comparison, or reuses a previously compiled program for
+// it, and evaluates it with the variables stored in ctx.
 func Evaluate(ctx context.Context, comparison string) (any, error) {
-	lexer := NewLexer(comparison)
-
-	if lexer.errors != nil && len(lexer.errors) > 0 {
-		return nil, lexer.errors[0]
-	}
-
-	p := NewParser(lexer)
-	tree := p.Parse()
-
-	if p.errors != nil && len(p.errors) > 0 {
-		return nil, p.errors[0]
-	}
-
-	return tree.Evaluate(ctx)
+	return defaultEngine.Evaluate(ctx, comparison)
 }
 
+// EvaluateBool is like Evaluate but expects a boolean result.
 func EvaluateBool(ctx context.Context, comparison string) (bool, error) {
-	ev, err := Evaluate(ctx, comparison)
-	if err != nil {
-		return false, err
-	}
-
-	b, ok := ev.(bool)
-	if !ok {
-		return false, fmt.Errorf("non-boolean result")
-	}
-
-	return b, nil
+	return defaultEngine.EvaluateBool(ctx, comparison)
 }
 
 // Exp evaluates a comparison expression with the given variables.
@@ -57,24 +31,5 @@ func EvaluateBool(ctx context.Context, comparison string) (bool, error) {
 //	{{ if exp "foo == 5 && bar == 10", "foo", 5, "bar", 10 }} Hello {{ end }}
 //	{{ if exp "foo == 5 && bar == 10", "foo", 5, "bar", 10 }} Hello {{ end }}
 func Exp(comparison string, params ...any) (bool, error) {
-	var dict map[string]any
-	if len(params) > 0 {
-		if len(params)%2 != 0 {
-			return false, errors.New("invalid dict call")
-		}
-
-		dict = make(map[string]any, len(params)/2)
-		for i := 0; i < len(params); i += 2 {
-			key, ok := params[i].(string)
-			if !ok {
-				return false, errors.New("dict keys must be strings")
-			}
-			dict[key] = params[i+1]
-		}
-	}
-
-	ctx := context.TODO()
-	ctx = SetVariables(ctx, dict)
-
-	return EvaluateBool(ctx, comparison)
+	return defaultEngine.Exp(comparison, params...)
 }
@@ -0,0 +1,224 @@
+package expronaut
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+// typeFields are the fields and getter methods of a type that can be
+// accessed by name from an expression.
+type typeFields struct {
+	fields  map[string][]int // index path of the exported struct fields
+	methods map[string]int   // index of the exported methods without arguments and with a single result that is not an error
+}
+
+// fieldCache holds the typeFields of every type seen so far, so that the
+// reflection work is only done once per type.
+var fieldCache sync.Map // map[reflect.Type]*typeFields
+
+// fieldsOf returns the accessible fields and methods of the type. The fields
+// of a pointer to a struct are the fields of the struct.
+func fieldsOf(t reflect.Type) *typeFields {
+	if cached, ok := fieldCache.Load(t); ok {
+		return cached.(*typeFields)
+	}
+
+	tf := &typeFields{
+		fields:  make(map[string][]int),
+		methods: make(map[string]int),
+	}
+
+	st := t
+	if st.Kind() == reflect.Pointer {
+		st = st.Elem()
+	}
+
+	if st.Kind() == reflect.Struct {
+		for _, field := range reflect.VisibleFields(st) {
+			if !field.IsExported() {
+				continue
+			}
+
+			name, skip := fieldName(field)
+			if skip {
+				continue
+			}
+
+			// fields of embedded structs do not shadow the fields of the struct
+			if _, exists := tf.fields[name]; !exists || len(field.Index) == 1 {
+				tf.fields[name] = field.Index
+			}
+			if _, exists := tf.fields[field.Name]; !exists {
+				tf.fields[field.Name] = field.Index
+			}
+		}
+	}
+
+	if t.Kind() != reflect.Interface {
+		for i := 0; i < t.NumMethod(); i++ {
+			method := t.Method(i)
+			// a method like Close() error does something rather than get something
+			if method.Type.NumIn() == 1 && method.Type.NumOut() == 1 && method.Type.Out(0) != errorType {
+				tf.methods[method.Name] = i
+			}
+		}
+	}
+
+	cached, _ := fieldCache.LoadOrStore(t, tf)
+	return cached.(*typeFields)
+}
+
+// fieldName returns the name of the struct field in expressions, taken from
+// its expr tag, its json tag or its Go name, and whether the field is
+// excluded with a "-" tag.
+func fieldName(field reflect.StructField) (string, bool) {
+	for _, key := range []string{"expr", "json"} {
+		tag, ok := field.Tag.Lookup(key)
+		if !ok {
+			continue
+		}
+
+		name, _, _ := strings.Cut(tag, ",")
+		if name == "-" {
+			return "", true
+		}
+		if name != "" {
+			return name, false
+		}
+	}
+
+	return field.Name, false
+}
+
+// fieldValue returns the value of the named field of a struct, the result of
+// calling the named getter method, the value of a key of a map or the element
+// at an index of a slice, following pointers. A field or method is found by
+// its tag name, its Go name, or its Go name with the first letter in lower
+// case.
+func fieldValue(object any, name string) (any, bool) {
+	rv := reflect.ValueOf(object)
+	if !rv.IsValid() {
+		return nil, false
+	}
+
+	for {
+		if (rv.Kind() == reflect.Pointer || rv.Kind() == reflect.Interface) && rv.IsNil() {
+			return nil, false
+		}
+
+		if rv.Kind() != reflect.Interface {
+			tf := fieldsOf(rv.Type())
+
+			if index, ok := lookupName(tf.fields, name); ok {
+				v := rv
+				if v.Kind() == reflect.Pointer {
+					v = v.Elem()
+				}
+
+				field, err := v.FieldByIndexErr(index)
+				if err != nil {
+					// a nil embedded pointer
+					return nil, false
+				}
+				return fieldInterface(field), true
+			}
+
+			if index, ok := lookupName(tf.methods, name); ok {
+				return callGetter(rv, index), true
+			}
+		}
+
+		if rv.Kind() != reflect.Pointer && rv.Kind() != reflect.Interface {
+			break
+		}
+		rv = rv.Elem()
+	}
+
+	switch rv.Kind() {
+	case reflect.Map:
+		if rv.Type().Key().Kind() != reflect.String {
+			return nil, false
+		}
+
+		value := rv.MapIndex(reflect.ValueOf(name).Convert(rv.Type().Key()))
+		if !value.IsValid() {
+			return nil, false
+		}
+		return fieldInterface(value), true
+	case reflect.Slice, reflect.Array:
+		i, err := strconv.Atoi(name)
+		if err != nil || i < 0 || i >= rv.Len() {
+			return nil, false
+		}
+		return fieldInterface(rv.Index(i)), true
+	}
+
+	return nil, false
+}
+
+// lookupName looks up the name, or the name with its first letter in upper
+// case, in the fields or methods of a type.
+func lookupName[T any](names map[string]T, name string) (T, bool) {
+	if value, ok := names[name]; ok {
+		return value, true
+	}
+
+	r, size := utf8.DecodeRuneInString(name)
+	if unicode.IsLower(r) {
+		value, ok := names[string(unicode.ToUpper(r))+name[size:]]
+		return value, ok
+	}
+
+	var zero T
+	return zero, false
+}
+
+// fieldInterface returns the value as an interface, a nil pointer or
+// interface becomes null.
+func fieldInterface(v reflect.Value) any {
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+	}
+
+	return v.Interface()
+}
+
+// getterPanic is what fieldValue panics with when a getter method panics. It
+// crosses Resolver.Get, which cannot return an error, and is turned back into
+// an error by recoverGetter where the variable or field is read.
+type getterPanic struct {
+	err error
+}
+
+// callGetter calls the getter method at the index of the value.
+func callGetter(rv reflect.Value, index int) any {
+	defer func() {
+		if r := recover(); r != nil {
+			panic(getterPanic{fmt.Errorf("%s method panicked: %v", rv.Type().Method(index).Name, r)})
+		}
+	}()
+
+	return fieldInterface(rv.Method(index).Call(nil)[0])
+}
+
+// recoverGetter returns the error of a getterPanic recovered as r, nil when
+// nothing panicked. Other panics are passed on.
+func recoverGetter(r any) error {
+	if r == nil {
+		return nil
+	}
+
+	if p, ok := r.(getterPanic); ok {
+		return p.err
+	}
+
+	panic(r)
+}
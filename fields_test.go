@@ -0,0 +1,240 @@
+package expronaut
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testAddress struct {
+	Street string `json:"street"`
+	City   string `expr:"city" json:"town"`
+}
+
+type testAudit struct {
+	CreatedBy string `json:"created_by"`
+	Version   int
+}
+
+type testUser struct {
+	testAudit
+
+	ID       int64             `json:"id,omitempty"`
+	Name     string            `json:"name"`
+	Password string            `json:"-"`
+	Address  *testAddress      `json:"address"`
+	Manager  *testUser         `json:"manager"`
+	Tags     []string          `json:"tags"`
+	Labels   map[string]string `json:"labels"`
+	Scores   map[string]int    `json:"scores"`
+	Orders   []testOrder       `json:"orders"`
+	Born     time.Time         `json:"born"`
+	Extra    any               `json:"extra"`
+
+	secret string
+}
+
+func (u testUser) FullName() string {
+	return u.Name + " (" + u.Address.City + ")"
+}
+
+func (u *testUser) IsAdmin() bool {
+	return u.Labels["role"] == "admin"
+}
+
+func (u *testUser) Greet(greeting string) string {
+	return greeting + " " + u.Name
+}
+
+func (u *testUser) Close() error {
+	panic("methods returning an error must not be called as getters")
+}
+
+type testGauge struct{}
+
+func (testGauge) Boom() string {
+	panic("boom")
+}
+
+type testOrder struct {
+	Total float32 `json:"total"`
+	Paid  bool    `json:"paid"`
+}
+
+func TestStructVariables(t *testing.T) {
+	user := &testUser{
+		testAudit: testAudit{CreatedBy: "system", Version: 3},
+		ID:        7,
+		Name:      "Ada",
+		Password:  "hunter2",
+		Address:   &testAddress{Street: "Main Street 1", City: "London"},
+		Tags:      []string{"admin", "ops"},
+		Labels:    map[string]string{"role": "admin"},
+		Scores:    map[string]int{"math": 90, "art": 75},
+		Orders:    []testOrder{{Total: 12.5, Paid: true}, {Total: 7.5}},
+		Born:      time.Date(1815, 12, 10, 0, 0, 0, 0, time.UTC),
+		Extra:     map[string]any{"level": 2},
+		secret:    "s3cr3t",
+	}
+
+	ctx := SetVariables(context.TODO(), map[string]any{
+		"user":  user,
+		"value": *user,
+	})
+
+	inputs := map[string]string{
+		`user.id + 1`:                           "int 8",
+		`user.ID`:                               "int64 7",
+		`user.name`:                             "string Ada",
+		`user.Name == value.name`:               "bool true",
+		`user.address.street`:                   "string Main Street 1",
+		`user.address.city`:                     "string London",
+		`user.Address.City`:                     "string London",
+		`user.manager == null`:                  "bool true",
+		`user.manager?.name`:                    "<nil> <nil>",
+		`user.manager?.name ?? "none"`:          "string none",
+		`user.tags.0`:                           "string admin",
+		`user.tags[1]`:                          "string ops",
+		`"ops" in user.tags`:                    "bool true",
+		`len(user.tags)`:                        "int 2",
+		`user.labels.role`:                      "string admin",
+		`user.scores.math + user.scores.art`:    "int 165",
+		`user["name"]`:                          "string Ada",
+		`user.orders.0.total`:                   "float32 12.5",
+		`user.orders.1.total + 1`:               "float64 8.5",
+		`sum(map(user.orders, o => o.total))`:   "float64 20",
+		`len(filter(user.orders, o => o.paid))`: "int 1",
+		`user.created_by`:                       "string system",
+		`user.version`:                          "int 3",
+		`user.CreatedBy`:                        "string system",
+		`user.fullName`:                         "string Ada (London)",
+		`value.FullName`:                        "string Ada (London)",
+		`user.isAdmin`:                          "bool true",
+		`user.isAdmin && user.version > 2`:      "bool true",
+		`user.born.Year`:                        "int 1815",
+		`user.extra.level`:                      "int 2",
+		`user.address?.city`:                    "string London",
+	}
+
+	for input, expected := range inputs {
+		program, err := Compile(input)
+		if err != nil {
+			t.Errorf("%s: %v", input, err)
+			continue
+		}
+
+		for _, run := range []func() (any, error){
+			func() (any, error) { return program.Run(ctx, nil) },
+			func() (any, error) { return program.Tree().Evaluate(ctx) },
+		} {
+			out, err := run()
+			if err != nil {
+				t.Errorf("%s: %v", input, err)
+				continue
+			}
+
+			if got := fmt.Sprintf("%T %v", out, out); got != expected {
+				t.Errorf("%s: expected %s, got %s", input, expected, got)
+			}
+		}
+	}
+}
+
+func TestStructVariablesUndefined(t *testing.T) {
+	ctx := SetVariables(context.TODO(), map[string]any{
+		"user":  &testUser{Name: "Ada"},
+		"value": testUser{Name: "Ada"},
+		"nil":   (*testUser)(nil),
+	})
+
+	inputs := map[string]string{
+		`user.password`:     "not defined",
+		`user.Password`:     "not defined",
+		`user.secret`:       "not defined",
+		`user.missing`:      "not defined",
+		`user.greet`:        "not defined",
+		`user.close`:        "not defined",
+		`user.Close`:        "not defined",
+		`value.isAdmin`:     "not defined",
+		`user.manager.name`: "not defined",
+		`user.tags.0`:       "not defined",
+		`user.labels.role`:  "not defined",
+		`nil.name`:          "not defined",
+		`user["missing"]`:   `field "missing" not found`,
+		`user[0]`:           "field name must be a string",
+	}
+
+	for input, expected := range inputs {
+		_, err := Evaluate(ctx, input)
+		if err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("%s: expected error containing %q, got %v", input, expected, err)
+		}
+	}
+}
+
+func TestStructVariablesPanic(t *testing.T) {
+	ctx := SetVariables(context.TODO(), map[string]any{"g": testGauge{}})
+
+	inputs := []string{
+		`g.boom`,
+		`g?.boom`,
+		`g["boom"]`,
+		`1 + len(g.boom)`,
+		`map([g], x => x.boom)`,
+	}
+
+	for _, input := range inputs {
+		program := MustCompile(input)
+
+		for _, run := range []func() (any, error){
+			func() (any, error) { return program.Run(ctx, nil) },
+			func() (any, error) { return program.Tree().Evaluate(ctx) },
+		} {
+			_, err := run()
+			if err == nil || !strings.Contains(err.Error(), "Boom method panicked: boom") {
+				t.Errorf("%s: expected the panic of the getter, got %v", input, err)
+			}
+		}
+	}
+}
+
+func TestFieldCache(t *testing.T) {
+	user := &testUser{Name: "Ada", Address: &testAddress{City: "London"}}
+
+	for i := 0; i < 2; i++ {
+		value, ok := fieldValue(user, "name")
+		if !ok || value != "Ada" {
+			t.Errorf("expected Ada, got %v", value)
+		}
+	}
+
+	cached := fieldsOf(reflect.TypeOf(user))
+	if cached != fieldsOf(reflect.TypeOf(user)) {
+		t.Errorf("expected the fields of a type to be cached")
+	}
+
+	for _, name := range []string{"id", "ID", "name", "address", "created_by", "CreatedBy", "Version"} {
+		if _, ok := cached.fields[name]; !ok {
+			t.Errorf("expected field %s", name)
+		}
+	}
+
+	for _, name := range []string{"password", "Password", "secret"} {
+		if _, ok := cached.fields[name]; ok {
+			t.Errorf("unexpected field %s", name)
+		}
+	}
+
+	for _, name := range []string{"FullName", "IsAdmin"} {
+		if _, ok := cached.methods[name]; !ok {
+			t.Errorf("expected method %s", name)
+		}
+	}
+
+	if _, ok := cached.methods["Greet"]; ok {
+		t.Errorf("methods with arguments are not getters")
+	}
+}
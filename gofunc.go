@@ -0,0 +1,299 @@
+package expronaut
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"reflect"
+	"time"
+)
+
+var (
+	contextType  = reflect.TypeOf((*context.Context)(nil)).Elem()
+	errorType    = reflect.TypeOf((*error)(nil)).Elem()
+	bigIntType   = reflect.TypeOf((*big.Int)(nil))
+	decimalType  = reflect.TypeOf(Decimal{})
+	timeType     = reflect.TypeOf(time.Time{})
+	durationType = reflect.TypeOf(time.Duration(0))
+	lambdaType   = reflect.TypeOf((*Lambda)(nil))
+)
+
+// RegisterGoFunc adds an ordinary Go function to the default engine, see
+// Engine.RegisterGoFunc.
+func RegisterGoFunc(name string, fn any) error {
+	return defaultEngine.RegisterGoFunc(name, fn)
+}
+
+// RegisterGoFunc adds an ordinary Go function, such as
+// func(string, int) (bool, error), to the engine. Its signature is derived
+// from the parameter and result types, and the arguments are converted to
+// the parameter types:
+//
+//   - integer parameters accept ints, an argument that does not fit is an
+//     ErrIntegerOverflow
+//   - float parameters accept ints and floats, decimals and big integers are
+//     converted to the nearest float
+//   - *big.Int and Decimal parameters accept ints, and floats for Decimal
+//   - slice and map parameters with string keys accept arrays and maps whose
+//     elements can be converted
+//   - null is passed as the zero value of pointer, interface, slice and map
+//     parameters
+//
+// Any other argument must be assignable to its parameter. A first parameter
+// of type context.Context receives the context of the evaluation and is not
+// an argument of the function in expressions. The function may return a
+// value, an error, or a value and an error. A panic in the function is
+// returned as an error.
+func (e *Engine) RegisterGoFunc(name string, fn any) error {
+	signature, function, err := goFunc(name, fn)
+	if err != nil {
+		return fmt.Errorf("expronaut: RegisterGoFunc(%q): %w", name, err)
+	}
+
+	e.DefineFunction(name, signature, function)
+
+	return nil
+}
+
+// goFunc derives the signature of a Go function and returns a function that
+// converts its arguments and calls it.
+func goFunc(name string, fn any) (Signature, bifFunc, error) {
+	fv := reflect.ValueOf(fn)
+	if fv.Kind() != reflect.Func || fv.IsNil() {
+		return Signature{}, nil, fmt.Errorf("%T is not a function", fn)
+	}
+
+	ft := fv.Type()
+
+	var signature Signature
+
+	first := 0
+	if ft.NumIn() > 0 && ft.In(0) == contextType {
+		first = 1
+	}
+
+	params := make([]reflect.Type, 0, ft.NumIn()-first)
+	for i := first; i < ft.NumIn(); i++ {
+		in := ft.In(i)
+		param := Param{Type: goType(in)}
+		if ft.IsVariadic() && i == ft.NumIn()-1 {
+			in = in.Elem()
+			param = Param{Type: goType(in), Optional: true, Variadic: true}
+		}
+
+		params = append(params, in)
+		signature.Params = append(signature.Params, param)
+	}
+
+	hasError := false
+	switch {
+	case ft.NumOut() == 0:
+	case ft.NumOut() == 1 && ft.Out(0) == errorType:
+		hasError = true
+	case ft.NumOut() == 1:
+		signature.Result = goResultType(ft.Out(0))
+	case ft.NumOut() == 2 && ft.Out(1) == errorType:
+		signature.Result = goResultType(ft.Out(0))
+		hasError = true
+	default:
+		return Signature{}, nil, errors.New("a function must return a value, an error, or a value and an error")
+	}
+
+	function := func(ctx context.Context, args ...any) (result any, err error) {
+		in := make([]reflect.Value, 0, first+len(args))
+		if first == 1 {
+			if ctx == nil {
+				ctx = context.Background()
+			}
+			in = append(in, reflect.ValueOf(&ctx).Elem())
+		}
+
+		for i, arg := range args {
+			t := params[min(i, len(params)-1)]
+
+			value, err := convertValue(arg, t)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %s expects argument %d of type %s, %w", ErrArgumentType, name, i+1, t, err)
+			}
+			in = append(in, value)
+		}
+
+		defer func() {
+			if r := recover(); r != nil {
+				result, err = nil, fmt.Errorf("%s function panicked: %v", name, r)
+			}
+		}()
+
+		out := fv.Call(in)
+
+		if hasError {
+			if errValue := out[len(out)-1]; !errValue.IsNil() {
+				return nil, errValue.Interface().(error)
+			}
+			out = out[:len(out)-1]
+		}
+
+		if len(out) == 0 {
+			return nil, nil
+		}
+
+		return fieldInterface(out[0]), nil
+	}
+
+	return signature, function, nil
+}
+
+// goType returns the type of the arguments a parameter of the Go type
+// accepts.
+func goType(t reflect.Type) Type {
+	switch t {
+	case bigIntType:
+		return TypeInt
+	case decimalType:
+		return TypeNumber
+	case timeType:
+		return TypeTime
+	case durationType:
+		return TypeDuration
+	case lambdaType:
+		return TypeFunction
+	}
+
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return TypeInt
+	case reflect.Float32, reflect.Float64:
+		return TypeNumber
+	case reflect.String:
+		return TypeString
+	case reflect.Bool:
+		return TypeBool
+	case reflect.Slice:
+		return TypeArray
+	case reflect.Map:
+		return TypeMap
+	}
+
+	return TypeAny
+}
+
+// goResultType returns the type of the values a Go function returns.
+func goResultType(t reflect.Type) Type {
+	switch {
+	case t == decimalType:
+		return TypeDecimal
+	case t.Kind() == reflect.Float32 || t.Kind() == reflect.Float64:
+		return TypeFloat
+	case t.Kind() == reflect.Array:
+		return TypeArray
+	}
+
+	return goType(t)
+}
+
+// convertValue converts an argument to the Go type of a parameter.
+func convertValue(v any, t reflect.Type) (reflect.Value, error) {
+	if v == nil {
+		switch t.Kind() {
+		case reflect.Interface, reflect.Pointer, reflect.Slice, reflect.Map, reflect.Func:
+			return reflect.Zero(t), nil
+		}
+		return reflect.Value{}, errors.New("got null")
+	}
+
+	if n, err := normalizeNumber(v); err == nil {
+		v = n
+	}
+
+	rv := reflect.ValueOf(v)
+	if rv.Type().AssignableTo(t) {
+		return rv, nil
+	}
+
+	switch t {
+	case bigIntType:
+		if n, ok := toBigInt(v); ok {
+			return reflect.ValueOf(n), nil
+		}
+	case decimalType:
+		if d, ok := toDecimal(v); ok {
+			return reflect.ValueOf(d), nil
+		}
+	}
+
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if n, ok := v.(*big.Int); ok {
+			return reflect.Value{}, fmt.Errorf("%w: %s does not fit in %s", ErrIntegerOverflow, n, t)
+		}
+		if n, ok := v.(int); ok {
+			if reflect.Zero(t).OverflowInt(int64(n)) {
+				return reflect.Value{}, fmt.Errorf("%w: %d does not fit in %s", ErrIntegerOverflow, n, t)
+			}
+			return reflect.ValueOf(n).Convert(t), nil
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if n, ok := v.(*big.Int); ok && n.IsUint64() && !reflect.Zero(t).OverflowUint(n.Uint64()) {
+			return reflect.ValueOf(n.Uint64()).Convert(t), nil
+		}
+		if n, ok := v.(int); ok {
+			if n < 0 || reflect.Zero(t).OverflowUint(uint64(n)) {
+				return reflect.Value{}, fmt.Errorf("%w: %d does not fit in %s", ErrIntegerOverflow, n, t)
+			}
+			return reflect.ValueOf(n).Convert(t), nil
+		}
+	case reflect.Float32, reflect.Float64:
+		var f float64
+		switch n := v.(type) {
+		case int:
+			f = float64(n)
+		case float64:
+			f = n
+		case Decimal:
+			f = n.Float64()
+		case *big.Int:
+			f = bigIntFloat(n)
+		default:
+			return reflect.Value{}, fmt.Errorf("got %s", typeName(v))
+		}
+		return reflect.ValueOf(f).Convert(t), nil
+	case reflect.String, reflect.Bool:
+		if rv.Kind() == t.Kind() {
+			return rv.Convert(t), nil
+		}
+	case reflect.Slice:
+		elements, ok := arrayElements(v)
+		if !ok {
+			break
+		}
+
+		slice := reflect.MakeSlice(t, len(elements), len(elements))
+		for i, element := range elements {
+			value, err := convertValue(element, t.Elem())
+			if err != nil {
+				return reflect.Value{}, fmt.Errorf("element %d: %w", i, err)
+			}
+			slice.Index(i).Set(value)
+		}
+		return slice, nil
+	case reflect.Map:
+		if rv.Kind() != reflect.Map || rv.Type().Key().Kind() != reflect.String || t.Key().Kind() != reflect.String {
+			break
+		}
+
+		m := reflect.MakeMapWithSize(t, rv.Len())
+		iter := rv.MapRange()
+		for iter.Next() {
+			value, err := convertValue(iter.Value().Interface(), t.Elem())
+			if err != nil {
+				return reflect.Value{}, fmt.Errorf("key %s: %w", iter.Key(), err)
+			}
+			m.SetMapIndex(iter.Key().Convert(t.Key()), value)
+		}
+		return m, nil
+	}
+
+	return reflect.Value{}, fmt.Errorf("got %s", typeName(v))
+}
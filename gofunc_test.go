@@ -0,0 +1,232 @@
+package expronaut
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testStatus string
+
+func TestRegisterGoFunc(t *testing.T) {
+	type userKey struct{}
+
+	engine := NewEngine()
+
+	funcs := map[string]any{
+		"repeat": strings.Repeat,
+		"hasPrefix": func(s, prefix string) bool {
+			return strings.HasPrefix(s, prefix)
+		},
+		"half": func(x float64) float64 {
+			return x / 2
+		},
+		"small": func(n int8) int8 {
+			return n
+		},
+		"port": func(n uint16) (uint16, error) {
+			if n == 0 {
+				return 0, errors.New("port must not be zero")
+			}
+			return n, nil
+		},
+		"sumAll": func(values ...int64) int64 {
+			var total int64
+			for _, v := range values {
+				total += v
+			}
+			return total
+		},
+		"join": func(sep string, parts []string) string {
+			return strings.Join(parts, sep)
+		},
+		"weights": func(m map[string]float64) float64 {
+			var total float64
+			for _, v := range m {
+				total += v
+			}
+			return total
+		},
+		"user": func(ctx context.Context) string {
+			name, _ := ctx.Value(userKey{}).(string)
+			return name
+		},
+		"greet": func(ctx context.Context, greeting string) (string, error) {
+			name, _ := ctx.Value(userKey{}).(string)
+			return greeting + " " + name, nil
+		},
+		"status": func(s testStatus) bool {
+			return s == "active"
+		},
+		"later": func(t time.Time, d time.Duration) time.Time {
+			return t.Add(d)
+		},
+		"exact": func(d Decimal) string {
+			return d.String()
+		},
+		"square": func(n *big.Int) *big.Int {
+			return new(big.Int).Mul(n, n)
+		},
+		"isNull": func(v *testUser) bool {
+			return v == nil
+		},
+		"kind": func(v any) string {
+			return fmt.Sprintf("%T", v)
+		},
+		"check": func(ok bool) error {
+			if !ok {
+				return errors.New("check failed")
+			}
+			return nil
+		},
+		"noop": func() {},
+		"boom": func() int {
+			panic("boom")
+		},
+	}
+
+	for name, fn := range funcs {
+		if err := engine.RegisterGoFunc(name, fn); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	ctx := context.WithValue(context.TODO(), userKey{}, "Ada")
+	ctx = SetVariables(ctx, map[string]any{
+		"name":    "Ada",
+		"count":   int64(3),
+		"parts":   []any{"a", "b"},
+		"scores":  map[string]any{"a": 1, "b": 2.5},
+		"start":   start,
+		"ratio":   float32(0.5),
+		"missing": nil,
+	})
+
+	inputs := map[string]string{
+		`repeat("ab", 3)`:                    "string ababab",
+		`repeat(name, count)`:                "string AdaAdaAda",
+		`hasPrefix(name, "A")`:               "bool true",
+		`half(3)`:                            "float64 1.5",
+		`half(ratio)`:                        "float64 0.25",
+		`half(1.5) * 2`:                      "float64 1.5",
+		`small(100)`:                         "int8 100",
+		`small(100) + 1`:                     "int 101",
+		`port(8080)`:                         "uint16 8080",
+		`sumAll()`:                           "int64 0",
+		`sumAll(1, 2, count)`:                "int64 6",
+		`join("-", parts)`:                   "string a-b",
+		`join(", ", ["x", "y", "z"])`:        "string x, y, z",
+		`join("", string[])`:                 "string ",
+		`weights(scores)`:                    "float64 3.5",
+		`weights({"a": 1, "b": 2})`:          "float64 3",
+		`user()`:                             "string Ada",
+		`greet("Hello")`:                     "string Hello Ada",
+		`status("active")`:                   "bool true",
+		`later(start, 1d)`:                   "time.Time 2024-01-02 00:00:00 +0000 UTC",
+		`exact(1.10)`:                        "string 1.1",
+		`exact(decimal("1.10"))`:             "string 1.10",
+		`square(3)`:                          "*big.Int 9",
+		`square(bigint("10000000000"))`:      "*big.Int 100000000000000000000",
+		`isNull(null)`:                       "bool true",
+		`kind(count)`:                        "string int",
+		`kind(missing)`:                      "string <nil>",
+		`check(true)`:                        "<nil> <nil>",
+		`noop()`:                             "<nil> <nil>",
+		`len(map(parts, p => repeat(p, 2)))`: "int 2",
+	}
+
+	for input, expected := range inputs {
+		program, err := engine.Compile(input)
+		if err != nil {
+			t.Errorf("%s: %v", input, err)
+			continue
+		}
+
+		for _, run := range []func() (any, error){
+			func() (any, error) { return program.Run(ctx, nil) },
+			func() (any, error) { return program.Tree().Evaluate(withEngine(ctx, engine)) },
+		} {
+			out, err := run()
+			if err != nil {
+				t.Errorf("%s: %v", input, err)
+				continue
+			}
+
+			if got := fmt.Sprintf("%T %v", out, out); got != expected {
+				t.Errorf("%s: expected %s, got %s", input, expected, got)
+			}
+		}
+	}
+
+	errorInputs := map[string]string{
+		`repeat(1, 2)`:        "repeat expects argument 1 of type string, got int",
+		`repeat("a")`:         "repeat expects 2 arguments, got 1",
+		`half("a")`:           "half expects argument 1 of type number, got string",
+		`small(200)`:          "integer overflow: 200 does not fit in int8",
+		`port(-1)`:            "integer overflow: -1 does not fit in uint16",
+		`port(0)`:             "port must not be zero",
+		`sumAll(1, 2.5)`:      "sumAll expects argument 2 of type int, got float",
+		`join("-", [1, 2])`:   "join expects argument 2 of type []string, element 0: got int",
+		`weights({"a": "x"})`: "weights expects argument 1 of type map[string]float64, key a: got string",
+		`status(1)`:           "status expects argument 1 of type string, got int",
+		`later(start, 5)`:     "later expects argument 2 of type duration, got int",
+		`user(1)`:             "user expects no arguments, got 1",
+		`repeat(name, bigint("99999999999999999999"))`: "does not fit in int",
+		`check(false)`: "check failed",
+		`boom()`:       "boom function panicked: boom",
+	}
+
+	for input, expected := range errorInputs {
+		_, err := engine.Evaluate(ctx, input)
+		if err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("%s: expected error containing %q, got %v", input, expected, err)
+		}
+	}
+
+	if _, err := engine.Evaluate(ctx, `small(200)`); !errors.Is(err, ErrIntegerOverflow) || !errors.Is(err, ErrArgumentType) {
+		t.Errorf("expected ErrIntegerOverflow and ErrArgumentType, got %v", err)
+	}
+
+	signatures := map[string]string{
+		"repeat": "func(string, int) string",
+		"greet":  "func(string) string",
+		"sumAll": "func(...int) int",
+		"half":   "func(number) float",
+		"check":  "func(bool) any",
+		"later":  "func(time, duration) time",
+	}
+
+	for name, expected := range signatures {
+		signature, ok := engine.FunctionSignature(name)
+		if !ok {
+			t.Errorf("%s: missing signature", name)
+			continue
+		}
+		if got := signature.String(); got != expected {
+			t.Errorf("%s: expected %s, got %s", name, expected, got)
+		}
+	}
+}
+
+func TestRegisterGoFuncInvalid(t *testing.T) {
+	inputs := map[string]any{
+		"nil":     nil,
+		"string":  "len",
+		"results": func() (int, int) { return 0, 0 },
+		"error":   func() (error, int) { return nil, 0 },
+		"three":   func() (int, int, error) { return 0, 0, nil },
+		"nilfunc": (func())(nil),
+	}
+
+	for name, fn := range inputs {
+		if err := NewEngine().RegisterGoFunc(name, fn); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
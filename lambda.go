@@ -0,0 +1,131 @@
+package expronaut
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// scopeKey is the context key under which the parameters of the lambdas being
+// called are stored.
+type scopeKey struct{}
+
+// scope binds the parameters of a lambda call. Scopes are chained so that a
+// nested lambda can see the parameters of the lambdas it is defined in.
+type scope struct {
+	names  []string
+	values []any
+	parent *scope
+}
+
+// lookup returns the value bound to the name in this scope or its parents.
+func (s *scope) lookup(name string) (any, bool) {
+	for ; s != nil; s = s.parent {
+		for i, n := range s.names {
+			if n == name {
+				return s.values[i], true
+			}
+		}
+	}
+
+	return nil, false
+}
+
+// Lambda is the value of a lambda expression such as (x, i) => x * i. It is a
+// closure: the body sees the variables and lambda parameters that were in
+// scope where the lambda was evaluated.
+type Lambda struct {
+	params []string
+	body   ASTNode
+	code   *bytecode // nil when the body is evaluated by the tree walker
+	ctx    context.Context
+}
+
+// Params returns the names of the parameters of the lambda.
+func (l *Lambda) Params() []string {
+	return l.params
+}
+
+// Call evaluates the body of the lambda with the arguments bound to its
+// parameters. Missing arguments are null and extra arguments are ignored, so
+// a lambda may leave out the parameters it does not need.
+func (l *Lambda) Call(args ...any) (any, error) {
+	values := make([]any, len(l.params))
+	copy(values, args)
+
+	parent, _ := l.ctx.Value(scopeKey{}).(*scope)
+	ctx := context.WithValue(l.ctx, scopeKey{}, &scope{names: l.params, values: values, parent: parent})
+
+	if l.code != nil {
+		return l.code.run(ctx)
+	}
+
+	return l.body.Evaluate(ctx)
+}
+
+func (l *Lambda) String() string {
+	return fmt.Sprintf("(%s) => %s", strings.Join(l.params, ", "), l.body.String())
+}
+
+// resolveVariable resolves a dotted variable name, split into its parts, from
+// the lambda parameters in scope and then from the Resolver stored in the
+// context.
+func resolveVariable(ctx context.Context, parts []string) (any, bool) {
+	if s, ok := ctx.Value(scopeKey{}).(*scope); ok {
+		if value, found := s.lookup(parts[0]); found {
+			return lookupFields(value, parts[1:])
+		}
+	}
+
+	env, ok := resolverFrom(ctx)
+	if !ok {
+		return nil, false
+	}
+
+	return env.Get(parts)
+}
+
+// callable returns a function calling the lambda, builtin function or Go
+// function passed as argument to a higher order function. Lambdas receive all
+// arguments, functions only the first arity arguments.
+func callable(ctx context.Context, arg any, arity int) (func(args ...any) (any, error), bool) {
+	switch fn := arg.(type) {
+	case *Lambda:
+		return fn.Call, true
+	case bifFunc:
+		return func(args ...any) (any, error) { return fn(ctx, args[:arity]...) }, true
+	case func(context.Context, ...any) (any, error):
+		return func(args ...any) (any, error) { return fn(ctx, args[:arity]...) }, true
+	}
+
+	return nil, false
+}
+
+// elementFunc returns the function applied to every element of an array by
+// map and filter. Lambdas receive the element and its index, functions only
+// the element. A string is the legacy form of an expression evaluated with
+// the variables returned by vars.
+func elementFunc(ctx context.Context, name string, arg any, vars func(element any, index int) map[string]any) (func(args ...any) (any, error), error) {
+	if fn, ok := callable(ctx, arg, 1); ok {
+		return fn, nil
+	}
+
+	expr, ok := arg.(string)
+	if !ok {
+		return nil, fmt.Errorf("second argument to %s must be a lambda", name)
+	}
+
+	// Compile the expression once and reuse it for every element
+	program, err := engineFrom(ctx).programs.compile(expr)
+	if err != nil {
+		return nil, fmt.Errorf("error compiling expression '%s': %v", expr, err)
+	}
+
+	return func(args ...any) (any, error) {
+		result, err := program.Run(ctx, vars(args[0], args[1].(int)))
+		if err != nil {
+			return nil, fmt.Errorf("error evaluating expression '%s': %v", expr, err)
+		}
+		return result, nil
+	}, nil
+}
@@ -0,0 +1,152 @@
+package expronaut
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestLambda(t *testing.T) {
+	ctx := SetVariables(context.TODO(), map[string]any{
+		"items":  []any{1, 2, 3, 4},
+		"factor": 10,
+		"users": []any{
+			map[string]any{"name": "Ada", "age": 36},
+			map[string]any{"name": "Linus", "age": 21},
+		},
+		"x": "outer",
+	})
+
+	inputs := map[string]string{
+		`map(items, (x) => x * 2)`:                          "[2 4 6 8]",
+		`map(items, x => x * 2)`:                            "[2 4 6 8]",
+		`map(items, (x, i) => x * i)`:                       "[0 2 6 12]",
+		`map(items, (x) => x * factor)`:                     "[10 20 30 40]",
+		`map(users, (u) => u.name)`:                         "[Ada Linus]",
+		`map(users, (u) => {"n": u.name})`:                  "[map[n:Ada] map[n:Linus]]",
+		`filter(items, (x) => x > 2)`:                       "[3 4]",
+		`filter(items, (x, i) => i % 2 == 0)`:               "[1 3]",
+		`filter(users, (u) => u.age > 30)`:                  "[map[age:36 name:Ada]]",
+		`filter(items, "x > 2")`:                            "[3 4]",
+		`filter(items, "x % 2 == 0 ? true : x")`:            "[2 4]",
+		`reduce(items, (acc, x) => acc + x, 0)`:             "10",
+		`reduce(items, (acc, x) => acc + x)`:                "10",
+		`reduce(items, (acc, x) => acc * x, 1)`:             "24",
+		`reduce(items, (acc, x, i) => acc + i, 0)`:          "6",
+		`reduce(int[], (acc, x) => acc + x, 5)`:             "5",
+		`reduce(items, "add", 0)`:                           "10",
+		`map(items, (x) => map(items, (y) => x * y))[1]`:    "[2 4 6 8]",
+		`map(items, (x) => filter(items, (y) => y > x))[2]`: "[4]",
+		`x`:                           "outer",
+		`map(items, (x) => x)[0] + 1`: "2",
+		`map(items, () => factor)`:    "[10 10 10 10]",
+		`map(items, (x) => x > 2 ? "big" : "small")`:           "[small small big big]",
+		`len(filter(int[1,2,3], "x in [2, 3]"))`:               "2",
+		`map(int[1,2,3], "_x * _i")`:                           "[0 2 6]",
+		`map(items, (item) => item ?? 0)`:                      "[1 2 3 4]",
+		`map(map(items, (x) => {"v": x}), (m) => m.v)`:         "[1 2 3 4]",
+		`map(map(items, (x) => {"v": x}), (m) => m?.w ?? m.v)`: "[1 2 3 4]",
+	}
+
+	for input, expected := range inputs {
+		program, err := Compile(input)
+		if err != nil {
+			t.Errorf("%s: %v", input, err)
+			continue
+		}
+
+		out, err := program.Run(ctx, nil)
+		if err != nil {
+			t.Errorf("%s: %v", input, err)
+			continue
+		}
+
+		if fmt.Sprint(out) != expected {
+			t.Errorf("%s: expected %v, got %v", input, expected, out)
+		}
+
+		out, err = program.Tree().Evaluate(ctx)
+		if err != nil {
+			t.Errorf("%s: tree walker: %v", input, err)
+			continue
+		}
+
+		if fmt.Sprint(out) != expected {
+			t.Errorf("%s: tree walker: expected %v, got %v", input, expected, out)
+		}
+	}
+}
+
+func TestLambdaClosure(t *testing.T) {
+	out, err := Evaluate(context.TODO(), `(x) => (y) => x + y`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	outer, ok := out.(*Lambda)
+	if !ok {
+		t.Fatalf("expected *Lambda, got %T", out)
+	}
+
+	inner, err := outer.Call(40)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := inner.(*Lambda).Call(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !equalNumber(result, 42) {
+		t.Errorf("expected 42, got %v", result)
+	}
+}
+
+func TestLambdaErrors(t *testing.T) {
+	ctx := SetVariables(context.TODO(), map[string]any{"items": []any{1, 2, 3}})
+
+	inputs := map[string]string{
+		`filter(items, (x) => x + 1)`:      "filter function must return a boolean",
+		`map(items, 5)`:                    "map expects argument 2 (fn) of type string or function, got int",
+		`reduce(items, 5)`:                 "reduce expects argument 2 (fn) of type string or function, got int",
+		`map(items, (x) => missing)`:       "variable missing not defined",
+		`reduce(items, (acc, x) => acc.y)`: "variable acc.y not defined",
+	}
+
+	for input, expected := range inputs {
+		_, err := Evaluate(ctx, input)
+		if err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("%s: expected error containing %q, got %v", input, expected, err)
+		}
+	}
+
+	parseErrors := map[string]string{
+		`(a.b) => a`:  "invalid lambda parameter",
+		`(a, a) => a`: "duplicate lambda parameter",
+	}
+
+	for input, expected := range parseErrors {
+		_, err := Compile(input)
+		if err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("%s: expected error containing %q, got %v", input, expected, err)
+		}
+	}
+}
+
+func TestLambdaString(t *testing.T) {
+	inputs := map[string]string{
+		`map(items, (x, i) => x * i)`:        "map([items (x, i) => (x MULTIPLY i)])",
+		`x => x + 1`:                         "(x) => (x PLUS 1)",
+		`reduce(xs, (acc, x) => acc + x, 0)`: "reduce([xs (acc, x) => (acc PLUS x) 0])",
+		`(a + b) * 2`:                        "((a PLUS b) MULTIPLY 2)",
+	}
+
+	for input, expected := range inputs {
+		tree := MustCompile(input).Tree()
+		if tree.String() != expected {
+			t.Errorf("%s: expected %s, got %s", input, expected, tree.String())
+		}
+	}
+}
@@ -2,6 +2,7 @@ package expronaut
 
 import (
 	"fmt"
+	"unicode/utf8"
 )
 
 type TokenType string
@@ -13,6 +14,7 @@ const (
 	TokenTypeParenRight         TokenType = "PAREN_RIGHT"
 	TokenTypeInt                TokenType = "INT"
 	TokenTypeFloat              TokenType = "FLOAT"
+	TokenTypeDuration           TokenType = "DURATION"
 	TokenTypeString             TokenType = "STRING"
 	TokenTypeVariable           TokenType = "VARIABLE"
 	TokenTypeFunction           TokenType = "FUNCTION"
@@ -38,6 +40,20 @@ const (
 	TokenTypeExponent           TokenType = "EXPONENT"
 	TokenTypeLeftShift          TokenType = "LEFT_SHIFT"
 	TokenTypeRightShift         TokenType = "RIGHT_SHIFT"
+	TokenTypeNot                TokenType = "NOT"
+	TokenTypeBitwiseNot         TokenType = "BITWISE_NOT"
+	TokenTypeQuestion           TokenType = "QUESTION"
+	TokenTypeColon              TokenType = "COLON"
+	TokenTypeNull               TokenType = "NULL"
+	TokenTypeNullCoalesce       TokenType = "NULL_COALESCE"
+	TokenTypeOptionalChain      TokenType = "OPTIONAL_CHAIN"
+	TokenTypeIn                 TokenType = "IN"
+	TokenTypeNotIn              TokenType = "NOT_IN"
+	TokenTypeMatch              TokenType = "MATCH"
+	TokenTypeNotMatch           TokenType = "NOT_MATCH"
+	TokenTypeMapStart           TokenType = "MAP_START"
+	TokenTypeArrow              TokenType = "ARROW"
+	TokenTypeMapEnd             TokenType = "MAP_END"
 )
 
 func TokenGoTemplate(tok TokenType) string {
@@ -68,31 +84,90 @@ func TokenGoTemplate(tok TokenType) string {
 		return "div"
 	case TokenTypeModulo:
 		return "mod"
+	case TokenTypeNot:
+		return "not"
+	case TokenTypeIn:
+		return "has"
+	case TokenTypeMatch:
+		return "regexMatch"
 	default:
 		return string(tok)
 	}
 }
 
+// tokenSymbols are the operators as they are written in expressions.
+var tokenSymbols = map[TokenType]string{
+	TokenTypeAnd:                "&&",
+	TokenTypeOr:                 "||",
+	TokenTypePlus:               "+",
+	TokenTypeMinus:              "-",
+	TokenTypeMultiply:           "*",
+	TokenTypeDivide:             "/",
+	TokenTypeDivideInteger:      "//",
+	TokenTypeModulo:             "%",
+	TokenTypeEqual:              "==",
+	TokenTypeNotEqual:           "!=",
+	TokenTypeLessThan:           "<",
+	TokenTypeGreaterThan:        ">",
+	TokenTypeLessThanOrEqual:    "<=",
+	TokenTypeGreaterThanOrEqual: ">=",
+	TokenTypeExponent:           "^",
+	TokenTypeLeftShift:          "<<",
+	TokenTypeRightShift:         ">>",
+	TokenTypeNot:                "!",
+	TokenTypeBitwiseNot:         "~",
+	TokenTypeNullCoalesce:       "??",
+	TokenTypeOptionalChain:      "?.",
+	TokenTypeIn:                 "in",
+	TokenTypeNotIn:              "not in",
+	TokenTypeMatch:              "=~",
+	TokenTypeNotMatch:           "!~",
+}
+
+// symbol returns the operator as it is written in expressions, the name of
+// the token type for other tokens.
+func (t TokenType) symbol() string {
+	if s, ok := tokenSymbols[t]; ok {
+		return s
+	}
+
+	return string(t)
+}
+
 type Token struct {
 	Type    TokenType // The type of token, indicating its role (e.g., operator, number, parenthesis)
 	Literal string    // The actual text that the token represents (e.g., "123", "+", "(")
+	Pos     Position  // The position of the first character of the token
+	End     Position  // The position just after the last character of the token
+}
+
+// Span returns the part of the source the token was read from.
+func (t Token) Span() Span {
+	return Span{Start: t.Pos, End: t.End}
 }
 
 type Lexer struct {
 	input        string
-	position     int  // Current position in input (points to current char)
-	readPosition int  // Current reading position in input (after current char)
-	ch           byte // Current char under examination
-	errors       []error
+	position     int         // Current position in input (points to current char)
+	readPosition int         // Current reading position in input (after current char)
+	ch           byte        // Current char under examination
+	line         int         // Line of the current char
+	lineStart    int         // Position of the first char of the current line
+	diagnostics  Diagnostics // The illegal characters and unterminated strings found
 }
 
 func NewLexer(input string) *Lexer {
-	l := &Lexer{input: input, errors: []error{}}
+	l := &Lexer{input: input, line: 1}
 	l.readChar() // Initialize the first character
 	return l
 }
 
 func (l *Lexer) readChar() {
+	if l.ch == '\n' {
+		l.line++
+		l.lineStart = l.readPosition
+	}
+
 	if l.readPosition >= len(l.input) {
 		l.ch = 0 // ASCII code for "NUL" character signifies end of input
 	} else {
@@ -102,10 +177,58 @@ func (l *Lexer) readChar() {
 	l.readPosition += 1
 }
 
+// NextToken returns the next token in the input, an EOF token at its end.
 func (l *Lexer) NextToken() Token {
-	var tok Token
 	l.skipWhitespace()
 
+	pos := l.pos()
+	tok := l.nextToken()
+	tok.Pos, tok.End = pos, l.pos()
+
+	if tok.Type == TokenTypeIllegal {
+		l.illegal(tok)
+	}
+
+	return tok
+}
+
+// illegal reports an illegal character.
+func (l *Lexer) illegal(tok Token) {
+	d := Diagnostic{
+		Severity: SeverityError,
+		Code:     CodeIllegalCharacter,
+		Message:  fmt.Sprintf("illegal character %q", tok.Literal),
+		Span:     tok.Span(),
+	}
+
+	switch tok.Literal {
+	case "=":
+		d.Suggestion = "use == to compare values"
+	case "&":
+		d.Suggestion = "use && for a logical and"
+	case "|":
+		d.Suggestion = "use || for a logical or"
+	case ".":
+		d.Suggestion = `use ["key"] to access a field of a value that is not a variable`
+	}
+
+	l.diagnostics = append(l.diagnostics, d)
+}
+
+// pos returns the position of the current char.
+func (l *Lexer) pos() Position {
+	offset := min(l.position, len(l.input))
+
+	return Position{
+		Offset: offset,
+		Line:   l.line,
+		Column: utf8.RuneCountInString(l.input[l.lineStart:offset]) + 1,
+	}
+}
+
+func (l *Lexer) nextToken() Token {
+	var tok Token
+
 	switch l.ch {
 	case '(':
 		tok = newToken(TokenTypeParenLeft, l.ch)
@@ -114,13 +237,27 @@ func (l *Lexer) NextToken() Token {
 	case '+':
 		tok = newToken(TokenTypePlus, l.ch)
 	case '-':
+		// a leading minus is parsed as a unary operator
 		tok = newToken(TokenTypeMinus, l.ch)
-
-		if isDigit(l.peekChar()) {
-			return l.readNumber(true)
+	case '~':
+		tok = newToken(TokenTypeBitwiseNot, l.ch)
+	case '?':
+		if l.peekChar() == '?' {
+			ch := l.ch
+			l.readChar()
+			literal := string(ch) + string(l.ch)
+			tok = Token{Type: TokenTypeNullCoalesce, Literal: literal}
+		} else if l.peekChar() == '.' && !isDigit(l.peek2Char()) {
+			// as in JavaScript, x ?.5 : 1 is a conditional with the operand .5
+			ch := l.ch
+			l.readChar()
+			literal := string(ch) + string(l.ch)
+			tok = Token{Type: TokenTypeOptionalChain, Literal: literal}
 		} else {
-			tok = newToken(TokenTypeMinus, l.ch)
+			tok = newToken(TokenTypeQuestion, l.ch)
 		}
+	case ':':
+		tok = newToken(TokenTypeColon, l.ch)
 	case '*':
 		if l.peekChar() == '*' {
 			ch := l.ch
@@ -149,6 +286,10 @@ func (l *Lexer) NextToken() Token {
 		tok = newToken(TokenTypeArrayStart, l.ch)
 	case ']':
 		tok = newToken(TokenTypeArrayEnd, l.ch)
+	case '{':
+		tok = newToken(TokenTypeMapStart, l.ch)
+	case '}':
+		tok = newToken(TokenTypeMapEnd, l.ch)
 	case '<':
 		if l.peekChar() == '=' {
 			ch := l.ch
@@ -183,6 +324,16 @@ func (l *Lexer) NextToken() Token {
 			l.readChar()
 			literal := string(ch) + string(l.ch)
 			tok = Token{Type: TokenTypeEqual, Literal: literal}
+		} else if l.peekChar() == '~' {
+			ch := l.ch
+			l.readChar()
+			literal := string(ch) + string(l.ch)
+			tok = Token{Type: TokenTypeMatch, Literal: literal}
+		} else if l.peekChar() == '>' {
+			ch := l.ch
+			l.readChar()
+			literal := string(ch) + string(l.ch)
+			tok = Token{Type: TokenTypeArrow, Literal: literal}
 		} else {
 			tok = newToken(TokenTypeIllegal, l.ch)
 		}
@@ -192,14 +343,17 @@ func (l *Lexer) NextToken() Token {
 			l.readChar()
 			literal := string(ch) + string(l.ch)
 			tok = Token{Type: TokenTypeNotEqual, Literal: literal}
+		} else if l.peekChar() == '~' {
+			ch := l.ch
+			l.readChar()
+			literal := string(ch) + string(l.ch)
+			tok = Token{Type: TokenTypeNotMatch, Literal: literal}
 		} else {
-			tok = newToken(TokenTypeIllegal, l.ch)
+			tok = newToken(TokenTypeNot, l.ch)
 		}
-	case '"', '\'':
+	case '"', '\'', '`':
 		tok.Literal = l.readString()
 		tok.Type = TokenTypeString
-	case '`':
-		tok.Literal = l.readUntilBacktick()
 	case '&':
 		if l.peekChar() == '&' {
 			ch := l.ch
@@ -225,6 +379,19 @@ func (l *Lexer) NextToken() Token {
 		if isLetter(l.ch) {
 			identifier, iType := l.readIdentifier()
 
+			switch identifier {
+			case "in":
+				tok.Type = TokenTypeIn
+				tok.Literal = identifier
+				return tok
+			case "not":
+				if l.readKeyword("in") {
+					tok.Type = TokenTypeNotIn
+					tok.Literal = "not in"
+					return tok
+				}
+			}
+
 			switch iType {
 			case identifierTypeFunction:
 				tok.Type = TokenTypeFunction
@@ -243,13 +410,24 @@ func (l *Lexer) NextToken() Token {
 			case identifierTypeBool:
 				tok.Type = TokenTypeBool
 				tok.Literal = identifier
+				return tok
+			case identifierTypeNull:
+				tok.Type = TokenTypeNull
+				tok.Literal = identifier
+				return tok
 			default:
 				fmt.Println("Unknown identifier type")
 			}
-		} else if isDigit(l.ch) {
-			return l.readNumber(false)
+		} else if isDigit(l.ch) || (l.ch == '.' && isDigit(l.peekChar())) {
+			return l.readNumber()
 		} else {
-			tok = newToken(TokenTypeIllegal, l.ch)
+			// read the whole character, which may take several bytes
+			start := l.position
+			_, size := utf8.DecodeRuneInString(l.input[start:])
+			for l.position < start+size-1 {
+				l.readChar()
+			}
+			tok = Token{Type: TokenTypeIllegal, Literal: l.input[start : start+size]}
 		}
 	}
 
@@ -294,16 +472,19 @@ func isLetter(ch byte) bool {
 	return ('a' <= ch && ch <= 'z') || ('A' <= ch && ch <= 'Z') || ch == '_'
 }
 
-func (l *Lexer) readNumber(allowNegative bool) Token {
+func (l *Lexer) readNumber() Token {
 	position := l.position
-	hasDecimal := false
-	hasExponent := false
 
-	if allowNegative && l.ch == '-' {
-		// Consume the negative sign
-		l.readChar()
+	if end := durationEnd(l.input, position); end > 0 {
+		for l.position < end {
+			l.readChar()
+		}
+		return Token{Type: TokenTypeDuration, Literal: l.input[position:end]}
 	}
 
+	hasDecimal := false
+	hasExponent := false
+
 	for isDigit(l.ch) || (!hasDecimal && l.ch == '.') || (!hasExponent && (l.ch == 'e' || l.ch == 'E')) || (hasExponent && (l.ch == '+' || l.ch == '-')) {
 		if l.ch == '.' {
 			hasDecimal = true
@@ -332,6 +513,7 @@ const (
 	identifierTypeFunction identifierType = "function"
 	identifierTypeArray    identifierType = "array"
 	identifierTypeBool     identifierType = "bool"
+	identifierTypeNull     identifierType = "null"
 )
 
 func (l *Lexer) readIdentifier() (string, identifierType) {
@@ -355,30 +537,59 @@ func (l *Lexer) readIdentifier() (string, identifierType) {
 		return ident, identifierTypeBool
 	}
 
+	if ident == "null" {
+		return ident, identifierTypeNull
+	}
+
 	return ident, returnType
 }
 
-// Helper function to read string literals surrounded by double quotes
-func (l *Lexer) readString() string {
-	position := l.position + 1 // Start after the initial double quote
-	for {
+// readKeyword consumes the keyword when it is the next word in the input,
+// skipping the whitespace in front of it.
+func (l *Lexer) readKeyword(keyword string) bool {
+	position := l.position
+	for position < len(l.input) && (l.input[position] == ' ' || l.input[position] == '\t' || l.input[position] == '\n' || l.input[position] == '\r') {
+		position++
+	}
+
+	end := position + len(keyword)
+	if position == l.position || end > len(l.input) || l.input[position:end] != keyword {
+		return false
+	}
+
+	if end < len(l.input) && (isLetter(l.input[end]) || isDigit(l.input[end])) {
+		return false
+	}
+
+	for l.position < end {
 		l.readChar()
-		if l.ch == '"' || l.ch == 0 {
-			break
-		}
 	}
-	return l.input[position:l.position]
+
+	return true
 }
 
-func (l *Lexer) readUntilBacktick() string {
-	position := l.position + 1 // Start after the initial backtick
+// readString reads a string literal surrounded by double quotes, single
+// quotes or backticks, reporting a string that is not terminated.
+func (l *Lexer) readString() string {
+	quote := l.ch
+	start := l.pos()
+	position := l.position + 1 // Start after the opening quote
 	for {
-		if l.peekChar() == '`' {
-			l.readChar()
+		l.readChar()
+		if l.ch == quote || l.ch == 0 {
 			break
 		}
-		l.readChar()
 	}
-	l.readChar()
-	return l.input[position:l.position]
+
+	if l.ch == 0 {
+		l.diagnostics = append(l.diagnostics, Diagnostic{
+			Severity:   SeverityError,
+			Code:       CodeUnterminatedString,
+			Message:    "unterminated string",
+			Span:       Span{Start: start, End: l.pos()},
+			Suggestion: fmt.Sprintf("add the closing %c", quote),
+		})
+	}
+
+	return l.input[position:min(l.position, len(l.input))]
 }
@@ -186,3 +186,168 @@ func TestNewLexerVariableBool(t *testing.T) {
 		i++
 	}
 }
+
+func TestNewLexerUnary(t *testing.T) {
+	input := `!a && -b != ~c`
+
+	lexer := NewLexer(input)
+
+	exp := []TokenType{
+		TokenTypeNot,
+		TokenTypeVariable,
+		TokenTypeAnd,
+		TokenTypeMinus,
+		TokenTypeVariable,
+		TokenTypeNotEqual,
+		TokenTypeBitwiseNot,
+		TokenTypeVariable,
+	}
+
+	i := 0
+	for tok := lexer.NextToken(); tok.Type != TokenTypeEOF; tok = lexer.NextToken() {
+		if tok.Type != exp[i] {
+			t.Fatalf("expected %v, got %v", exp[i], tok.Type)
+		}
+		i++
+	}
+}
+
+func TestNewLexerNull(t *testing.T) {
+	input := `a?.b ?? null ? 1 : 0.5`
+
+	lexer := NewLexer(input)
+
+	exp := []TokenType{
+		TokenTypeVariable,
+		TokenTypeOptionalChain,
+		TokenTypeVariable,
+		TokenTypeNullCoalesce,
+		TokenTypeNull,
+		TokenTypeQuestion,
+		TokenTypeInt,
+		TokenTypeColon,
+		TokenTypeFloat,
+	}
+
+	i := 0
+	for tok := lexer.NextToken(); tok.Type != TokenTypeEOF; tok = lexer.NextToken() {
+		if tok.Type != exp[i] {
+			t.Fatalf("expected %v, got %v", exp[i], tok.Type)
+		}
+		i++
+	}
+}
+
+func TestNewLexerQuestionDot(t *testing.T) {
+	input := `x ?.5 : a?.b`
+
+	lexer := NewLexer(input)
+
+	exp := []Token{
+		{Type: TokenTypeVariable, Literal: "x"},
+		{Type: TokenTypeQuestion, Literal: "?"},
+		{Type: TokenTypeFloat, Literal: ".5"},
+		{Type: TokenTypeColon, Literal: ":"},
+		{Type: TokenTypeVariable, Literal: "a"},
+		{Type: TokenTypeOptionalChain, Literal: "?."},
+		{Type: TokenTypeVariable, Literal: "b"},
+	}
+
+	i := 0
+	for tok := lexer.NextToken(); tok.Type != TokenTypeEOF; tok = lexer.NextToken() {
+		if tok.Type != exp[i].Type || tok.Literal != exp[i].Literal {
+			t.Fatalf("expected %v(%s), got %v(%s)", exp[i].Type, exp[i].Literal, tok.Type, tok.Literal)
+		}
+		i++
+	}
+}
+
+func TestNewLexerIn(t *testing.T) {
+	input := `a in b && c not in d && nothing not  in e && inner != note`
+
+	lexer := NewLexer(input)
+
+	exp := []TokenType{
+		TokenTypeVariable,
+		TokenTypeIn,
+		TokenTypeVariable,
+		TokenTypeAnd,
+		TokenTypeVariable,
+		TokenTypeNotIn,
+		TokenTypeVariable,
+		TokenTypeAnd,
+		TokenTypeVariable,
+		TokenTypeNotIn,
+		TokenTypeVariable,
+		TokenTypeAnd,
+		TokenTypeVariable,
+		TokenTypeNotEqual,
+		TokenTypeVariable,
+	}
+
+	i := 0
+	for tok := lexer.NextToken(); tok.Type != TokenTypeEOF; tok = lexer.NextToken() {
+		if tok.Type != exp[i] {
+			t.Fatalf("expected %v, got %v", exp[i], tok.Type)
+		}
+		i++
+	}
+}
+
+func TestNewLexerPositions(t *testing.T) {
+	input := "name == \"é\"\n  && max(1, 2.5) > 2"
+	lexer := NewLexer(input)
+
+	exp := []struct {
+		literal    string
+		start, end string
+		offset     int
+	}{
+		{"name", "1:1", "1:5", 0},
+		{"==", "1:6", "1:8", 5},
+		{"é", "1:9", "1:12", 8},
+		{"&&", "2:3", "2:5", 15},
+		{"max", "2:6", "2:9", 18},
+		{"(", "2:9", "2:10", 21},
+		{"1", "2:10", "2:11", 22},
+		{",", "2:11", "2:12", 23},
+		{"2.5", "2:13", "2:16", 25},
+		{")", "2:16", "2:17", 28},
+		{">", "2:18", "2:19", 30},
+		{"2", "2:20", "2:21", 32},
+		{"", "2:21", "2:21", 33},
+	}
+
+	for _, e := range exp {
+		tok := lexer.NextToken()
+		if tok.Literal != e.literal || tok.Pos.String() != e.start || tok.End.String() != e.end || tok.Pos.Offset != e.offset {
+			t.Errorf("expected %q at %s-%s (offset %d), got %q at %s (offset %d)", e.literal, e.start, e.end, e.offset, tok.Literal, tok.Span(), tok.Pos.Offset)
+		}
+	}
+}
+
+func TestNewLexerQuotes(t *testing.T) {
+	inputs := map[string]string{
+		`"say 'hi'"`:   `say 'hi'`,
+		`'say "hi"'`:   `say "hi"`,
+		"`say \"hi\"`": `say "hi"`,
+		`""`:           ``,
+	}
+
+	for input, expected := range inputs {
+		lexer := NewLexer(input + " + 1")
+
+		tok := lexer.NextToken()
+		if tok.Type != TokenTypeString || tok.Literal != expected {
+			t.Errorf("%s: expected string %q, got %s %q", input, expected, tok.Type, tok.Literal)
+		}
+
+		if next := lexer.NextToken(); next.Type != TokenTypePlus {
+			t.Errorf("%s: expected PLUS after the string, got %s", input, next.Type)
+		}
+
+		if len(lexer.diagnostics) > 0 {
+			t.Errorf("%s: unexpected diagnostics %s", input, lexer.diagnostics)
+		}
+	}
+}
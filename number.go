@@ -0,0 +1,298 @@
+package expronaut
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// ErrIntegerOverflow is returned when an integer operation or conversion does
+// not fit in an int.
+var ErrIntegerOverflow = errors.New("integer overflow")
+
+// normalizeNumber converts the numeric types that may come from variables,
+// such as int64 from protobuf, uint32 from a database driver or json.Number
+// from a JSON decoder, to one of the two numeric types the operators and
+// builtins work with:
+//
+//   - all signed and unsigned integer types become int, an unsigned value that
+//     does not fit is an ErrIntegerOverflow
+//   - float32 becomes the float64 closest to its shortest decimal form, so
+//     float32(0.1) is 0.1 and not 0.10000000149011612
+//   - json.Number becomes an int when it is written as an integer and a
+//     float64 otherwise
+//   - a *big.Int becomes an int when it fits
+//
+// Any other value is returned as is.
+func normalizeNumber(v any) (any, error) {
+	switch n := v.(type) {
+	case int, float64:
+		return v, nil
+	case int8:
+		return int(n), nil
+	case int16:
+		return int(n), nil
+	case int32:
+		return int(n), nil
+	case int64:
+		if int64(int(n)) != n {
+			return nil, fmt.Errorf("%w: %d does not fit in an int", ErrIntegerOverflow, n)
+		}
+		return int(n), nil
+	case uint8:
+		return int(n), nil
+	case uint16:
+		return int(n), nil
+	case uint32:
+		if uint64(n) > math.MaxInt {
+			return nil, fmt.Errorf("%w: %d does not fit in an int", ErrIntegerOverflow, n)
+		}
+		return int(n), nil
+	case uint:
+		if n > math.MaxInt {
+			return nil, fmt.Errorf("%w: %d does not fit in an int", ErrIntegerOverflow, n)
+		}
+		return int(n), nil
+	case uint64:
+		if n > math.MaxInt {
+			return nil, fmt.Errorf("%w: %d does not fit in an int", ErrIntegerOverflow, n)
+		}
+		return int(n), nil
+	case float32:
+		f, _ := strconv.ParseFloat(strconv.FormatFloat(float64(n), 'g', -1, 32), 64)
+		return f, nil
+	case json.Number:
+		return normalizeJSONNumber(n)
+	case *big.Int:
+		if n != nil {
+			return demoteBigInt(n), nil
+		}
+	}
+
+	return v, nil
+}
+
+// normalizeJSONNumber converts a json.Number to an int or a float64.
+func normalizeJSONNumber(n json.Number) (any, error) {
+	if !strings.ContainsAny(string(n), ".eE") {
+		i, err := strconv.ParseInt(string(n), 10, 0)
+		if err == nil {
+			return int(i), nil
+		}
+
+		if errors.Is(err, strconv.ErrRange) {
+			return nil, fmt.Errorf("%w: %s does not fit in an int", ErrIntegerOverflow, n)
+		}
+	}
+
+	f, err := n.Float64()
+	if err != nil {
+		return nil, fmt.Errorf("invalid number %q", string(n))
+	}
+
+	return f, nil
+}
+
+// normalizeArgs normalizes the numbers in args in place.
+func normalizeArgs(ctx context.Context, args []any) error {
+	for i, arg := range args {
+		n, err := normalizeOperand(ctx, arg)
+		if err != nil {
+			return err
+		}
+		args[i] = n
+	}
+
+	return nil
+}
+
+// arithmetic applies an arithmetic operator to two numbers. The operands are
+// normalized first, then:
+//
+//   - int op int is an int, an overflow is an ErrIntegerOverflow
+//   - int op float and float op float are a float64
+//   - / on two ints is an integer division, // and % truncate floats to ints
+//   - ^ results in a float64, except for ints in big integer mode
+//
+// Integer division and modulo by zero are an error. When one of the operands
+// is a Decimal, or a float in decimal mode, the operation is done with
+// decimals instead. Times and durations are added and subtracted as described
+// by durationArithmetic. When one of the operands is a *big.Int, or in big integer
+// mode, integer operations that overflow are done with big integers.
+func arithmetic(ctx context.Context, op TokenType, left, right any) (any, error) {
+	l, err := normalizeOperand(ctx, left)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := normalizeOperand(ctx, right)
+	if err != nil {
+		return nil, err
+	}
+
+	if result, ok, err := durationArithmetic(op, l, r); ok {
+		return result, err
+	}
+
+	if usesDecimal(ctx, l, r) {
+		return decimalArithmetic(op, l, r)
+	}
+
+	if a, b, ok := bigOperands(l, r); ok {
+		return bigIntArithmetic(op, a, b)
+	}
+
+	switch a := l.(type) {
+	case int:
+		switch b := r.(type) {
+		case int:
+			result, err := intArithmetic(op, a, b)
+			if bigIntMode(ctx) && (errors.Is(err, ErrIntegerOverflow) || (op == TokenTypeExponent && b >= 0)) {
+				return bigIntArithmetic(op, big.NewInt(int64(a)), big.NewInt(int64(b)))
+			}
+			return result, err
+		case float64:
+			return floatArithmetic(op, float64(a), b)
+		}
+	case float64:
+		switch b := r.(type) {
+		case int:
+			return floatArithmetic(op, a, float64(b))
+		case float64:
+			return floatArithmetic(op, a, b)
+		case *big.Int:
+			return floatArithmetic(op, a, bigIntFloat(b))
+		}
+	case *big.Int:
+		if b, ok := r.(float64); ok {
+			return floatArithmetic(op, bigIntFloat(a), b)
+		}
+	}
+
+	return nil, fmt.Errorf("type mismatch or operation not applicable (%T(%v), %s, %T(%v))", left, left, op, right, right)
+}
+
+// intArithmetic applies an arithmetic operator to two ints.
+func intArithmetic(op TokenType, a, b int) (any, error) {
+	var (
+		result int
+		ok     bool
+	)
+
+	switch op {
+	case TokenTypePlus:
+		result, ok = addInt(a, b)
+	case TokenTypeMinus:
+		result, ok = subInt(a, b)
+	case TokenTypeMultiply:
+		result, ok = mulInt(a, b)
+	case TokenTypeDivide, TokenTypeDivideInteger:
+		if b == 0 {
+			return nil, fmt.Errorf("integer division by zero")
+		}
+		result, ok = a/b, !(a == math.MinInt && b == -1)
+	case TokenTypeModulo:
+		if b == 0 {
+			return nil, fmt.Errorf("integer modulo by zero")
+		}
+		result, ok = a%b, true
+	case TokenTypeExponent:
+		return math.Pow(float64(a), float64(b)), nil
+	default:
+		return nil, fmt.Errorf("unknown or unsupported operator: %v", op)
+	}
+
+	if !ok {
+		return nil, fmt.Errorf("%w: %d %s %d", ErrIntegerOverflow, a, op, b)
+	}
+
+	return result, nil
+}
+
+// floatArithmetic applies an arithmetic operator to two floats.
+func floatArithmetic(op TokenType, a, b float64) (any, error) {
+	switch op {
+	case TokenTypePlus:
+		return a + b, nil
+	case TokenTypeMinus:
+		return a - b, nil
+	case TokenTypeMultiply:
+		return a * b, nil
+	case TokenTypeDivide:
+		return a / b, nil
+	case TokenTypeDivideInteger, TokenTypeModulo:
+		x, err := floatToInt(a)
+		if err != nil {
+			return nil, err
+		}
+
+		y, err := floatToInt(b)
+		if err != nil {
+			return nil, err
+		}
+
+		return intArithmetic(op, x, y)
+	case TokenTypeExponent:
+		return math.Pow(a, b), nil
+	}
+
+	return nil, fmt.Errorf("unknown or unsupported operator: %v", op)
+}
+
+// addInt returns a + b and whether it did not overflow.
+func addInt(a, b int) (int, bool) {
+	c := a + b
+	return c, (c > a) == (b > 0)
+}
+
+// subInt returns a - b and whether it did not overflow.
+func subInt(a, b int) (int, bool) {
+	c := a - b
+	return c, (c < a) == (b > 0)
+}
+
+// mulInt returns a * b and whether it did not overflow.
+func mulInt(a, b int) (int, bool) {
+	if a == 0 || b == 0 {
+		return 0, true
+	}
+
+	c := a * b
+	if (a == -1 && b == math.MinInt) || (b == -1 && a == math.MinInt) {
+		return c, false
+	}
+
+	return c, c/b == a
+}
+
+// shiftInt returns a shifted left (op <<) or right (op >>) by n bits.
+func shiftInt(op TokenType, a, n int) (int, error) {
+	if n < 0 {
+		return 0, fmt.Errorf("negative shift count %d", n)
+	}
+
+	if op == TokenTypeRightShift {
+		return a >> n, nil
+	}
+
+	c := a << n
+	if n >= strconv.IntSize || c>>n != a {
+		return 0, fmt.Errorf("%w: %d << %d", ErrIntegerOverflow, a, n)
+	}
+
+	return c, nil
+}
+
+// floatToInt truncates the float to an int, reporting floats that do not fit.
+func floatToInt(f float64) (int, error) {
+	if math.IsNaN(f) || f < math.MinInt || f >= math.MaxInt {
+		return 0, fmt.Errorf("%w: %v does not fit in an int", ErrIntegerOverflow, f)
+	}
+
+	return int(f), nil
+}
@@ -0,0 +1,283 @@
+package expronaut
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeNumber(t *testing.T) {
+	inputs := []struct {
+		in       any
+		expected any
+	}{
+		{int8(-8), -8},
+		{int16(16), 16},
+		{int32(-32), -32},
+		{int64(64), 64},
+		{uint8(8), 8},
+		{uint16(16), 16},
+		{uint32(32), 32},
+		{uint(7), 7},
+		{uint64(64), 64},
+		{float32(0.1), 0.1},
+		{float32(2.5), 2.5},
+		{json.Number("42"), 42},
+		{json.Number("-7"), -7},
+		{json.Number("1.25"), 1.25},
+		{json.Number("1e3"), 1000.0},
+		{"42", "42"},
+		{true, true},
+		{nil, nil},
+	}
+
+	for _, input := range inputs {
+		out, err := normalizeNumber(input.in)
+		if err != nil {
+			t.Errorf("%T(%v): %v", input.in, input.in, err)
+			continue
+		}
+
+		if out != input.expected {
+			t.Errorf("%T(%v): expected %T(%v), got %T(%v)", input.in, input.in, input.expected, input.expected, out, out)
+		}
+	}
+
+	overflows := []any{
+		uint64(math.MaxUint64),
+		uint(math.MaxInt) + 1,
+		json.Number("92233720368547758070"),
+	}
+
+	for _, input := range overflows {
+		_, err := normalizeNumber(input)
+		if !errors.Is(err, ErrIntegerOverflow) {
+			t.Errorf("%T(%v): expected ErrIntegerOverflow, got %v", input, input, err)
+		}
+	}
+
+	if _, err := normalizeNumber(json.Number("abc")); err == nil {
+		t.Errorf("expected an error for an invalid json.Number")
+	}
+}
+
+func TestNumericTower(t *testing.T) {
+	var decoded map[string]any
+	decoder := json.NewDecoder(strings.NewReader(`{"count": 3, "price": 2.5, "big": 9007199254740993}`))
+	decoder.UseNumber()
+	if err := decoder.Decode(&decoded); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := SetVariables(context.TODO(), map[string]any{
+		"i64":     int64(10),
+		"i32":     int32(3),
+		"u32":     uint32(4),
+		"u":       uint(5),
+		"f32":     float32(0.5),
+		"json":    decoded,
+		"int64s":  []int64{3, 1, 2},
+		"uint8s":  []uint8{1, 2, 3},
+		"float32": []float32{0.5, 1.5},
+	})
+
+	inputs := map[string]string{
+		`i64 + 1`:                  "int 11",
+		`i64 * i32`:                "int 30",
+		`i64 - u32`:                "int 6",
+		`u / 2`:                    "int 2",
+		`u // 2`:                   "int 2",
+		`i64 % i32`:                "int 1",
+		`i64 + f32`:                "float64 10.5",
+		`f32 * 3`:                  "float64 1.5",
+		`i64 == 10`:                "bool true",
+		`i32 < u32`:                "bool true",
+		`f32 == 0.5`:               "bool true",
+		`-i64`:                     "int -10",
+		`~u32`:                     "int -5",
+		`i64 << 2`:                 "int 40",
+		`json.count * json.price`:  "float64 7.5",
+		`json.count + 1`:           "int 4",
+		`json.big + 1`:             "int 9007199254740994",
+		`json.count in int[1, 3]`:  "bool true",
+		`int[i64, i32]`:            "[]int [10 3]",
+		`float[i32, f32]`:          "[]float64 [3 0.5]",
+		`sqrt(u32)`:                "float64 2",
+		`max(i64, i32)`:            "float64 10",
+		`abs(-i32)`:                "int 3",
+		`round(f32 + 0.1)`:         "int 1",
+		`sum(int64s)`:              "float64 6",
+		`sum(uint8s, float32)`:     "float64 8",
+		`mean(int64s)`:             "float64 2",
+		`sort(int64s)`:             "[]int [1 2 3]",
+		`int[1, 2, 3][i32 - 1]`:    "int 3",
+		`int[1, 2, 3][u32 - 3:]`:   "[]int [2 3]",
+		`3 in int64s`:              "bool true",
+		`reduce(int64s, "add", 0)`: "int 6",
+	}
+
+	for input, expected := range inputs {
+		program, err := Compile(input)
+		if err != nil {
+			t.Errorf("%s: %v", input, err)
+			continue
+		}
+
+		for _, run := range []func() (any, error){
+			func() (any, error) { return program.Run(ctx, nil) },
+			func() (any, error) { return program.Tree().Evaluate(ctx) },
+		} {
+			out, err := run()
+			if err != nil {
+				t.Errorf("%s: %v", input, err)
+				continue
+			}
+
+			if got := fmt.Sprintf("%T %v", out, out); got != expected {
+				t.Errorf("%s: expected %s, got %s", input, expected, got)
+			}
+		}
+	}
+}
+
+func TestIntegerOverflow(t *testing.T) {
+	ctx := SetVariables(context.TODO(), map[string]any{
+		"max":  math.MaxInt,
+		"min":  math.MinInt,
+		"huge": uint64(math.MaxUint64),
+	})
+
+	inputs := []string{
+		`max + 1`,
+		`min - 1`,
+		`max * 2`,
+		`min * -1`,
+		`min / -1`,
+		`-min`,
+		`1 << 64`,
+		`max << 1`,
+		`huge + 1`,
+		`add(max, 1)`,
+		`round(1e300)`,
+		`1e300 // 1`,
+	}
+
+	for _, input := range inputs {
+		program := MustCompile(input)
+
+		if _, err := program.Run(ctx, nil); !errors.Is(err, ErrIntegerOverflow) {
+			t.Errorf("%s: expected ErrIntegerOverflow, got %v", input, err)
+		}
+
+		if _, err := program.Tree().Evaluate(ctx); !errors.Is(err, ErrIntegerOverflow) {
+			t.Errorf("%s: tree walker: expected ErrIntegerOverflow, got %v", input, err)
+		}
+	}
+}
+
+func TestLargeUnsignedComparison(t *testing.T) {
+	ctx := SetVariables(context.TODO(), map[string]any{
+		"huge": uint64(math.MaxUint64),
+		"half": uint(1 << 63),
+		"json": json.Number("99999999999999999999"),
+	})
+
+	inputs := map[string]bool{
+		`huge > 0`:                    true,
+		`huge == 1`:                   false,
+		`huge != 1`:                   true,
+		`huge > half`:                 true,
+		`half > 9223372036854775807`:  true,
+		`half == 9223372036854775807`: false,
+		`json > huge`:                 true,
+		`half > 1.5`:                  true,
+		`huge in [1, 2]`:              false,
+		`huge != null`:                true,
+	}
+
+	for input, expected := range inputs {
+		program := MustCompile(input)
+
+		for _, run := range []func() (any, error){
+			func() (any, error) { return program.Run(ctx, nil) },
+			func() (any, error) { return program.Tree().Evaluate(ctx) },
+		} {
+			out, err := run()
+			if err != nil {
+				t.Errorf("%s: %v", input, err)
+				continue
+			}
+
+			if out != expected {
+				t.Errorf("%s: expected %v, got %v", input, expected, out)
+			}
+		}
+	}
+}
+
+func TestMinIntLiteral(t *testing.T) {
+	inputs := map[string]string{
+		`-9223372036854775808`:                         "int -9223372036854775808",
+		`-9223372036854775808 + 1`:                     "int -9223372036854775807",
+		`-9223372036854775807 - 1`:                     "int -9223372036854775808",
+		`-9223372036854775808 == -9223372036854775808`: "bool true",
+	}
+
+	for input, expected := range inputs {
+		program, err := Compile(input)
+		if err != nil {
+			t.Errorf("%s: %v", input, err)
+			continue
+		}
+
+		out, err := program.Run(context.TODO(), nil)
+		if err != nil {
+			t.Errorf("%s: %v", input, err)
+			continue
+		}
+
+		if got := fmt.Sprintf("%T %v", out, out); got != expected {
+			t.Errorf("%s: expected %s, got %s", input, expected, got)
+		}
+
+		if program.Tree().String() != fmt.Sprint(math.MinInt) && !strings.Contains(input, " ") {
+			t.Errorf("%s: expected the literal to be folded, got %s", input, program.Tree())
+		}
+	}
+
+	// only the literal itself can be negated into range
+	for _, input := range []string{`-9223372036854775809`, `-(9223372036854775808)`, `1 - 9223372036854775808`} {
+		if _, err := Compile(input); !errors.Is(err, ErrIntegerOverflow) {
+			t.Errorf("%s: expected ErrIntegerOverflow, got %v", input, err)
+		}
+	}
+
+	if _, err := Evaluate(context.TODO(), `- -9223372036854775808`); !errors.Is(err, ErrIntegerOverflow) {
+		t.Errorf("expected ErrIntegerOverflow, got %v", err)
+	}
+}
+
+func TestArithmeticErrors(t *testing.T) {
+	inputs := map[string]string{
+		`1 / 0`:       "integer division by zero",
+		`1 // 0`:      "integer division by zero",
+		`1 % 0`:       "integer modulo by zero",
+		`1 << -1`:     "negative shift count",
+		`"a" - 1`:     "type mismatch",
+		`"a" + 1`:     "type mismatch",
+		`true * 2`:    "type mismatch",
+		`sub(1)`:      "sub expects 2 arguments, got 1",
+		`mul("a", 2)`: "type mismatch",
+	}
+
+	for input, expected := range inputs {
+		_, err := Evaluate(context.TODO(), input)
+		if err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("%s: expected error containing %q, got %v", input, expected, err)
+		}
+	}
+}
@@ -1,14 +1,20 @@
 package expronaut
 
 import (
+	"errors"
 	"fmt"
+	"math"
+	"regexp"
+	"slices"
 	"strconv"
+	"strings"
 )
 
 type Parser struct {
-	tokens  []Token
-	errors  []error
-	current int
+	tokens      []Token
+	diagnostics Diagnostics
+	current     int
+	closers     []TokenType // the closing brackets of the constructs being parsed
 }
 
 func NewParser(lexer *Lexer) *Parser {
@@ -29,7 +35,34 @@ func NewParser(lexer *Lexer) *Parser {
 
 // expression parses an expression.
 func (p *Parser) expression() ASTNode {
-	return p.logicalOr()
+	return p.conditional()
+}
+
+// conditional handles cond ? a : b, it is right associative so
+// a ? b : c ? d : e is a ? b : (c ? d : e).
+func (p *Parser) conditional() ASTNode {
+	node := p.nullCoalesce()
+
+	if p.match(TokenTypeQuestion) {
+		consequent := p.conditional()
+		p.consume(TokenTypeColon, `":" in the conditional expression`)
+		alternative := p.conditional()
+		node = at(&ConditionalNode{Condition: node, Consequent: consequent, Alternative: alternative}, p.span(spanOf(node).Start))
+	}
+
+	return node
+}
+
+// nullCoalesce handles ??.
+func (p *Parser) nullCoalesce() ASTNode {
+	node := p.logicalOr()
+
+	for p.match(TokenTypeNullCoalesce) {
+		right := p.logicalOr()
+		node = at(&NullCoalesceNode{Left: node, Right: right}, p.span(spanOf(node).Start))
+	}
+
+	return node
 }
 
 // logicalOr handles ||.
@@ -39,7 +72,7 @@ func (p *Parser) logicalOr() ASTNode {
 	for p.match(TokenTypeOr) {
 		operator := p.previous()
 		right := p.logicalAnd()
-		node = &LogicalOperationNode{Left: node, Operator: operator.Type, Right: right}
+		node = at(&LogicalOperationNode{Left: node, Operator: operator.Type, Right: right}, p.span(spanOf(node).Start))
 	}
 
 	return node
@@ -52,33 +85,55 @@ func (p *Parser) logicalAnd() ASTNode {
 	for p.match(TokenTypeAnd) {
 		operator := p.previous()
 		right := p.equality()
-		node = &LogicalOperationNode{Left: node, Operator: operator.Type, Right: right}
+		node = at(&LogicalOperationNode{Left: node, Operator: operator.Type, Right: right}, p.span(spanOf(node).Start))
 	}
 
 	return node
 }
 
-// equality handles == and !=.
+// equality handles ==, !=, =~ and !~.
 func (p *Parser) equality() ASTNode {
 	node := p.comparison()
 
-	for p.match(TokenTypeEqual, TokenTypeNotEqual) {
+	for p.match(TokenTypeEqual, TokenTypeNotEqual, TokenTypeMatch, TokenTypeNotMatch) {
 		operator := p.previous()
 		right := p.comparison()
-		node = &BinaryOperationNode{Left: node, Operator: operator.Type, Right: right}
+
+		if operator.Type == TokenTypeMatch || operator.Type == TokenTypeNotMatch {
+			node = p.regexMatch(node, operator.Type, right)
+			continue
+		}
+
+		node = at(&BinaryOperationNode{Left: node, Operator: operator.Type, Right: right}, p.span(spanOf(node).Start))
+	}
+
+	return node
+}
+
+// regexMatch creates a regular expression match. Literal patterns are compiled
+// once, here, so that invalid patterns are reported while parsing.
+func (p *Parser) regexMatch(subject ASTNode, operator TokenType, pattern ASTNode) ASTNode {
+	node := at(&RegexMatchNode{Subject: subject, Operator: operator, Pattern: pattern}, p.span(spanOf(subject).Start))
+
+	if literal, ok := pattern.(*StringLiteralNode); ok {
+		re, err := regexp.Compile(literal.Value)
+		if err != nil {
+			p.report(CodeInvalidLiteral, literal.Span(), fmt.Errorf("invalid regular expression %q: %v", literal.Value, err), "")
+		}
+		node.regexp = re
 	}
 
 	return node
 }
 
-// comparison handles <, <=, >, and >=.
+// comparison handles <, <=, >, >=, in and not in.
 func (p *Parser) comparison() ASTNode {
 	node := p.shift()
 
-	for p.match(TokenTypeGreaterThan, TokenTypeGreaterThanOrEqual, TokenTypeLessThan, TokenTypeLessThanOrEqual) {
+	for p.match(TokenTypeGreaterThan, TokenTypeGreaterThanOrEqual, TokenTypeLessThan, TokenTypeLessThanOrEqual, TokenTypeIn, TokenTypeNotIn) {
 		operator := p.previous()
 		right := p.shift()
-		node = &BinaryOperationNode{Left: node, Operator: operator.Type, Right: right}
+		node = at(&BinaryOperationNode{Left: node, Operator: operator.Type, Right: right}, p.span(spanOf(node).Start))
 	}
 
 	return node
@@ -91,7 +146,7 @@ func (p *Parser) shift() ASTNode {
 	for p.match(TokenTypeLeftShift, TokenTypeRightShift) {
 		operator := p.previous()
 		right := p.addition()
-		node = &BinaryOperationNode{Left: node, Operator: operator.Type, Right: right}
+		node = at(&BinaryOperationNode{Left: node, Operator: operator.Type, Right: right}, p.span(spanOf(node).Start))
 	}
 
 	return node
@@ -104,7 +159,7 @@ func (p *Parser) addition() ASTNode {
 	for p.match(TokenTypePlus, TokenTypeMinus) {
 		operator := p.previous()
 		right := p.multiplication()
-		node = &BinaryOperationNode{Left: node, Operator: operator.Type, Right: right}
+		node = at(&BinaryOperationNode{Left: node, Operator: operator.Type, Right: right}, p.span(spanOf(node).Start))
 	}
 
 	return node
@@ -117,89 +172,439 @@ func (p *Parser) multiplication() ASTNode {
 	for p.match(TokenTypeMultiply, TokenTypeDivide, TokenTypeModulo, TokenTypeDivideInteger) {
 		operator := p.previous()
 		right := p.functions()
-		node = &BinaryOperationNode{Left: node, Operator: operator.Type, Right: right}
+		node = at(&BinaryOperationNode{Left: node, Operator: operator.Type, Right: right}, p.span(spanOf(node).Start))
 	}
 
 	return node
 }
 
 func (p *Parser) functions() ASTNode {
-	node := p.primary()
+	node := p.unary()
 
 	for p.match(TokenTypeExponent, TokenTypeFunction) {
 		operator := p.previous()
 		right := p.functions()
-		node = &BinaryOperationNode{Left: node, Operator: operator.Type, Right: right}
+		node = at(&BinaryOperationNode{Left: node, Operator: operator.Type, Right: right}, p.span(spanOf(node).Start))
 	}
 
 	return node
 }
 
+// unary handles the prefix operators !, -, + and ~. They bind tighter than any
+// binary operator, so -2 ^ 2 is (-2) ^ 2.
+func (p *Parser) unary() ASTNode {
+	if p.match(TokenTypeNot, TokenTypeMinus, TokenTypePlus, TokenTypeBitwiseNot) {
+		operator := p.previous()
+
+		// the smallest int, -9223372036854775808, only fits with its minus
+		if operator.Type == TokenTypeMinus && p.check(TokenTypeInt) {
+			if _, err := parseInt(p.peek().Literal); err != nil {
+				if value, err := parseInt("-" + p.peek().Literal); err == nil {
+					p.advance()
+					return p.postfixOf(at(&IntLiteralNode{Value: value}, p.span(operator.Pos)))
+				}
+			}
+		}
+
+		operand := p.unary()
+
+		// fold negative number literals so they stay literals
+		if operator.Type == TokenTypeMinus {
+			switch o := operand.(type) {
+			case *IntLiteralNode:
+				// -9223372036854775808 is left to overflow at evaluation
+				if o.Value != math.MinInt {
+					return at(&IntLiteralNode{Value: -o.Value}, p.span(operator.Pos))
+				}
+			case *FloatLiteralNode:
+				return at(&FloatLiteralNode{Value: -o.Value}, p.span(operator.Pos))
+			}
+		}
+
+		return at(&UnaryOperationNode{Operator: operator.Type, Operand: operand}, p.span(operator.Pos))
+	}
+
+	return p.postfix()
+}
+
+// postfix handles the postfix operators following a primary expression: ?.,
+// indexes a[i] and slices a[i:j].
+func (p *Parser) postfix() ASTNode {
+	return p.postfixOf(p.primary())
+}
+
+// postfixOf handles the postfix operators following the node.
+func (p *Parser) postfixOf(node ASTNode) ASTNode {
+	for {
+		switch {
+		case p.match(TokenTypeOptionalChain):
+			if !p.match(TokenTypeArray) {
+				p.consume(TokenTypeVariable, `a property name after "?."`)
+			}
+			p.checkPath(p.previous())
+			node = at(&OptionalChainNode{Object: node, Path: strings.Split(p.previous().Literal, ".")}, p.span(spanOf(node).Start))
+		case p.match(TokenTypeArrayStart):
+			node = p.index(node)
+		default:
+			return node
+		}
+	}
+}
+
+// lambdaAhead reports whether the parenthesis at the current position starts
+// the parameter list of a lambda, (a, b) =>.
+func (p *Parser) lambdaAhead() bool {
+	i := p.current + 1
+	if i < len(p.tokens) && p.tokens[i].Type != TokenTypeParenRight {
+		for i < len(p.tokens) && p.tokens[i].Type == TokenTypeVariable {
+			i++
+			if i >= len(p.tokens) || p.tokens[i].Type != TokenTypeComma {
+				break
+			}
+			i++
+		}
+	}
+
+	return i+1 < len(p.tokens) && p.tokens[i].Type == TokenTypeParenRight && p.tokens[i+1].Type == TokenTypeArrow
+}
+
+// lambda parses the body of a lambda once its parameters and the arrow have
+// been consumed, pos is the position of the lambda.
+func (p *Parser) lambda(pos Position, params []Token) ASTNode {
+	node := &LambdaNode{}
+	seen := make(map[string]bool)
+
+	for _, param := range params {
+		switch {
+		case strings.Contains(param.Literal, "."):
+			p.report(CodeInvalidParameter, param.Span(), fmt.Errorf("invalid lambda parameter %q", param.Literal), "use a name without dots")
+		case seen[param.Literal]:
+			p.report(CodeInvalidParameter, param.Span(), fmt.Errorf("duplicate lambda parameter %q", param.Literal), "rename the parameter")
+		}
+		seen[param.Literal] = true
+
+		node.Params = append(node.Params, param.Literal)
+	}
+
+	node.Body = p.expression()
+
+	return at(node, p.span(pos))
+}
+
+// mapLiteral parses the entries of a map literal, { "key": value, ... }.
+func (p *Parser) mapLiteral() ASTNode {
+	pos := p.previous().Pos
+	node := &MapNode{}
+	seen := make(map[string]bool)
+
+	p.list(TokenTypeMapEnd, "map entries", func() {
+		// an entry without a key or colon is skipped as a whole
+		if tok := p.peek(); tok.Type != TokenTypeString {
+			p.report(CodeInvalidKey, tok.Span(), fmt.Errorf("unexpected %s, expected a string key in the map literal", describeToken(tok)), "quote the key")
+			return
+		}
+
+		key := p.consume(TokenTypeString, "a string key")
+		if p.consume(TokenTypeColon, `":" after the map key`).Type != TokenTypeColon {
+			return
+		}
+
+		if seen[key.Literal] {
+			p.report(CodeDuplicateKey, key.Span(), fmt.Errorf("duplicate key %q in map literal", key.Literal), "remove one of the entries")
+		}
+		seen[key.Literal] = true
+
+		node.Keys = append(node.Keys, key.Literal)
+		node.Values = append(node.Values, p.expression())
+	})
+
+	return at(node, p.span(pos))
+}
+
+// index handles the part between the brackets of an index or a slice.
+func (p *Parser) index(object ASTNode) ASTNode {
+	p.closers = append(p.closers, TokenTypeArrayEnd)
+	defer p.close()
+
+	var start ASTNode
+	if !p.check(TokenTypeColon) {
+		start = p.expression()
+	}
+
+	if !p.match(TokenTypeColon) {
+		p.consume(TokenTypeArrayEnd, `"]" after the index`)
+		return at(&IndexNode{Object: object, Index: start}, p.span(spanOf(object).Start))
+	}
+
+	var end ASTNode
+	if !p.check(TokenTypeArrayEnd) {
+		end = p.expression()
+	}
+
+	p.consume(TokenTypeArrayEnd, `"]" after the slice`)
+
+	return at(&SliceNode{Object: object, Start: start, End: end}, p.span(spanOf(object).Start))
+}
+
 // primary handles the base case of the recursive descent parser.
 func (p *Parser) primary() ASTNode {
 	switch {
 	case p.match(TokenTypeInt):
-		return &IntLiteralNode{Value: parseInt(p.previous().Literal)}
+		value, err := parseInt(p.previous().Literal)
+		if err != nil {
+			p.report(CodeInvalidLiteral, p.previous().Span(), err, "")
+		}
+		return at(&IntLiteralNode{Value: value}, p.span(p.previous().Pos))
 	case p.match(TokenTypeFloat):
-		return &FloatLiteralNode{Value: parseFloat(p.previous().Literal)}
+		value, err := parseFloat(p.previous().Literal)
+		if err != nil {
+			p.report(CodeInvalidLiteral, p.previous().Span(), err, "")
+		}
+		return at(&FloatLiteralNode{Value: value}, p.span(p.previous().Pos))
+	case p.match(TokenTypeDuration):
+		value, err := parseDuration(p.previous().Literal)
+		if err != nil {
+			p.report(CodeInvalidLiteral, p.previous().Span(), err, "")
+		}
+		return at(&DurationLiteralNode{Value: value}, p.span(p.previous().Pos))
 	case p.match(TokenTypeString):
-		return &StringLiteralNode{Value: p.previous().Literal}
+		return at(&StringLiteralNode{Value: p.previous().Literal}, p.span(p.previous().Pos))
 	case p.match(TokenTypeBool):
-		return &BooleanLiteralNode{Value: parseBool(p.previous().Literal)}
+		return at(&BooleanLiteralNode{Value: parseBool(p.previous().Literal)}, p.span(p.previous().Pos))
+	case p.match(TokenTypeNull):
+		return at(&NullLiteralNode{}, p.span(p.previous().Pos))
+	case p.check(TokenTypeVariable) && p.next().Type == TokenTypeArrow:
+		param := p.advance()
+		p.advance()
+		return p.lambda(param.Pos, []Token{param})
 	case p.match(TokenTypeVariable):
-		return &VariableNode{Name: p.previous().Literal}
+		p.checkPath(p.previous())
+		return at(&VariableNode{Name: p.previous().Literal}, p.span(p.previous().Pos))
+	case p.check(TokenTypeParenLeft) && p.lambdaAhead():
+		pos := p.advance().Pos
+
+		var params []Token
+		for !p.match(TokenTypeParenRight) {
+			params = append(params, p.advance())
+			p.match(TokenTypeComma)
+		}
+		p.advance()
+
+		return p.lambda(pos, params)
 	case p.match(TokenTypeParenLeft):
+		p.closers = append(p.closers, TokenTypeParenRight)
 		expr := p.expression()
-		p.consume(TokenTypeParenRight, "Expect ')' after expression.")
+		p.consume(TokenTypeParenRight, `")" after the expression`)
+		p.close()
 		return expr
 	case p.match(TokenTypeFunction):
-		funcName := p.previous().Literal
+		function := p.previous()
 		var arguments []ASTNode
 
-		p.consume(TokenTypeParenLeft, "Expect '(' after function.")
+		p.consume(TokenTypeParenLeft, `"(" after the function name`)
+		p.list(TokenTypeParenRight, "function arguments", func() {
+			arguments = append(arguments, p.expression())
+		})
 
-		if !p.check(TokenTypeParenRight) {
-			for {
-				// Parse an argument expression.
-				argument := p.expression()
-				arguments = append(arguments, argument)
+		return at(&FunctionCallNode{FunctionName: function.Literal, Arguments: arguments}, p.span(function.Pos))
+	case p.match(TokenTypeArray):
+		var elements []ASTNode
+		start := p.previous()
+		arrayType := arrayType(start.Literal)
 
-				// If there's no comma, stop parsing arguments.
-				if !p.match(TokenTypeComma) {
-					break
-				}
-			}
+		// an identifier that is not an array type is a variable followed by an index
+		if !arrayType.valid() {
+			p.checkPath(start)
+			return at(&VariableNode{Name: p.previous().Literal}, p.span(p.previous().Pos))
 		}
 
-		// After parsing all arguments, expect the closing parenthesis.
-		p.consume(TokenTypeParenRight, "Expect ')' after arguments to function.")
+		p.consume(TokenTypeArrayStart, `"[" after the array type`)
+		p.list(TokenTypeArrayEnd, "array elements", func() {
+			elements = append(elements, p.expression())
+		})
 
-		return &FunctionCallNode{FunctionName: funcName, Arguments: arguments}
-	case p.match(TokenTypeArray):
+		return at(&ArrayNode{Type: arrayType, Elements: elements}, p.span(start.Pos))
+	case p.match(TokenTypeMapStart):
+		return p.mapLiteral()
+	case p.match(TokenTypeArrayStart):
 		var elements []ASTNode
-		arrayType := arrayType(p.previous().Literal)
-
-		p.consume(TokenTypeArrayStart, "Expect '[' after array.")
-		if !p.check(TokenTypeArrayEnd) {
-			for {
-				// Parse an element expression.
-				element := p.expression()
-				elements = append(elements, element)
-
-				// If there's no comma, stop parsing elements.
-				if !p.match(TokenTypeComma) {
-					break
-				}
+		start := p.previous()
+
+		p.list(TokenTypeArrayEnd, "array elements", func() {
+			elements = append(elements, p.expression())
+		})
+
+		return at(&ArrayNode{Type: arrayTypeAny, Elements: elements}, p.span(start.Pos))
+	}
+
+	// illegal characters are reported by the lexer
+	if tok := p.peek(); tok.Type != TokenTypeIllegal {
+		p.report(CodeUnexpectedToken, tok.Span(), fmt.Errorf("unexpected %s, expected an operand", describeToken(tok)), "")
+	}
+
+	// the token is left for the caller to synchronise on
+	return at(&ErrorNode{}, p.peek().Span())
+}
+
+// list parses the comma separated elements of a list up to and including the
+// closing token, what names the elements in error messages. After an error it
+// skips to the next comma or to the closing token and continues, so the errors
+// in the following elements are reported too. The closing token is not
+// consumed when the list ends at the closing bracket of an enclosing list or
+// at the end of the expression.
+func (p *Parser) list(closing TokenType, what string, element func()) {
+	p.closers = append(p.closers, closing)
+	defer p.close()
+
+	if p.match(closing) {
+		return
+	}
+
+	for {
+		element()
+
+		if p.match(TokenTypeComma) {
+			continue
+		}
+		if p.match(closing) {
+			return
+		}
+
+		expected := fmt.Sprintf("%q or %q in the %s", ",", closingBrackets[closing], what)
+		p.unexpected(closing, expected)
+
+		switch p.synchronize(true) {
+		case TokenTypeComma:
+			p.advance()
+		case closing:
+			p.advance()
+			return
+		default:
+			p.unclosed(closing, expected)
+			return
+		}
+	}
+}
+
+// unexpected reports the next token where the syntax expects another one,
+// described by expected. A missing closing bracket at the end of the
+// expression is reported as an unclosed bracket.
+func (p *Parser) unexpected(tokenType TokenType, expected string) {
+	tok := p.peek()
+	if closing, ok := closingBrackets[tokenType]; ok && tok.Type == TokenTypeEOF {
+		p.report(CodeUnclosedBracket, tok.Span(), fmt.Errorf("unexpected %s, expected %s", describeToken(tok), expected), fmt.Sprintf("add the missing %q", closing))
+		return
+	}
+
+	p.report(CodeUnexpectedToken, tok.Span(), fmt.Errorf("unexpected %s, expected %s", describeToken(tok), expected), "")
+}
+
+// unclosed reports the closing bracket the input ended without, when skipping
+// to it after an error reached the end of the expression.
+func (p *Parser) unclosed(tokenType TokenType, expected string) {
+	if p.isAtEnd() {
+		p.unexpected(tokenType, expected)
+	}
+}
+
+// checkPath reports the empty segments of a dotted variable name such as a.b.
+// or a..b.
+func (p *Parser) checkPath(tok Token) {
+	if (tok.Type == TokenTypeVariable || tok.Type == TokenTypeArray) && slices.Contains(strings.Split(tok.Literal, "."), "") {
+		p.report(CodeInvalidPath, tok.Span(), fmt.Errorf("variable %q has an empty path segment", tok.Literal), "remove the extra dot")
+	}
+}
+
+// close ends the innermost construct that was opened with a closing bracket.
+func (p *Parser) close() {
+	p.closers = p.closers[:len(p.closers)-1]
+}
+
+// synchronize skips tokens after a syntax error until the closing bracket of
+// the construct being parsed or of one enclosing it, or a comma when
+// stopAtComma is set. Brackets opened in between are skipped as a whole, as
+// are closing brackets that no construct is waiting for. It returns the type
+// of the token it stopped at, which is left unconsumed: a comma, a closing
+// bracket or EOF.
+func (p *Parser) synchronize(stopAtComma bool) TokenType {
+	depth := 0
+	for !p.isAtEnd() {
+		switch tok := p.peek(); tok.Type {
+		case TokenTypeParenLeft, TokenTypeArrayStart, TokenTypeMapStart:
+			depth++
+		case TokenTypeParenRight, TokenTypeArrayEnd, TokenTypeMapEnd:
+			if depth == 0 && slices.Contains(p.closers, tok.Type) {
+				return tok.Type
+			}
+			depth = max(depth-1, 0)
+		case TokenTypeComma:
+			if depth == 0 && stopAtComma {
+				return tok.Type
 			}
 		}
+		p.advance()
+	}
 
-		// After parsing all elements, expect the closing bracket.
-		p.consume(TokenTypeArrayEnd, "Expect ']' after elements to array.")
+	return TokenTypeEOF
+}
 
-		return &ArrayNode{Type: arrayType, Elements: elements}
+// closingBrackets are the literals of the closing brackets.
+var closingBrackets = map[TokenType]string{
+	TokenTypeParenRight: ")",
+	TokenTypeArrayEnd:   "]",
+	TokenTypeMapEnd:     "}",
+}
+
+// binaryOperators are the operators that appear between two operands, the
+// parser skips them together with the input that cannot be parsed.
+var binaryOperators = []TokenType{
+	TokenTypeAnd, TokenTypeOr, TokenTypePlus, TokenTypeMinus, TokenTypeMultiply, TokenTypeDivide,
+	TokenTypeDivideInteger, TokenTypeModulo, TokenTypeEqual, TokenTypeNotEqual, TokenTypeLessThan,
+	TokenTypeGreaterThan, TokenTypeLessThanOrEqual, TokenTypeGreaterThanOrEqual, TokenTypeExponent,
+	TokenTypeLeftShift, TokenTypeRightShift, TokenTypeQuestion, TokenTypeColon, TokenTypeNullCoalesce,
+	TokenTypeOptionalChain, TokenTypeIn, TokenTypeNotIn, TokenTypeMatch, TokenTypeNotMatch, TokenTypeArrow,
+}
+
+// describeToken returns the token as it is named in error messages.
+func describeToken(tok Token) string {
+	if tok.Type == TokenTypeEOF {
+		return "end of expression"
 	}
 
-	return &IntLiteralNode{Value: 0}
+	return fmt.Sprintf("%q", tok.Literal)
+}
+
+// report records a syntax error found at the span, unless an error was
+// already reported at its start.
+func (p *Parser) report(code DiagnosticCode, span Span, err error, suggestion string) {
+	// one error per position, the errors following from it are noise
+	if p.reported(span.Start) {
+		return
+	}
+
+	p.diagnostics = append(p.diagnostics, Diagnostic{
+		Severity:   SeverityError,
+		Code:       code,
+		Message:    err.Error(),
+		Span:       span,
+		Suggestion: suggestion,
+		err:        err,
+	})
+}
+
+// span returns the span from start to the end of the last consumed token.
+func (p *Parser) span(start Position) Span {
+	if p.current == 0 || p.previous().End.Offset < start.Offset {
+		return Span{Start: start, End: start}
+	}
+
+	return Span{Start: start, End: p.previous().End}
+}
+
+// at records the span of the node in the source and returns the node.
+func at[N interface{ setSpan(Span) }](node N, span Span) N {
+	node.setSpan(span)
+	return node
 }
 
 // previous returns the previous token.
@@ -235,33 +640,34 @@ func (p *Parser) isModifier(tokenType TokenType) bool {
 }
 
 func (p *Parser) isOperand(tokenType TokenType) bool {
-	if tokenType == TokenTypeInt || tokenType == TokenTypeFloat || tokenType == TokenTypeString || tokenType == TokenTypeBool || tokenType == TokenTypeVariable || tokenType == TokenTypeFunction || tokenType == TokenTypeArray {
+	if tokenType == TokenTypeInt || tokenType == TokenTypeFloat || tokenType == TokenTypeDuration || tokenType == TokenTypeString || tokenType == TokenTypeBool || tokenType == TokenTypeNull || tokenType == TokenTypeVariable || tokenType == TokenTypeFunction || tokenType == TokenTypeArray {
 		return true
 	}
 	return false
 }
 
-// consume expects the next token to be of a given type and consumes it, or throws an error.
-func (p *Parser) consume(tokenType TokenType, message string) Token {
+// consume expects the next token to be of a given type and consumes it, or
+// reports it as unexpected, expected describes the token in the error.
+func (p *Parser) consume(tokenType TokenType, expected string) Token {
 	if p.isOperand(tokenType) && p.isOperand(p.next().Type) {
-		p.errors = append(p.errors, fmt.Errorf("operand should be followed by a modifier: got: %s(%v), next: %s(%v)", p.currentToken().Type, p.currentToken().Literal, p.next().Type, p.next().Literal))
+		p.report(CodeMissingOperator, p.next().Span(), fmt.Errorf("missing operator between %s and %s", describeToken(p.currentToken()), describeToken(p.next())), "add an operator between the operands")
 	}
 
 	if p.check(tokenType) {
 		return p.advance()
 	}
 
-	if tokenType == TokenTypeParenRight {
-		// keep going until we find the closing parenthesis
-		for !p.check(TokenTypeParenRight) {
-			p.consume(p.peek().Type, "Expect ')' after expression.")
-		}
+	p.unexpected(tokenType, expected)
 
-		return p.advance()
+	// skip to the missing closing bracket, unless the input ends first or the
+	// bracket that follows closes an enclosing construct
+	if _, ok := closingBrackets[tokenType]; ok {
+		if p.synchronize(false) == tokenType {
+			return p.advance()
+		}
+		p.unclosed(tokenType, expected)
 	}
 
-	p.errors = append(p.errors, fmt.Errorf("%s: got: %s", message, tokenType))
-
 	return p.peek()
 }
 
@@ -303,26 +709,84 @@ func (p *Parser) match(types ...TokenType) bool {
 	return false
 }
 
+// skip consumes tokens as long as they match any of the given types.
+func (p *Parser) skip(types ...TokenType) {
+	for slices.ContainsFunc(types, p.check) {
+		p.advance()
+	}
+}
+
 // Parse starts the parsing process.
 func (p *Parser) Parse() ASTNode {
-	return p.expression() // Start parsing from the highest level of precedence.
+	nodes := []ASTNode{p.expression()} // Start parsing from the highest level of precedence.
+
+	// the input following the expression, illegal characters are reported by
+	// the lexer and tokens by the error that ended the expression. The rest of
+	// the input is parsed as well, so the errors in it are reported too.
+	trailing := false
+	for !p.isAtEnd() {
+		if p.match(TokenTypeIllegal) {
+			continue
+		}
+
+		if tok := p.peek(); !trailing && !p.reported(tok.Pos) {
+			p.report(CodeTrailingInput, Span{Start: tok.Pos, End: p.tokens[len(p.tokens)-2].End},
+				fmt.Errorf("unexpected %s after the end of the expression", describeToken(tok)),
+				"remove it or join it to the expression with an operator")
+			trailing = true
+		}
+
+		// resume after the token and the operators following it
+		p.advance()
+		p.skip(binaryOperators...)
+
+		if !p.isAtEnd() && !p.check(TokenTypeIllegal) {
+			nodes = append(nodes, p.expression())
+		}
+	}
+
+	if len(nodes) == 1 {
+		return nodes[0]
+	}
+
+	return at(&ErrorNode{Nodes: nodes}, Span{Start: spanOf(nodes[0]).Start, End: spanOf(nodes[len(nodes)-1]).End})
+}
+
+// reported reports whether an error was reported at the position.
+func (p *Parser) reported(pos Position) bool {
+	for _, d := range p.diagnostics {
+		if d.Span.Start == pos {
+			return true
+		}
+	}
+
+	return false
 }
 
-// parseNumber converts a string literal to a float64.
-func parseFloat(lit string) float64 {
+// parseFloat parses a float literal such as 1.5 or 2e10, reporting literals
+// too large for a float64.
+func parseFloat(lit string) (float64, error) {
 	value, err := strconv.ParseFloat(lit, 64)
+	if errors.Is(err, strconv.ErrRange) {
+		return 0, fmt.Errorf("number literal %s is out of range", lit)
+	}
 	if err != nil {
-		panic(err) // or handle the error as appropriate
+		return 0, fmt.Errorf("invalid number literal %s", lit)
 	}
-	return value
+	return value, nil
 }
 
-func parseInt(lit string) int {
+// parseInt parses an integer literal, reporting literals that do not fit in
+// an int. Larger integers can be written as bigint("...").
+func parseInt(lit string) (int, error) {
 	value, err := strconv.Atoi(lit)
+	if errors.Is(err, strconv.ErrRange) {
+		return 0, fmt.Errorf("%w: integer literal %s does not fit in an int", ErrIntegerOverflow, lit)
+	}
 	if err != nil {
-		panic(err) // or handle the error as appropriate
+		return 0, fmt.Errorf("invalid number literal %s", lit)
 	}
-	return value
+	return value, nil
 }
 
 func parseBool(lit string) bool {
@@ -2,8 +2,12 @@ package expronaut
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"math"
 	"reflect"
+	"slices"
+	"strings"
 	"testing"
 	"time"
 )
@@ -372,3 +376,782 @@ func equalBool(a, b any) bool {
 
 	return aOk && bOk && aBool == bBool
 }
+
+func TestShortCircuit(t *testing.T) {
+	var calls int
+	RegisterFunction("counted", func(ctx context.Context, args ...any) (any, error) {
+		calls++
+		return true, nil
+	})
+
+	ctx := SetVariables(context.TODO(), map[string]any{
+		"user": map[string]any{"age": 0},
+	})
+
+	inputs := map[string]bool{
+		`user.age != 0 && 100 / user.age > 2`: false,
+		`user.age == 0 || 100 / user.age > 2`: true,
+		`false && missing.value > 1`:          false,
+		`true || missing.value > 1`:           true,
+		`false && counted()`:                  false,
+		`true || counted()`:                   true,
+		`true && counted()`:                   true,
+	}
+
+	for input, expected := range inputs {
+		lexer := NewLexer(input)
+		p := NewParser(lexer)
+		tree := p.Parse()
+
+		out, err := tree.Evaluate(ctx)
+		if err != nil {
+			t.Errorf("%s: %v", input, err)
+		}
+		if !equalBool(out, expected) {
+			t.Errorf("%s: expected %v, got %v", input, expected, out)
+		}
+
+		out, err = Evaluate(ctx, input)
+		if err != nil {
+			t.Errorf("%s: %v", input, err)
+		}
+		if !equalBool(out, expected) {
+			t.Errorf("%s: expected %v, got %v", input, expected, out)
+		}
+	}
+
+	if calls != 2 {
+		t.Errorf("expected counted() to be called 2 times, got %d", calls)
+	}
+}
+
+func TestShortCircuitNonBoolean(t *testing.T) {
+	inputs := []string{
+		`1 && true`,
+		`true && 1`,
+		`false || "a"`,
+	}
+
+	for _, input := range inputs {
+		out, err := Evaluate(context.TODO(), input)
+		if err == nil {
+			t.Errorf("%s: expected error, got %v", input, out)
+		}
+	}
+}
+
+func TestUnary(t *testing.T) {
+	ctx := SetVariables(context.TODO(), map[string]any{
+		"active": false,
+		"price":  12.5,
+		"a":      2,
+		"b":      3,
+	})
+
+	inputs := map[string]any{
+		`!active`:            true,
+		`!!active`:           false,
+		`!(a > b)`:           true,
+		`!active && a < b`:   true,
+		`-(a + b)`:           -5,
+		`-price`:             -12.5,
+		`+price`:             12.5,
+		`-a * b`:             -6,
+		`5-3`:                2,
+		`~a`:                 -3,
+		`-2 ^ 2`:             4,
+		`2 ^ -1`:             0.5,
+		`abs(-a) == a`:       true,
+		`-sqrt(16) + 4 == 0`: true,
+	}
+
+	for input, expected := range inputs {
+		out, err := Evaluate(ctx, input)
+		if err != nil {
+			t.Errorf("%s: %v", input, err)
+			continue
+		}
+
+		if b, ok := expected.(bool); ok {
+			if !equalBool(out, b) {
+				t.Errorf("%s: expected %v, got %v", input, expected, out)
+			}
+			continue
+		}
+
+		if !equalNumber(out, expected) {
+			t.Errorf("%s: expected %v, got %v", input, expected, out)
+		}
+	}
+}
+
+func TestUnaryTypeMismatch(t *testing.T) {
+	inputs := []string{
+		`!1`,
+		`-"abc"`,
+		`~1.5`,
+	}
+
+	for _, input := range inputs {
+		out, err := Evaluate(context.TODO(), input)
+		if err == nil {
+			t.Errorf("%s: expected error, got %v", input, out)
+		}
+	}
+}
+
+func TestUnaryGoTemplate(t *testing.T) {
+	inputs := map[string]string{
+		`!active`:          `not .active`,
+		`!(a == b)`:        `not (eq .a .b)`,
+		`-price`:           `sub 0 .price`,
+		`-(a + b)`:         `sub 0 (add .a .b)`,
+		`+price`:           `.price`,
+		`!active && a < b`: `and ( not .active ) ( lt .a .b )`,
+	}
+
+	for input, expected := range inputs {
+		lexer := NewLexer(input)
+		p := NewParser(lexer)
+		tree := p.Parse()
+
+		if tree.GoTemplate() != expected {
+			t.Errorf("%s: expected %s, got %s", input, expected, tree.GoTemplate())
+		}
+	}
+}
+
+func TestUnaryString(t *testing.T) {
+	input := `!(a > -b)`
+	lexer := NewLexer(input)
+	p := NewParser(lexer)
+	tree := p.Parse()
+
+	expected := `(NOT (a GREATER_THAN (MINUS b)))`
+	if tree.String() != expected {
+		t.Errorf("expected %s, got %s", expected, tree.String())
+	}
+}
+
+func TestConditional(t *testing.T) {
+	ctx := SetVariables(context.TODO(), map[string]any{
+		"age":   21,
+		"score": 75,
+		"user":  map[string]any{},
+	})
+
+	inputs := map[string]any{
+		`age >= 18 ? "adult" : "minor"`:                            "adult",
+		`age < 18 ? "minor" : "adult"`:                             "adult",
+		`score > 90 ? "A" : score > 70 ? "B" : "C"`:                "B",
+		`(age > 18 ? 10 : 20) * 2`:                                 20,
+		`age > 18 && score > 50 ? "ok" : "nok"`:                    "ok",
+		`true ? "chosen" : user.missing.field`:                     "chosen",
+		`false ? user.missing.field : "chosen"`:                    "chosen",
+		`age > 18 ? (score > 50 ? "both" : "age") : "none"`:        "both",
+		`concat("a", age > 100 ? "b" : "c")`:                       "ac",
+		`age > 18 ? age > 20 ? "over twenty" : "twenty" : "young"`: "over twenty",
+	}
+
+	for input, expected := range inputs {
+		lexer := NewLexer(input)
+		p := NewParser(lexer)
+		tree := p.Parse()
+
+		out, err := tree.Evaluate(ctx)
+		if err != nil {
+			t.Errorf("%s: %v", input, err)
+		}
+		if fmt.Sprint(out) != fmt.Sprint(expected) {
+			t.Errorf("%s: expected %v, got %v", input, expected, out)
+		}
+
+		out, err = Evaluate(ctx, input)
+		if err != nil {
+			t.Errorf("%s: %v", input, err)
+		}
+		if fmt.Sprint(out) != fmt.Sprint(expected) {
+			t.Errorf("%s: expected %v, got %v", input, expected, out)
+		}
+	}
+}
+
+func TestConditionalErrors(t *testing.T) {
+	inputs := []string{
+		`1 ? 2 : 3`,
+		`true ? 2`,
+	}
+
+	for _, input := range inputs {
+		out, err := Evaluate(context.TODO(), input)
+		if err == nil {
+			t.Errorf("%s: expected error, got %v", input, out)
+		}
+	}
+}
+
+func TestConditionalGoTemplate(t *testing.T) {
+	input := `age >= 18 ? "adult" : "minor"`
+	lexer := NewLexer(input)
+	p := NewParser(lexer)
+	tree := p.Parse()
+
+	expected := `ternary ( "adult" ) ( "minor" ) ( ge .age 18 )`
+	if tree.GoTemplate() != expected {
+		t.Errorf("expected %s, got %s", expected, tree.GoTemplate())
+	}
+}
+
+func TestNull(t *testing.T) {
+	ctx := SetVariables(context.TODO(), map[string]any{
+		"nothing": nil,
+		"name":    "expronaut",
+		"user": map[string]any{
+			"name":    "Jane",
+			"address": nil,
+			"profile": map[string]any{"age": 42},
+		},
+	})
+
+	inputs := map[string]any{
+		`nothing == null`:                  true,
+		`null == nothing`:                  true,
+		`name == null`:                     false,
+		`name != null`:                     true,
+		`null == null`:                     true,
+		`user.address == null`:             true,
+		`nothing ?? "default"`:             "default",
+		`name ?? "default"`:                "expronaut",
+		`missing ?? "default"`:             "default",
+		`missing ?? nothing ?? 5`:          5,
+		`user?.name`:                       "Jane",
+		`user?.profile.age`:                42,
+		`user?.profile?.age`:               42,
+		`user?.missing?.age == null`:       true,
+		`user.address?.street ?? "none"`:   "none",
+		`missing?.street ?? "none"`:        "none",
+		`user?.profile.missing ?? "none"`:  "none",
+		`(user?.profile?.age ?? 0) > 40`:   true,
+		`nothing == null ? "empty" : name`: "empty",
+		`name != null ?.5 : 1`:             0.5,
+		`name == null ?.5:.25`:             0.25,
+	}
+
+	for input, expected := range inputs {
+		lexer := NewLexer(input)
+		p := NewParser(lexer)
+		tree := p.Parse()
+
+		out, err := tree.Evaluate(ctx)
+		if err != nil {
+			t.Errorf("%s: %v", input, err)
+		}
+		if fmt.Sprint(out) != fmt.Sprint(expected) {
+			t.Errorf("%s: expected %v, got %v", input, expected, out)
+		}
+
+		out, err = Evaluate(ctx, input)
+		if err != nil {
+			t.Errorf("%s: %v", input, err)
+		}
+		if fmt.Sprint(out) != fmt.Sprint(expected) {
+			t.Errorf("%s: expected %v, got %v", input, expected, out)
+		}
+	}
+}
+
+func TestUndefinedVariable(t *testing.T) {
+	ctx := SetVariables(context.TODO(), map[string]any{
+		"user": map[string]any{"name": "Jane"},
+	})
+
+	inputs := []string{
+		`missing == 1`,
+		`user.missing == 1`,
+		`user.name.first == 1`,
+		`missing + 1 ?? 2`,
+	}
+
+	for _, input := range inputs {
+		_, err := Evaluate(ctx, input)
+
+		var undefined *UndefinedVariableError
+		if !errors.As(err, &undefined) {
+			t.Errorf("%s: expected undefined variable error, got %v", input, err)
+		}
+	}
+}
+
+func TestNullGoTemplate(t *testing.T) {
+	inputs := map[string]string{
+		`user?.address?.street ?? "none"`: `coalesce ( .user.address.street ) ( "none" )`,
+		`name == null`:                    `eq .name nil`,
+	}
+
+	for input, expected := range inputs {
+		lexer := NewLexer(input)
+		p := NewParser(lexer)
+		tree := p.Parse()
+
+		if tree.GoTemplate() != expected {
+			t.Errorf("%s: expected %s, got %s", input, expected, tree.GoTemplate())
+		}
+	}
+}
+
+func TestMembership(t *testing.T) {
+	ctx := SetVariables(context.TODO(), map[string]any{
+		"country":   "NL",
+		"countries": []string{"NL", "BE", "DE"},
+		"ids":       []int{1, 2, 3},
+		"tags":      []any{"a", 1, 2.5, true},
+		"settings":  map[string]any{"beta": true},
+		"limits":    map[string]int{"max": 10},
+		"title":     "the expronaut manual",
+	})
+
+	inputs := map[string]bool{
+		`country in ["NL","BE","DE"]`:                 true,
+		`country in ["FR","ES"]`:                      false,
+		`country not in ["FR","ES"]`:                  true,
+		`country not in countries`:                    false,
+		`"BE" in countries`:                           true,
+		`2 in ids`:                                    true,
+		`2.0 in ids`:                                  true,
+		`4 in ids`:                                    false,
+		`4 not in ids`:                                true,
+		`true in tags`:                                true,
+		`2.5 in tags`:                                 true,
+		`"b" in tags`:                                 false,
+		`"beta" in settings`:                          true,
+		`"alpha" not in settings`:                     true,
+		`"max" in limits`:                             true,
+		`"expronaut" in title`:                        true,
+		`"rocket" in title`:                           false,
+		`3 in int[1,2,3]`:                             true,
+		`country in ["NL"] && 1 in [1, 2]`:            true,
+		`(country in ["NL"]) == (2 not in [1, 2])`:    false,
+		`len(filter(int[1,2,3], "x in [2, 3]")) == 2`: true,
+	}
+
+	for input, expected := range inputs {
+		out, err := Evaluate(ctx, input)
+		if err != nil {
+			t.Errorf("%s: %v", input, err)
+			continue
+		}
+
+		if !equalBool(out, expected) {
+			t.Errorf("%s: expected %v, got %v", input, expected, out)
+		}
+	}
+}
+
+func TestMembershipErrors(t *testing.T) {
+	inputs := []string{
+		`1 in 5`,
+		`1 in "abc"`,
+		`1 in {}`,
+	}
+
+	for _, input := range inputs {
+		out, err := Evaluate(context.TODO(), input)
+		if err == nil {
+			t.Errorf("%s: expected error, got %v", input, out)
+		}
+	}
+}
+
+func TestMembershipGoTemplate(t *testing.T) {
+	inputs := map[string]string{
+		`country in countries`:     `has .country .countries`,
+		`country not in countries`: `not (has .country .countries)`,
+	}
+
+	for input, expected := range inputs {
+		lexer := NewLexer(input)
+		p := NewParser(lexer)
+		tree := p.Parse()
+
+		if tree.GoTemplate() != expected {
+			t.Errorf("%s: expected %s, got %s", input, expected, tree.GoTemplate())
+		}
+	}
+}
+
+func TestRegexMatch(t *testing.T) {
+	ctx := SetVariables(context.TODO(), map[string]any{
+		"message": "ERROR 500: upstream timeout",
+		"path":    "/api/v1/users/42",
+		"pattern": "^/api/v[0-9]+/",
+	})
+
+	inputs := map[string]bool{
+		`message =~ "^ERROR"`:                    true,
+		`message =~ "^WARN"`:                     false,
+		`message !~ "^WARN"`:                     true,
+		`message !~ "timeout$"`:                  false,
+		`path =~ "/users/[0-9]+$"`:               true,
+		`path =~ pattern`:                        true,
+		`path !~ pattern`:                        false,
+		`message =~ "^ERROR" && path =~ "^/api"`: true,
+		`(message =~ "5[0-9]{2}") == true`:       true,
+	}
+
+	for input, expected := range inputs {
+		out, err := Evaluate(ctx, input)
+		if err != nil {
+			t.Errorf("%s: %v", input, err)
+			continue
+		}
+
+		if !equalBool(out, expected) {
+			t.Errorf("%s: expected %v, got %v", input, expected, out)
+		}
+	}
+}
+
+func TestRegexMatchInvalidPattern(t *testing.T) {
+	_, err := Compile(`message =~ "[a-"`)
+	if err == nil || !strings.Contains(err.Error(), "invalid regular expression") {
+		t.Errorf("expected invalid regular expression error at compile time, got %v", err)
+	}
+
+	ctx := SetVariables(context.TODO(), map[string]any{"pattern": "[a-"})
+	_, err = Evaluate(ctx, `"abc" =~ pattern`)
+	if err == nil || !strings.Contains(err.Error(), "invalid regular expression") {
+		t.Errorf("expected invalid regular expression error, got %v", err)
+	}
+
+	_, err = Evaluate(ctx, `5 =~ "[0-9]"`)
+	if err == nil {
+		t.Errorf("expected error for a non-string subject")
+	}
+}
+
+func TestRegexMatchGoTemplate(t *testing.T) {
+	inputs := map[string]string{
+		`message =~ "^ERROR"`: `regexMatch "^ERROR" .message`,
+		`message !~ "^ERROR"`: `not (regexMatch "^ERROR" .message)`,
+	}
+
+	for input, expected := range inputs {
+		lexer := NewLexer(input)
+		p := NewParser(lexer)
+		tree := p.Parse()
+
+		if tree.GoTemplate() != expected {
+			t.Errorf("%s: expected %s, got %s", input, expected, tree.GoTemplate())
+		}
+	}
+}
+
+func TestIndex(t *testing.T) {
+	ctx := SetVariables(context.TODO(), map[string]any{
+		"items":  []any{10, 20, 30, 40, 50},
+		"ints":   []int{1, 2, 3},
+		"matrix": []any{[]any{1, 2}, []any{3, 4}},
+		"name":   "héllo",
+		"user":   map[string]any{"first-name": "Ada", "tags": []any{"x", "y"}},
+		"scores": map[string]int{"ada": 9},
+		"i":      1,
+	})
+
+	inputs := map[string]any{
+		`items[0]`:             10,
+		`items[4]`:             50,
+		`items[-1]`:            50,
+		`items[-5]`:            10,
+		`items[i + 1]`:         30,
+		`ints[2]`:              3,
+		`matrix[1][0]`:         3,
+		`matrix[i][i]`:         4,
+		`name[1]`:              "é",
+		`name[-1]`:             "o",
+		`user["first-name"]`:   "Ada",
+		`user.tags[1]`:         "y",
+		`scores["ada"]`:        9,
+		`int[1, 2, 3][1]`:      2,
+		`[1, 2, 3][-1]`:        3,
+		`items[0] + items[1]`:  30,
+		`"xyz"[0]`:             "x",
+		`user?.tags[0]`:        "x",
+		`len(items[1:3]) == 2`: true,
+		`items[1:3][0]`:        20,
+	}
+
+	for input, expected := range inputs {
+		out, err := Evaluate(ctx, input)
+		if err != nil {
+			t.Errorf("%s: %v", input, err)
+			continue
+		}
+
+		if fmt.Sprint(out) != fmt.Sprint(expected) {
+			t.Errorf("%s: expected %v, got %v", input, expected, out)
+		}
+	}
+}
+
+func TestIndexErrors(t *testing.T) {
+	ctx := SetVariables(context.TODO(), map[string]any{
+		"items": []any{1, 2, 3},
+		"user":  map[string]any{"name": "Ada"},
+	})
+
+	inputs := map[string]string{
+		`items[3]`:     "out of range",
+		`items[-4]`:    "out of range",
+		`items["a"]`:   "index must be an integer",
+		`items[1.5]`:   "index must be an integer",
+		`user["age"]`:  `key "age" not found`,
+		`user[0]`:      "map index must be a string",
+		`5[0]`:         "type mismatch",
+		`items["a":2]`: "slice bounds must be integers",
+		`missing[0]`:   "variable missing not defined",
+	}
+
+	for input, expected := range inputs {
+		_, err := Evaluate(ctx, input)
+		if err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("%s: expected error containing %q, got %v", input, expected, err)
+		}
+	}
+}
+
+func TestSlice(t *testing.T) {
+	ctx := SetVariables(context.TODO(), map[string]any{
+		"items": []any{1, 2, 3, 4, 5},
+		"ints":  []int{1, 2, 3, 4, 5},
+		"name":  "expronaut",
+	})
+
+	inputs := map[string]string{
+		`items[1:3]`:           "[2 3]",
+		`items[:2]`:            "[1 2]",
+		`items[3:]`:            "[4 5]",
+		`items[:]`:             "[1 2 3 4 5]",
+		`items[-2:]`:           "[4 5]",
+		`items[:-2]`:           "[1 2 3]",
+		`items[1:100]`:         "[2 3 4 5]",
+		`items[4:1]`:           "[]",
+		`ints[1:3]`:            "[2 3]",
+		`name[:4]`:             "expr",
+		`name[-4:]`:            "naut",
+		`slice(items, 1, 3)`:   "[2 3]",
+		`slice(items, -2)`:     "[4 5]",
+		`slice(name, 0, 4)`:    "expr",
+		`int[1, 2, 3, 4][1:3]`: "[2 3]",
+	}
+
+	for input, expected := range inputs {
+		out, err := Evaluate(ctx, input)
+		if err != nil {
+			t.Errorf("%s: %v", input, err)
+			continue
+		}
+
+		if fmt.Sprint(out) != expected {
+			t.Errorf("%s: expected %v, got %v", input, expected, out)
+		}
+	}
+}
+
+func TestIndexString(t *testing.T) {
+	inputs := map[string][2]string{
+		`items[0]`:           {`items[0]`, `index .items 0`},
+		`items[-1]`:          {`items[-1]`, `index .items -1`},
+		`user["first-name"]`: {`user[first-name]`, `index .user "first-name"`},
+		`matrix[i][j]`:       {`matrix[i][j]`, `index (index .matrix .i) .j`},
+		`items[i + 1]`:       {`items[(i PLUS 1)]`, `index .items (add .i 1)`},
+		`items[1:3]`:         {`items[1:3]`, `slice .items 1 3`},
+		`items[:3]`:          {`items[:3]`, `slice .items 0 3`},
+		`items[2:]`:          {`items[2:]`, `slice .items 2`},
+	}
+
+	for input, expected := range inputs {
+		tree := MustCompile(input).Tree()
+
+		if tree.String() != expected[0] {
+			t.Errorf("%s: expected String %s, got %s", input, expected[0], tree.String())
+		}
+
+		if tree.GoTemplate() != expected[1] {
+			t.Errorf("%s: expected GoTemplate %s, got %s", input, expected[1], tree.GoTemplate())
+		}
+	}
+}
+
+func TestMapLiteral(t *testing.T) {
+	ctx := SetVariables(context.TODO(), map[string]any{
+		"name":  "Ada",
+		"age":   36,
+		"other": map[string]any{"name": "Ada", "age": 36},
+	})
+
+	inputs := map[string]string{
+		`{}`:                                           "map[]",
+		`{"name": name, "age": age + 1}`:               "map[age:37 name:Ada]",
+		`{"a": {"b": [1, 2]}}`:                         "map[a:map[b:[1 2]]]",
+		`{"a": 1}["a"]`:                                "1",
+		`{"a": {"b": 2}}?.a.b`:                         "2",
+		`{"name": name, "age": age} == other`:          "true",
+		`{"name": name, "age": 37} == other`:           "false",
+		`{"name": name} != other`:                      "true",
+		`{"a": [1, {"b": 2}]} == {"a": [1, {"b": 2}]}`: "true",
+		`"name" in {"name": 1}`:                        "true",
+	}
+
+	for input, expected := range inputs {
+		out, err := Evaluate(ctx, input)
+		if err != nil {
+			t.Errorf("%s: %v", input, err)
+			continue
+		}
+
+		if fmt.Sprint(out) != expected {
+			t.Errorf("%s: expected %v, got %v", input, expected, out)
+		}
+	}
+}
+
+func TestMapLiteralErrors(t *testing.T) {
+	inputs := map[string]string{
+		`{"a": 1, "a": 2}`: `duplicate key "a"`,
+		`{a: 1}`:           `unexpected "a", expected a string key in the map literal`,
+		`{"a" 1}`:          `missing operator between "a" and "1"`,
+		`{"a", "b"}`:       `unexpected ",", expected ":" after the map key`,
+		`{"a": 1`:          `unexpected end of expression, expected "," or "}" in the map entries`,
+	}
+
+	for input, expected := range inputs {
+		_, err := Compile(input)
+		if err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("%s: expected error containing %q, got %v", input, expected, err)
+		}
+	}
+}
+
+func TestMapLiteralString(t *testing.T) {
+	inputs := map[string][2]string{
+		`{"a": 1, "b": x}`:      {`{"a": 1, "b": x}`, `dict "a" 1 "b" .x`},
+		`{"sum": x + 1}`:        {`{"sum": (x PLUS 1)}`, `dict "sum" (add .x 1)`},
+		`{"inner": {"a": "b"}}`: {`{"inner": {"a": b}}`, `dict "inner" (dict "a" "b")`},
+	}
+
+	for input, expected := range inputs {
+		tree := MustCompile(input).Tree()
+
+		if tree.String() != expected[0] {
+			t.Errorf("%s: expected String %s, got %s", input, expected[0], tree.String())
+		}
+
+		if tree.GoTemplate() != expected[1] {
+			t.Errorf("%s: expected GoTemplate %s, got %s", input, expected[1], tree.GoTemplate())
+		}
+	}
+}
+
+func TestNodeSpans(t *testing.T) {
+	inputs := map[string][]string{
+		`1 + max(a.b, -x) * 2`: {
+			`1 + max(a.b, -x) * 2`, `1`, `max(a.b, -x) * 2`, `max(a.b, -x)`, `a.b`, `-x`, `x`, `2`,
+		},
+		`items[1:] ?? {"k": v => v}`: {
+			`items[1:] ?? {"k": v => v}`, `items[1:]`, `items`, `1`, `{"k": v => v}`, `v => v`, `v`,
+		},
+		"c\n  ? \"a\"\n  : int[1, 2]": {
+			"c\n  ? \"a\"\n  : int[1, 2]", `c`, `"a"`, `int[1, 2]`, `1`, `2`,
+		},
+	}
+
+	for input, expected := range inputs {
+		var got []string
+		inspect(MustCompile(input).Tree(), func(node ASTNode) bool {
+			span := spanOf(node)
+			got = append(got, input[span.Start.Offset:span.End.Offset])
+			return true
+		})
+
+		if !slices.Equal(got, expected) {
+			t.Errorf("%s: expected %q, got %q", input, expected, got)
+		}
+	}
+
+	span := spanOf(MustCompile("x +\n  len(y)").Tree().(*BinaryOperationNode).Right)
+	if span.String() != "2:3-2:9" {
+		t.Errorf("expected 2:3-2:9, got %s", span)
+	}
+}
+
+func TestParseErrorPositions(t *testing.T) {
+	inputs := map[string]string{
+		`{"a": 1, "a": 2}`:            `1:10: duplicate key "a" in map literal`,
+		`(x, x) => x`:                 `1:5: duplicate lambda parameter "x"`,
+		`a ? 1`:                       `1:6: unexpected end of expression, expected ":" in the conditional expression`,
+		`name =~ "("`:                 "1:9: invalid regular expression",
+		"1 +\n  99999999999999999999": "2:3: integer overflow",
+		`{"a" 1}`:                     `1:6: missing operator between "a" and "1"`,
+	}
+
+	for input, expected := range inputs {
+		_, err := Compile(input)
+		if err == nil || !strings.HasPrefix(err.Error(), expected) {
+			t.Errorf("%s: expected error starting with %q, got %v", input, expected, err)
+		}
+
+		var located *Error
+		if !errors.As(err, &located) || !located.Span.IsValid() {
+			t.Errorf("%s: expected a located error, got %v", input, err)
+		}
+	}
+}
+
+func TestEvaluateErrorPositions(t *testing.T) {
+	ctx := SetVariables(context.TODO(), map[string]any{
+		"x":     2,
+		"a":     5,
+		"items": []any{1, 2},
+	})
+
+	inputs := map[string]string{
+		`1 + "a" * 2`:            `1:5: type mismatch`,
+		`x > 1 && missing`:       `1:10: variable missing not defined`,
+		"a\n  ? 1 : 2":           `1:1: condition of conditional expression must be boolean`,
+		`x + len(items[5])`:      `1:9: index 5 out of range`,
+		`map(items, v => v / 0)`: `1:17: integer division by zero`,
+		`x < 1 || a`:             `1:1: operands for logical operation must be boolean`,
+		`-"a"`:                   `1:1: type mismatch`,
+		`[1, 2][x:"b"]`:          `1:1:`,
+	}
+
+	for input, expected := range inputs {
+		program, err := Compile(input)
+		if err != nil {
+			t.Errorf("%s: %v", input, err)
+			continue
+		}
+
+		for _, run := range []func() (any, error){
+			func() (any, error) { return program.Run(ctx, nil) },
+			func() (any, error) { return program.Tree().Evaluate(ctx) },
+		} {
+			_, err := run()
+			if err == nil || !strings.HasPrefix(err.Error(), expected) {
+				t.Errorf("%s: expected error starting with %q, got %v", input, expected, err)
+			}
+		}
+	}
+
+	_, err := Evaluate(ctx, `x + missing`)
+
+	var located *Error
+	if !errors.As(err, &located) || located.Span.String() != "1:5-1:12" {
+		t.Errorf("expected an error located at 1:5-1:12, got %v", err)
+	}
+
+	var undefined *UndefinedVariableError
+	if !errors.As(err, &undefined) || undefined.Name != "missing" {
+		t.Errorf("expected an UndefinedVariableError, got %v", err)
+	}
+}
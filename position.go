@@ -0,0 +1,86 @@
+package expronaut
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Position is a location in the source of an expression. The zero Position
+// is not a location, it is used for nodes that were not parsed from source.
+type Position struct {
+	Offset int // byte offset, starting at 0
+	Line   int // line number, starting at 1
+	Column int // column number in characters, starting at 1
+}
+
+// IsValid reports whether the position is a location in the source.
+func (p Position) IsValid() bool {
+	return p.Line > 0
+}
+
+// String returns the position as line:column.
+func (p Position) String() string {
+	if !p.IsValid() {
+		return "-"
+	}
+
+	return fmt.Sprintf("%d:%d", p.Line, p.Column)
+}
+
+// Span is the part of the source between Start and End, End is the position
+// just after its last character.
+type Span struct {
+	Start Position
+	End   Position
+}
+
+// IsValid reports whether the span is a part of the source.
+func (s Span) IsValid() bool {
+	return s.Start.IsValid()
+}
+
+// Len returns the length of the span in bytes.
+func (s Span) Len() int {
+	return s.End.Offset - s.Start.Offset
+}
+
+// String returns the span as line:column-line:column.
+func (s Span) String() string {
+	if !s.IsValid() {
+		return "-"
+	}
+
+	return fmt.Sprintf("%s-%s", s.Start, s.End)
+}
+
+// Error is an error in the part of an expression given by Span. Lexer and
+// parser errors, errors evaluating an expression and the problems found by
+// Check are all returned as an *Error, use errors.As to find the location.
+type Error struct {
+	Span Span
+	Err  error
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %v", e.Span.Start, e.Err)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// locate returns the error located at the span. Errors that already have a
+// location, which is more precise as it is found deeper in the tree, and
+// errors without a valid span are returned as they are.
+func locate(err error, span Span) error {
+	if err == nil || !span.IsValid() {
+		return err
+	}
+
+	var located *Error
+	if errors.As(err, &located) {
+		return err
+	}
+
+	return &Error{Span: span, Err: err}
+}
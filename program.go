@@ -0,0 +1,132 @@
+package expronaut
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// Program is a compiled expression. It is lexed, parsed, validated and lowered
+// to bytecode once by Compile and can then be evaluated any number of times. A
+// Program is immutable after compilation and safe for concurrent use by
+// multiple goroutines.
+type Program struct {
+	source string
+	tree   ASTNode
+	code   *bytecode
+	engine *Engine
+}
+
+// Compile lexes and parses the expression and returns a reusable Program
+// bound to the default engine. Functions are resolved when the expression is
+// compiled; functions that are registered afterwards are looked up when they
+// are called.
+func Compile(expr string) (*Program, error) {
+	return defaultEngine.Compile(expr)
+}
+
+// MustCompile is like Compile but panics if the expression cannot be compiled.
+func MustCompile(expr string) *Program {
+	return defaultEngine.MustCompile(expr)
+}
+
+// Source returns the expression the program was compiled from.
+func (p *Program) Source() string {
+	return p.source
+}
+
+// Tree returns the root node of the parsed expression.
+func (p *Program) Tree() ASTNode {
+	return p.tree
+}
+
+func (p *Program) String() string {
+	return p.tree.String()
+}
+
+// GoTemplate returns the Go template representation of the program.
+func (p *Program) GoTemplate() string {
+	return p.tree.GoTemplate()
+}
+
+// Run evaluates the program. When vars is not nil it replaces the variables
+// stored in ctx for the duration of this evaluation.
+func (p *Program) Run(ctx context.Context, vars map[string]any) (any, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	if vars != nil {
+		ctx = SetVariables(ctx, vars)
+	}
+
+	return p.code.run(withEngine(ctx, p.engine))
+}
+
+// RunBool evaluates the program and expects a boolean result.
+func (p *Program) RunBool(ctx context.Context, vars map[string]any) (bool, error) {
+	ev, err := p.Run(ctx, vars)
+	if err != nil {
+		return false, err
+	}
+
+	b, ok := ev.(bool)
+	if !ok {
+		return false, fmt.Errorf("non-boolean result")
+	}
+
+	return b, nil
+}
+
+// programCacheSize is the maximum number of programs kept by the cache used by
+// the string based evaluation functions.
+const programCacheSize = 1024
+
+// programCache keeps compiled programs keyed by their source so that the
+// string based API (Evaluate, Exp, filter, map, ...) does not re-parse the same
+// expression over and over again.
+type programCache struct {
+	engine     *Engine
+	mu         sync.RWMutex
+	programs   map[string]*Program
+	generation int // incremented by reset
+}
+
+// compile returns the cached program for expr, compiling it when needed.
+// Expressions that fail to compile are not cached.
+func (c *programCache) compile(expr string) (*Program, error) {
+	c.mu.RLock()
+	program, ok := c.programs[expr]
+	generation := c.generation
+	c.mu.RUnlock()
+	if ok {
+		return program, nil
+	}
+
+	program, err := c.engine.Compile(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	// a program compiled while the functions changed may call the old ones
+	if generation == c.generation {
+		if len(c.programs) >= programCacheSize {
+			c.programs = make(map[string]*Program)
+		}
+		c.programs[expr] = program
+	}
+	c.mu.Unlock()
+
+	return program, nil
+}
+
+// reset drops the cached programs, it is called when the functions of the
+// engine change since the programs call the functions they were compiled with.
+func (c *programCache) reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.programs = make(map[string]*Program)
+	c.generation++
+}
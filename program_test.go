@@ -0,0 +1,139 @@
+package expronaut
+
+import (
+	"context"
+	"sync"
+	"testing"
+)
+
+func TestCompileRun(t *testing.T) {
+	program, err := Compile(`foo * 2 + bar.baz`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 5; i++ {
+		out, err := program.Run(context.TODO(), map[string]any{
+			"foo": i,
+			"bar": map[string]any{"baz": 1},
+		})
+		if err != nil {
+			t.Error(err)
+		}
+
+		expected := i*2 + 1
+		if !equalNumber(out, expected) {
+			t.Errorf("expected %v, got %v", expected, out)
+		}
+	}
+}
+
+func TestCompileRunContextVariables(t *testing.T) {
+	program, err := Compile(`foo == 5`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := SetVariables(context.TODO(), map[string]any{"foo": 5})
+
+	out, err := program.RunBool(ctx, nil)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if !out {
+		t.Errorf("expected true, got %v", out)
+	}
+}
+
+func TestCompileRunBoolNonBoolean(t *testing.T) {
+	program, err := Compile(`1 + 1`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = program.RunBool(context.TODO(), nil)
+	if err == nil {
+		t.Errorf("expected error, got nil")
+	}
+}
+
+func TestCompileError(t *testing.T) {
+	_, err := Compile(`45 + ((1250 x 100) / 100)`)
+	if err == nil {
+		t.Errorf("expected error, got nil")
+	}
+}
+
+func TestMustCompilePanics(t *testing.T) {
+	defer func() {
+		if r := recover(); r == nil {
+			t.Errorf("expected panic")
+		}
+	}()
+
+	MustCompile(`45 + ((1250 x 100) / 100)`)
+}
+
+func TestCompileConcurrent(t *testing.T) {
+	program := MustCompile(`x > 10 && x % 2 == 0`)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(x int) {
+			defer wg.Done()
+
+			out, err := program.RunBool(context.TODO(), map[string]any{"x": x})
+			if err != nil {
+				t.Error(err)
+				return
+			}
+
+			expected := x > 10 && x%2 == 0
+			if out != expected {
+				t.Errorf("x=%d: expected %v, got %v", x, expected, out)
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestEvaluateCachesPrograms(t *testing.T) {
+	input := `1 + 2 + 3`
+
+	if _, err := Evaluate(context.TODO(), input); err != nil {
+		t.Fatal(err)
+	}
+
+	first, err := defaultEngine.programs.compile(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	second, err := defaultEngine.programs.compile(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if first != second {
+		t.Errorf("expected the cached program to be reused")
+	}
+}
+
+func BenchmarkEvaluate(b *testing.B) {
+	ctx := SetVariables(context.TODO(), map[string]any{"foo": 10, "bar": 5})
+
+	for i := 0; i < b.N; i++ {
+		_, _ = Evaluate(ctx, `foo * 2 > bar && bar != 0`)
+	}
+}
+
+func BenchmarkProgramRun(b *testing.B) {
+	program := MustCompile(`foo * 2 > bar && bar != 0`)
+	vars := map[string]any{"foo": 10, "bar": 5}
+
+	for i := 0; i < b.N; i++ {
+		_, _ = program.Run(context.TODO(), vars)
+	}
+}
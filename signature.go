@@ -0,0 +1,369 @@
+package expronaut
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"reflect"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrArgumentCount is returned when a function is called with too few or
+	// too many arguments.
+	ErrArgumentCount = errors.New("wrong number of arguments")
+	// ErrArgumentType is returned when an argument of a function call has a
+	// type the signature of the function does not accept.
+	ErrArgumentType = errors.New("invalid argument type")
+)
+
+// Type is the type of a function parameter or result. Types are bit flags, a
+// parameter accepting several types combines them, TypeString | TypeArray.
+// TypeAny accepts every value, including null.
+type Type uint16
+
+const (
+	TypeAny   Type = 0
+	TypeInt   Type = 1 << iota // int, uint and their sized variants, big integers
+	TypeFloat                  // float32 and float64
+	TypeDecimal
+	TypeString
+	TypeBool
+	TypeArray
+	TypeMap
+	TypeTime
+	TypeDuration
+	TypeFunction // a lambda or a function
+
+	TypeNumber = TypeInt | TypeFloat | TypeDecimal
+)
+
+// typeNull is the static type of the null literal, no parameter type but
+// TypeAny accepts it.
+const typeNull Type = 1 << 15
+
+var typeNames = []struct {
+	t    Type
+	name string
+}{
+	{TypeNumber, "number"},
+	{TypeInt, "int"},
+	{TypeFloat, "float"},
+	{TypeDecimal, "decimal"},
+	{TypeString, "string"},
+	{TypeBool, "bool"},
+	{TypeArray, "array"},
+	{TypeMap, "map"},
+	{TypeTime, "time"},
+	{TypeDuration, "duration"},
+	{TypeFunction, "function"},
+	{typeNull, "null"},
+}
+
+func (t Type) String() string {
+	if t == TypeAny {
+		return "any"
+	}
+
+	var names []string
+	for _, tn := range typeNames {
+		if t&tn.t == tn.t {
+			names = append(names, tn.name)
+			t &^= tn.t
+		}
+	}
+
+	return strings.Join(names, " or ")
+}
+
+// accepts reports whether a value of the type other may be passed to a
+// parameter of the type. A value whose type is only known to be one of
+// several types is accepted when one of them is.
+func (t Type) accepts(other Type) bool {
+	return t == TypeAny || other == TypeAny || other&t != 0
+}
+
+// typeOf returns the type of a value, TypeAny when it has none of the types.
+func typeOf(v any) Type {
+	switch v.(type) {
+	case nil:
+		return typeNull
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, *big.Int:
+		return TypeInt
+	case float32, float64:
+		return TypeFloat
+	case Decimal:
+		return TypeDecimal
+	case json.Number:
+		return TypeNumber
+	case string:
+		return TypeString
+	case bool:
+		return TypeBool
+	case time.Time:
+		return TypeTime
+	case time.Duration:
+		return TypeDuration
+	case *Lambda, bifFunc, func(context.Context, ...any) (any, error):
+		return TypeFunction
+	}
+
+	switch reflect.ValueOf(v).Kind() {
+	case reflect.Slice, reflect.Array:
+		return TypeArray
+	case reflect.Map:
+		return TypeMap
+	}
+
+	return TypeAny
+}
+
+// typeName returns the name of the type of a value for error messages.
+func typeName(v any) string {
+	if t := typeOf(v); t != TypeAny {
+		return t.String()
+	}
+
+	return fmt.Sprintf("%T", v)
+}
+
+// Param is a parameter of a function signature.
+type Param struct {
+	Name string // optional, used in error messages
+	Type Type
+	// Optional parameters may be omitted, they follow the required ones.
+	Optional bool
+	// Variadic is set on the last parameter when it accepts any number of
+	// arguments, at least one unless it is also Optional.
+	Variadic bool
+}
+
+// Signature describes the parameters and the result of a function. Calls to
+// a function registered with a signature are checked when the expression is
+// compiled, as far as the types of the arguments are known, and again when
+// the function is called.
+type Signature struct {
+	Params      []Param
+	Result      Type
+	Description string
+}
+
+// String returns the signature in the form abs(x number) number, optional
+// parameters are marked with ? and variadic ones with ...
+func (s Signature) String() string {
+	return s.format("func")
+}
+
+func (s Signature) format(name string) string {
+	params := make([]string, len(s.Params))
+	for i, p := range s.Params {
+		var sb strings.Builder
+		if p.Name != "" {
+			sb.WriteString(p.Name)
+			if p.Optional {
+				sb.WriteByte('?')
+			}
+			sb.WriteByte(' ')
+		}
+		if p.Variadic {
+			sb.WriteString("...")
+		}
+		sb.WriteString(p.Type.String())
+		params[i] = sb.String()
+	}
+
+	return fmt.Sprintf("%s(%s) %s", name, strings.Join(params, ", "), s.Result)
+}
+
+// validate reports parameters that are in the wrong order.
+func (s Signature) validate() error {
+	optional := false
+	for i, p := range s.Params {
+		if p.Variadic && i != len(s.Params)-1 {
+			return fmt.Errorf("variadic parameter %s must be the last parameter", p.Name)
+		}
+		if optional && !p.Optional {
+			return fmt.Errorf("required parameter %s follows an optional parameter", p.Name)
+		}
+		optional = optional || p.Optional
+	}
+
+	return nil
+}
+
+// arity returns the minimum and maximum number of arguments, the maximum is
+// -1 when the last parameter is variadic.
+func (s Signature) arity() (int, int) {
+	var required int
+	for _, p := range s.Params {
+		if !p.Optional {
+			required++
+		}
+	}
+
+	if len(s.Params) > 0 && s.Params[len(s.Params)-1].Variadic {
+		return required, -1
+	}
+
+	return required, len(s.Params)
+}
+
+// param returns the parameter the i-th argument is passed to.
+func (s Signature) param(i int) (Param, bool) {
+	if i < len(s.Params) {
+		return s.Params[i], true
+	}
+
+	if len(s.Params) > 0 && s.Params[len(s.Params)-1].Variadic {
+		return s.Params[len(s.Params)-1], true
+	}
+
+	return Param{}, false
+}
+
+// checkCount checks the number of arguments of a call to the function.
+func (s Signature) checkCount(name string, argc int) error {
+	minArgs, maxArgs := s.arity()
+	if argc >= minArgs && (maxArgs < 0 || argc <= maxArgs) {
+		return nil
+	}
+
+	var expected string
+	switch {
+	case maxArgs == 0:
+		expected = "no arguments"
+	case minArgs == maxArgs:
+		expected = plural(minArgs, "argument")
+	case maxArgs < 0:
+		expected = "at least " + plural(minArgs, "argument")
+	default:
+		expected = fmt.Sprintf("%d to %d arguments", minArgs, maxArgs)
+	}
+
+	return fmt.Errorf("%w: %s expects %s, got %d", ErrArgumentCount, name, expected, argc)
+}
+
+// checkType checks the type of the i-th argument of a call to the function.
+func (s Signature) checkType(name string, i int, t Type, got string) error {
+	p, ok := s.param(i)
+	if !ok || p.Type.accepts(t) {
+		return nil
+	}
+
+	if p.Name == "" {
+		return fmt.Errorf("%w: %s expects argument %d of type %s, got %s", ErrArgumentType, name, i+1, p.Type, got)
+	}
+
+	return fmt.Errorf("%w: %s expects argument %d (%s) of type %s, got %s", ErrArgumentType, name, i+1, p.Name, p.Type, got)
+}
+
+// check checks the arguments of a call to the function.
+func (s Signature) check(name string, args []any) error {
+	if err := s.checkCount(name, len(args)); err != nil {
+		return err
+	}
+
+	for i, arg := range args {
+		if err := s.checkType(name, i, typeOf(arg), typeName(arg)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// bind returns a function that checks its arguments against the signature
+// before calling fn.
+func (s Signature) bind(name string, fn bifFunc) bifFunc {
+	return func(ctx context.Context, args ...any) (any, error) {
+		if err := s.check(name, args); err != nil {
+			return nil, err
+		}
+
+		return fn(ctx, args...)
+	}
+}
+
+func plural(n int, noun string) string {
+	if n == 1 {
+		return fmt.Sprintf("%d %s", n, noun)
+	}
+
+	return fmt.Sprintf("%d %ss", n, noun)
+}
+
+// checkCalls checks the calls in the tree against the functions registered
+// on the engine and their signatures and returns the errors found. Calls to
+// functions that are not registered are reported as UnknownFunctionError. The
+// types of literal arguments and of the results of calls to functions with a
+// signature are checked, the other arguments are only known when the
+// expression is evaluated.
+func (e *Engine) checkCalls(tree ASTNode) []error {
+	var errs []error
+
+	inspect(tree, func(node ASTNode) bool {
+		call, ok := node.(*FunctionCallNode)
+		if !ok {
+			return true
+		}
+
+		if !e.HasFunction(call.FunctionName) {
+			errs = append(errs, locate(&UnknownFunctionError{Name: call.FunctionName}, spanOf(call)))
+			return true
+		}
+
+		sig, ok := e.FunctionSignature(call.FunctionName)
+		if !ok {
+			return true
+		}
+
+		if err := sig.checkCount(call.FunctionName, len(call.Arguments)); err != nil {
+			errs = append(errs, locate(err, spanOf(call)))
+		}
+
+		for i, arg := range call.Arguments {
+			t := e.staticType(arg)
+			if err := sig.checkType(call.FunctionName, i, t, t.String()); err != nil {
+				errs = append(errs, locate(err, spanOf(arg)))
+			}
+		}
+
+		return true
+	})
+
+	return errs
+}
+
+// staticType returns the type of the node when it is known without
+// evaluating it, TypeAny otherwise.
+func (e *Engine) staticType(node ASTNode) Type {
+	switch n := node.(type) {
+	case *IntLiteralNode:
+		return TypeInt
+	case *FloatLiteralNode:
+		return TypeFloat
+	case *StringLiteralNode:
+		return TypeString
+	case *BooleanLiteralNode:
+		return TypeBool
+	case *NullLiteralNode:
+		return typeNull
+	case *DurationLiteralNode:
+		return TypeDuration
+	case *ArrayNode:
+		return TypeArray
+	case *MapNode:
+		return TypeMap
+	case *LambdaNode:
+		return TypeFunction
+	case *FunctionCallNode:
+		if sig, ok := e.FunctionSignature(n.FunctionName); ok {
+			return sig.Result
+		}
+	}
+
+	return TypeAny
+}
@@ -0,0 +1,249 @@
+package expronaut
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestSignatureCompileErrors(t *testing.T) {
+	inputs := map[string]error{
+		`abs()`:                              ErrArgumentCount,
+		`abs(1, 2)`:                          ErrArgumentCount,
+		`now(1)`:                             ErrArgumentCount,
+		`round(1, 2, "up", 4)`:               ErrArgumentCount,
+		`max()`:                              ErrArgumentCount,
+		`concat("a")`:                        ErrArgumentCount,
+		`1 + sqrt(2, 3)`:                     ErrArgumentCount,
+		`map(items, x => abs())`:             ErrArgumentCount,
+		`abs("a")`:                           ErrArgumentType,
+		`len(5)`:                             ErrArgumentType,
+		`sqrt(null)`:                         ErrArgumentType,
+		`date(1)`:                            ErrArgumentType,
+		`slice([1, 2], "a")`:                 ErrArgumentType,
+		`filter([1, 2], 5)`:                  ErrArgumentType,
+		`round(1.5, 2.5)`:                    ErrArgumentType,
+		`max(1, "a")`:                        ErrArgumentType,
+		`date(len("x"))`:                     ErrArgumentType,
+		`items[0] > 1 ? abs(true) : 0`:       ErrArgumentType,
+		`{"a": diffdate(now(), 5m)}`:         ErrArgumentType,
+		`filter(items, x => x > sqrt("2"))`:  ErrArgumentType,
+		`len({"a": 1}) + unknown(1)`:         ErrArgumentType,
+		`nosuch(1)`:                          ErrUnknownFunction,
+		`map(items, x => nosuch(x))`:         ErrUnknownFunction,
+		`duration("1h") + duration(now())`:   ErrArgumentType,
+		`sha256(sha256("a")) == len(int[1])`: nil,
+		`abs(len("abc")) + round(x, 2)`:      nil,
+		`slice("abc", abs(-1))`:              nil,
+		`max(items, 1, 2.5)`:                 nil,
+		`reduce(items, "add", 0)`:            nil,
+		`abs(items[0])`:                      nil,
+	}
+
+	for input, expected := range inputs {
+		_, err := Compile(input)
+		if !errors.Is(err, expected) {
+			t.Errorf("%s: expected %v, got %v", input, expected, err)
+		}
+	}
+}
+
+func TestSignatureErrorMessages(t *testing.T) {
+	inputs := map[string]string{
+		`abs()`:                "1:1: wrong number of arguments: abs expects 1 argument, got 0",
+		`hypot(1)`:             "1:1: wrong number of arguments: hypot expects 2 arguments, got 1",
+		`now(1, 2)`:            "1:1: wrong number of arguments: now expects no arguments, got 2",
+		`round(1, 2, "up", 4)`: "1:1: wrong number of arguments: round expects 1 to 3 arguments, got 4",
+		`concat("a")`:          "1:1: wrong number of arguments: concat expects at least 2 arguments, got 1",
+		`abs("a")`:             "1:5: invalid argument type: abs expects argument 1 (x) of type number, got string",
+		`1 + nosuch(1)`:        "1:5: unknown function: nosuch",
+		`len(true)`:            "1:5: invalid argument type: len expects argument 1 (value) of type string or array, got bool",
+		`max(1, 2, null)`:      "1:11: invalid argument type: max expects argument 3 (values) of type number or array, got null",
+	}
+
+	for input, expected := range inputs {
+		_, err := Compile(input)
+		if err == nil || err.Error() != expected {
+			t.Errorf("%s: expected %q, got %v", input, expected, err)
+		}
+	}
+}
+
+func TestSignatureRuntimeErrors(t *testing.T) {
+	ctx := SetVariables(context.TODO(), map[string]any{
+		"name":  "Ada",
+		"items": []any{1, "a"},
+		"user":  map[string]any{"age": 36},
+	})
+
+	inputs := map[string]string{
+		`abs(name)`:                "abs expects argument 1 (x) of type number, got string",
+		`len(user.age)`:            "len expects argument 1 (value) of type string or array, got int",
+		`max(items)`:               "max function expects number arguments",
+		`map(items, x => abs(x))`:  "abs expects argument 1 (x) of type number, got string",
+		`date(user)`:               "date expects argument 1 (value) of type string, got map",
+		`sqrt(user.missing ?? 4)`:  "",
+		`reduce([1, 2], "now", 0)`: "now expects no arguments, got 2",
+	}
+
+	for input, expected := range inputs {
+		program, err := Compile(input)
+		if err != nil {
+			t.Errorf("%s: %v", input, err)
+			continue
+		}
+
+		for _, run := range []func() (any, error){
+			func() (any, error) { return program.Run(ctx, nil) },
+			func() (any, error) { return program.Tree().Evaluate(ctx) },
+		} {
+			_, err := run()
+			if expected == "" {
+				if err != nil {
+					t.Errorf("%s: %v", input, err)
+				}
+				continue
+			}
+
+			if err == nil || !strings.Contains(err.Error(), expected) {
+				t.Errorf("%s: expected error containing %q, got %v", input, expected, err)
+			}
+		}
+	}
+}
+
+func TestDefineFunction(t *testing.T) {
+	engine := NewEngine()
+	engine.DefineFunction("greet", Signature{
+		Params: []Param{
+			{Name: "name", Type: TypeString},
+			{Name: "greeting", Type: TypeString, Optional: true},
+		},
+		Result:      TypeString,
+		Description: "greet someone",
+	}, func(ctx context.Context, args ...any) (any, error) {
+		greeting := "Hello"
+		if len(args) > 1 {
+			greeting = args[1].(string)
+		}
+		return greeting + " " + args[0].(string), nil
+	})
+	engine.DefineFunction("total", Signature{
+		Params: []Param{{Name: "values", Type: TypeInt, Variadic: true, Optional: true}},
+		Result: TypeInt,
+	}, func(ctx context.Context, args ...any) (any, error) {
+		var total int
+		for _, arg := range args {
+			total += arg.(int)
+		}
+		return total, nil
+	})
+
+	ctx := SetVariables(context.TODO(), map[string]any{"name": "Ada", "age": 36})
+
+	inputs := map[string]string{
+		`greet("Ada")`:          "Hello Ada",
+		`greet(name, "Hi")`:     "Hi Ada",
+		`total()`:               "0",
+		`total(1, 2, age)`:      "39",
+		`greet(name) + "!"`:     "Hello Ada!",
+		`len(greet("x"))`:       "7",
+		`greet(age)`:            "greet expects argument 1 (name) of type string, got int",
+		`greet()`:               "greet expects 1 to 2 arguments, got 0",
+		`greet("a", "b", "c")`:  "greet expects 1 to 2 arguments, got 3",
+		`total(1, "a")`:         "total expects argument 2 (values) of type int, got string",
+		`total(greet("Ada"))`:   "total expects argument 1 (values) of type int, got string",
+		`abs(greet("Ada"))`:     "abs expects argument 1 (x) of type number, got string",
+		`greet(name, total(1))`: "greet expects argument 2 (greeting) of type string, got int",
+	}
+
+	for input, expected := range inputs {
+		out, err := engine.Evaluate(ctx, input)
+		if err != nil {
+			if !strings.Contains(err.Error(), expected) {
+				t.Errorf("%s: expected %q, got %v", input, expected, err)
+			}
+			continue
+		}
+
+		if got := fmt.Sprint(out); got != expected {
+			t.Errorf("%s: expected %s, got %s", input, expected, got)
+		}
+	}
+
+	signature, ok := engine.FunctionSignature("greet")
+	if !ok {
+		t.Fatal("expected the signature of greet")
+	}
+	if got := signature.String(); got != "func(name string, greeting? string) string" {
+		t.Errorf("unexpected signature %s", got)
+	}
+	if signature.Description != "greet someone" {
+		t.Errorf("unexpected description %q", signature.Description)
+	}
+
+	// registering a function without a signature replaces the signature
+	engine.RegisterFunction("greet", func(ctx context.Context, args ...any) (any, error) {
+		return len(args), nil
+	})
+	if _, ok := engine.FunctionSignature("greet"); ok {
+		t.Errorf("expected the signature of greet to be removed")
+	}
+	if out, err := engine.Evaluate(ctx, `greet(1, 2, 3)`); err != nil || out != 3 {
+		t.Errorf("expected 3, got %v (%v)", out, err)
+	}
+}
+
+func TestDefineFunctionInvalidSignature(t *testing.T) {
+	signatures := []Signature{
+		{Params: []Param{{Name: "a", Optional: true}, {Name: "b"}}},
+		{Params: []Param{{Name: "a", Variadic: true}, {Name: "b"}}},
+	}
+
+	for _, signature := range signatures {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s: expected a panic", signature)
+				}
+			}()
+
+			NewEngine().DefineFunction("f", signature, func(ctx context.Context, args ...any) (any, error) {
+				return nil, nil
+			})
+		}()
+	}
+}
+
+func TestBuiltinSignatures(t *testing.T) {
+	for name := range builtins() {
+		signature, ok := builtinSignatures[name]
+		if !ok {
+			t.Errorf("%s: missing signature", name)
+			continue
+		}
+		if signature.Description == "" {
+			t.Errorf("%s: missing description", name)
+		}
+		if err := signature.validate(); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+
+	inputs := map[string]string{
+		"abs":    "func(x number) number",
+		"round":  "func(x number, places? int, mode? string) number",
+		"max":    "func(values ...number or array) number",
+		"reduce": "func(array array, fn string or function, initial? any) any",
+		"now":    "func() time",
+	}
+
+	for name, expected := range inputs {
+		signature, _ := defaultEngine.FunctionSignature(name)
+		if got := signature.String(); got != expected {
+			t.Errorf("%s: expected %s, got %s", name, expected, got)
+		}
+	}
+}
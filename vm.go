@@ -0,0 +1,322 @@
+package expronaut
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+)
+
+// frame holds the mutable state of a single bytecode execution. Frames are
+// pooled so that running a program does not allocate a new stack every time.
+type frame struct {
+	stack  []any
+	slots  []any
+	loaded []bool
+}
+
+var framePool = sync.Pool{
+	New: func() any { return &frame{} },
+}
+
+// reset prepares the frame for running the bytecode.
+func (f *frame) reset(b *bytecode) {
+	if cap(f.stack) < b.maxStack {
+		f.stack = make([]any, b.maxStack)
+	}
+	f.stack = f.stack[:b.maxStack]
+
+	if cap(f.slots) < len(b.variables) {
+		f.slots = make([]any, len(b.variables))
+		f.loaded = make([]bool, len(b.variables))
+	}
+	f.slots = f.slots[:len(b.variables)]
+	f.loaded = f.loaded[:len(b.variables)]
+}
+
+// release clears all references held by the frame and returns it to the pool.
+func (f *frame) release() {
+	clear(f.stack)
+	clear(f.slots)
+	clear(f.loaded)
+	framePool.Put(f)
+}
+
+// run executes the bytecode on a stack based virtual machine.
+func (b *bytecode) run(ctx context.Context) (result any, err error) {
+	f := framePool.Get().(*frame)
+	f.reset(b)
+	defer f.release()
+
+	var (
+		pc       int
+		stack    = f.stack
+		sp       = 0
+		env      Resolver
+		envFound bool
+		envRead  bool
+		params   *scope
+		exact    = decimalMode(ctx)
+	)
+
+	// a getter method panicked while a variable or field was read
+	defer func() {
+		if getterErr := recoverGetter(recover()); getterErr != nil {
+			result, err = nil, locate(getterErr, b.spans[pc])
+		}
+	}()
+
+	for pc = 0; pc < len(b.instructions); pc++ {
+		ins := b.instructions[pc]
+
+		switch ins.op {
+		case opConst:
+			stack[sp] = b.constants[ins.a]
+			sp++
+		case opLoad, opLoadOptional:
+			if !f.loaded[ins.a] {
+				if !envRead {
+					env, envFound = resolverFrom(ctx)
+					params, _ = ctx.Value(scopeKey{}).(*scope)
+					envRead = true
+				}
+
+				slot := b.variables[ins.a]
+
+				var (
+					value  any
+					exists bool
+				)
+				if value, exists = params.lookup(slot.parts[0]); exists {
+					value, exists = lookupFields(value, slot.parts[1:])
+				} else if envFound {
+					// the parts belong to the program, the resolver gets its own copy
+					value, exists = env.Get(slices.Clone(slot.parts))
+				}
+
+				if !exists {
+					if ins.op == opLoadOptional {
+						stack[sp] = nil
+						sp++
+						continue
+					}
+
+					return nil, locate(&UndefinedVariableError{Name: slot.name}, b.spans[pc])
+				}
+
+				f.slots[ins.a] = value
+				f.loaded[ins.a] = true
+			}
+
+			stack[sp] = f.slots[ins.a]
+			sp++
+		case opField:
+			stack[sp-1] = lookupOptional(stack[sp-1], b.fields[ins.a])
+		case opIndex:
+			result, err := indexValue(stack[sp-2], stack[sp-1])
+			if err != nil {
+				return nil, locate(err, b.spans[pc])
+			}
+			sp--
+			stack[sp-1] = result
+		case opSlice:
+			var start, end any
+			if ins.b&2 != 0 {
+				sp--
+				end = stack[sp]
+			}
+			if ins.b&1 != 0 {
+				sp--
+				start = stack[sp]
+			}
+
+			result, err := sliceValue(stack[sp-1], start, end)
+			if err != nil {
+				return nil, locate(err, b.spans[pc])
+			}
+			stack[sp-1] = result
+		case opBinary:
+			operator := b.operators[ins.a]
+			left, right := stack[sp-2], stack[sp-1]
+			sp--
+
+			if !exact {
+				if result, ok := fastBinaryOperation(operator, left, right); ok {
+					stack[sp-1] = result
+					continue
+				}
+			}
+
+			result, err := evalBinaryOperation(ctx, operator, left, right)
+			if err != nil {
+				return nil, locate(err, b.spans[pc])
+			}
+			stack[sp-1] = result
+		case opUnary:
+			result, err := evalUnaryOperation(ctx, b.operators[ins.a], stack[sp-1])
+			if err != nil {
+				return nil, locate(err, b.spans[pc])
+			}
+			stack[sp-1] = result
+		case opMatch:
+			operator := TokenTypeMatch
+			if ins.b == 1 {
+				operator = TokenTypeNotMatch
+			}
+
+			result, err := matchRegexp(b.regexps[ins.a], operator, stack[sp-1])
+			if err != nil {
+				return nil, locate(err, b.spans[pc])
+			}
+			stack[sp-1] = result
+		case opJumpIfFalse, opJumpIfTrue:
+			value, ok := stack[sp-1].(bool)
+			if !ok {
+				return nil, locate(errLogicalOperand, b.spans[pc])
+			}
+
+			if value == (ins.op == opJumpIfTrue) {
+				// the result is decided, leave it on the stack
+				pc = int(ins.a) - 1
+				continue
+			}
+			sp--
+		case opBool:
+			if _, ok := stack[sp-1].(bool); !ok {
+				return nil, locate(errLogicalOperand, b.spans[pc])
+			}
+		case opBranch:
+			condition, ok := stack[sp-1].(bool)
+			if !ok {
+				return nil, locate(errConditionOperand, b.spans[pc])
+			}
+			sp--
+
+			if !condition {
+				pc = int(ins.a) - 1
+			}
+		case opJump:
+			pc = int(ins.a) - 1
+		case opJumpIfNotNull:
+			if stack[sp-1] != nil {
+				pc = int(ins.a) - 1
+				continue
+			}
+			sp--
+		case opCall:
+			argc := int(ins.b)
+			args := make([]any, argc)
+			copy(args, stack[sp-argc:sp])
+			sp -= argc
+
+			fn := b.functions[ins.a]
+			result, err := callFunction(ctx, fn.name, fn.fn, args)
+			if err != nil {
+				return nil, locate(err, b.spans[pc])
+			}
+			stack[sp] = result
+			sp++
+		case opArray:
+			n := int(ins.a)
+
+			var elements []any
+			if n > 0 {
+				elements = make([]any, n)
+				copy(elements, stack[sp-n:sp])
+			}
+			sp -= n
+
+			array, err := typedArray(arrayTypes[ins.b], elements)
+			if err != nil {
+				return nil, locate(err, b.spans[pc])
+			}
+
+			stack[sp] = array
+			sp++
+		case opMap:
+			keys := b.keys[ins.a]
+			n := len(keys)
+
+			result := make(map[string]any, n)
+			for i, key := range keys {
+				result[key] = stack[sp-n+i]
+			}
+			sp -= n
+
+			stack[sp] = result
+			sp++
+		case opLambda:
+			lambda := b.lambdas[ins.a]
+			stack[sp] = &Lambda{params: lambda.node.Params, body: lambda.node.Body, code: lambda.code, ctx: ctx}
+			sp++
+		case opNode:
+			result, err := b.nodes[ins.a].Evaluate(ctx)
+			if err != nil {
+				return nil, locate(err, b.spans[pc])
+			}
+			stack[sp] = result
+			sp++
+		default:
+			return nil, fmt.Errorf("unknown opcode: %s", ins.op)
+		}
+	}
+
+	if sp == 0 {
+		return nil, nil
+	}
+
+	return stack[sp-1], nil
+}
+
+// fastBinaryOperation handles the most common operations on two ints or two
+// floats without going through the generic operator implementation. It
+// reports false when the operands or the operator are not covered.
+func fastBinaryOperation(operator TokenType, left, right any) (any, bool) {
+	switch l := left.(type) {
+	case int:
+		r, ok := right.(int)
+		if !ok {
+			return nil, false
+		}
+
+		// an overflow falls back to the generic implementation, which reports it
+		switch operator {
+		case TokenTypePlus:
+			if result, ok := addInt(l, r); ok {
+				return result, true
+			}
+		case TokenTypeMinus:
+			if result, ok := subInt(l, r); ok {
+				return result, true
+			}
+		case TokenTypeMultiply:
+			if result, ok := mulInt(l, r); ok {
+				return result, true
+			}
+		case TokenTypeEqual, TokenTypeNotEqual,
+			TokenTypeLessThan, TokenTypeLessThanOrEqual,
+			TokenTypeGreaterThan, TokenTypeGreaterThanOrEqual:
+			return applyIntComparison(l, r, operator), true
+		}
+	case float64:
+		r, ok := right.(float64)
+		if !ok {
+			return nil, false
+		}
+
+		switch operator {
+		case TokenTypePlus:
+			return l + r, true
+		case TokenTypeMinus:
+			return l - r, true
+		case TokenTypeMultiply:
+			return l * r, true
+		case TokenTypeEqual, TokenTypeNotEqual,
+			TokenTypeLessThan, TokenTypeLessThanOrEqual,
+			TokenTypeGreaterThan, TokenTypeGreaterThanOrEqual:
+			return applyFloatComparison(l, r, operator), true
+		}
+	}
+
+	return nil, false
+}
@@ -0,0 +1,158 @@
+package expronaut
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+var vmTestVariables = map[string]any{
+	"foo": 10,
+	"bar": map[string]any{
+		"baz": 5,
+		"qux": map[string]any{
+			"quux": 2.5,
+		},
+	},
+	"name": "expronaut",
+}
+
+func TestVMMatchesTreeWalker(t *testing.T) {
+	inputs := []string{
+		`(5 + 5) * 5`,
+		`-2 + 3 * 4 - 5 // 2 ^ 2 << 1 >> 2 % 3`,
+		`foo == ( bar.baz + bar.baz )`,
+		`foo * bar.qux.quux >= 25 && name == "expronaut"`,
+		`sqrt( 5 * 5 ) == 5 && sqrt( 6 * 6  ) == 6`,
+		`max( max(10, 20), max(5.25, 25) )`,
+		`sum(1,2,3,4,5, int[1,2,3,4,5])`,
+		`map(int[1,2,3,4,5], "_x * 2")`,
+		`filter(int[1,2,3,4,5], "x > 3")`,
+		`foo + bar.baz * foo - bar.baz`,
+		`1.5 * 2.0 < 4.25 || false`,
+		`int[1,2,3][-1] + int[1,2,3][0]`,
+		`name[1:4]`,
+		`int[1,2,3,4][foo - 9:]`,
+		`{"foo": foo, "baz": bar.baz} == {"baz": 5, "foo": 10}`,
+	}
+
+	ctx := SetVariables(context.TODO(), vmTestVariables)
+
+	for _, input := range inputs {
+		program, err := Compile(input)
+		if err != nil {
+			t.Errorf("%s: %v", input, err)
+			continue
+		}
+
+		expected, expectedErr := program.Tree().Evaluate(ctx)
+		out, err := program.Run(ctx, nil)
+
+		if fmt.Sprint(expectedErr) != fmt.Sprint(err) {
+			t.Errorf("%s: expected error %v, got %v", input, expectedErr, err)
+		}
+
+		if fmt.Sprintf("%T %v", expected, expected) != fmt.Sprintf("%T %v", out, out) {
+			t.Errorf("%s: expected %T(%v), got %T(%v)", input, expected, expected, out, out)
+		}
+	}
+}
+
+func TestVMErrors(t *testing.T) {
+	inputs := map[string]string{
+		`missing.value`:    "variable missing.value not defined",
+		`"a" > 1`:          "type mismatch",
+		`(1 > 0) && 1`:     "operands for logical operation must be boolean",
+		`1 + foo.bar.baz`:  "variable foo.bar.baz not defined",
+		`len(int[1, "a"])`: "element 1 of int array must be int",
+		`len(int[1, 2])`:   "",
+	}
+
+	ctx := SetVariables(context.TODO(), vmTestVariables)
+
+	for input, expected := range inputs {
+		_, err := MustCompile(input).Run(ctx, nil)
+		if expected == "" {
+			if err != nil {
+				t.Errorf("%s: unexpected error %v", input, err)
+			}
+			continue
+		}
+
+		if err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("%s: expected error containing %q, got %v", input, expected, err)
+		}
+	}
+}
+
+func TestVMLateRegisteredFunction(t *testing.T) {
+	engine := NewEngine()
+
+	if _, err := engine.Compile(`latefn(20) + 1`); !errors.Is(err, ErrUnknownFunction) {
+		t.Fatalf("expected ErrUnknownFunction, got %v", err)
+	}
+
+	engine.RegisterFunction("latefn", func(ctx context.Context, args ...any) (any, error) {
+		return args[0].(int) * 2, nil
+	})
+
+	out, err := engine.MustCompile(`latefn(20) + 1`).Run(context.TODO(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !equalNumber(out, 41) {
+		t.Errorf("expected 41, got %v", out)
+	}
+}
+
+func TestBytecodeString(t *testing.T) {
+	code := defaultEngine.compileNode(MustCompile(`foo + sqrt(4)`).Tree())
+
+	expected := "0000 LOAD     foo\n0001 CONST    4\n0002 CALL     sqrt/1\n0003 BINARY   PLUS\n"
+	if code.String() != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, code.String())
+	}
+}
+
+var vmBenchmarks = []struct {
+	name  string
+	input string
+}{
+	{"Arithmetic", `(foo + 5) * 3 - bar.baz * 2 >= 20`},
+	{"Logical", `foo > 5 && bar.baz < 10 && name == "expronaut" || foo == 0`},
+	{"Nested", `foo * bar.qux.quux + bar.baz * bar.qux.quux - foo / 2`},
+	{"Functions", `max(foo, bar.baz) + abs(-3) + sqrt(16)`},
+}
+
+func BenchmarkTreeWalker(b *testing.B) {
+	ctx := SetVariables(context.TODO(), vmTestVariables)
+
+	for _, bm := range vmBenchmarks {
+		tree := MustCompile(bm.input).Tree()
+
+		b.Run(bm.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				_, _ = tree.Evaluate(ctx)
+			}
+		})
+	}
+}
+
+func BenchmarkVM(b *testing.B) {
+	ctx := SetVariables(context.TODO(), vmTestVariables)
+
+	for _, bm := range vmBenchmarks {
+		program := MustCompile(bm.input)
+
+		b.Run(bm.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				_, _ = program.Run(ctx, nil)
+			}
+		})
+	}
+}